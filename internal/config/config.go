@@ -11,6 +11,7 @@ import (
 
 	"aigent/internal/model"
 	"aigent/internal/core"
+	"aigent/internal/rag"
 	"aigent/internal/sse"
 	"aigent/internal/http"
 )
@@ -21,6 +22,7 @@ type Config struct {
 	Agent      AgentConfig      `json:"agent"`
 	Models     []ModelConfig    `json:"models"`
 	Database   DatabaseConfig   `json:"database"`
+	Embedding  rag.EmbeddingConfig `json:"embedding"` // RAG和语义答案缓存使用的嵌入模型
 	Logging    LoggingConfig    `json:"logging"`
 	Features   FeaturesConfig   `json:"features"`
 }
@@ -39,6 +41,18 @@ type AgentConfig struct {
 	MaxIterations int           `json:"max_iterations"`
 	Timeout       time.Duration `json:"timeout"`
 	Debug         bool          `json:"debug"`
+	Planner       PlannerConfig `json:"planner"`
+	SystemPrompt  string        `json:"system_prompt"`
+	Profile       string        `json:"profile"` // Agent配置名称，答案缓存按此隔离
+
+	AnswerCache core.AnswerCacheConfig `json:"answer_cache"` // 语义答案缓存
+}
+
+// PlannerConfig 规划器配置
+type PlannerConfig struct {
+	Mode      string `json:"mode"`      // single/self_consistency
+	Samples   int    `json:"samples"`   // 自洽规划采样的候选计划数
+	Selection string `json:"selection"` // vote/judge
 }
 
 // ModelConfig模型配置
@@ -51,6 +65,28 @@ type ModelConfig struct {
 	Temperature float64 `json:"temperature"`
 	Timeout     int     `json:"timeout"`
 	Enabled     bool    `json:"enabled"`
+
+	Provider     string            `json:"provider"` // 如openai-compatible，为空时按type选择
+	Headers      map[string]string `json:"headers"`
+	Organization string            `json:"organization"`
+	Project      string            `json:"project"`
+	Path         string            `json:"path"`
+
+	Vision       *bool                      `json:"vision"`       // 是否接受图片输入，为空时按type识别（gpt-4o、qwen-vl等）
+	Capabilities *model.CapabilityOverrides `json:"capabilities"` // 覆盖上下文窗口、最大输出、工具调用、JSON模式和价格
+
+	Options map[string]interface{} `json:"options"` // 提供方特有选项
+
+	// 回退链：provider为fallback时按顺序尝试的模型名称，name即可作为虚拟模型名使用
+	Fallback   []string `json:"fallback"`
+	FallbackOn []string `json:"fallback_on"` // timeout/rate_limit/server/context_length，默认全部
+
+	Pool *model.PoolConfig `json:"pool"` // 多密钥/多地址池
+
+	RateLimit *model.RateLimitConfig `json:"rate_limit"` // 客户端RPM/TPM限流
+	Breaker   *model.BreakerConfig   `json:"breaker"`    // 熔断器
+	Cache     *model.CacheConfig     `json:"cache"`      // 响应缓存
+	Retry     *model.RetryConfig     `json:"retry"`      // 429/5xx自动重试，默认重试2次
 }
 
 // DatabaseConfig 数据库配置
@@ -214,16 +250,43 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("超时时间必须大于0")
 	}
 	
+	switch c.Agent.Planner.Mode {
+	case "", core.PlannerSingle, core.PlannerSelfConsistency:
+	default:
+		return fmt.Errorf("不支持的规划模式: %s", c.Agent.Planner.Mode)
+	}
+	
+	switch c.Agent.Planner.Selection {
+	case "", core.SelectionVote, core.SelectionJudge:
+	default:
+		return fmt.Errorf("不支持的候选计划选择方式: %s", c.Agent.Planner.Selection)
+	}
+	
+	if c.Agent.Planner.Mode == core.PlannerSelfConsistency && c.Agent.Planner.Samples < 2 {
+		return fmt.Errorf("自洽规划的采样数必须至少为2")
+	}
+	
 	// 验证模型配置
-	for i, model := range c.Models {
-		if model.Name == "" {
+	for i, m := range c.Models {
+		if m.Name == "" {
 			return fmt.Errorf("第%d个模型名称不能为空", i+1)
 		}
-		if model.Type == "" {
+		if m.Provider == model.ProviderFallback {
+			if len(m.Fallback) == 0 {
+				return fmt.Errorf("回退链模型 %s 至少需要一个成员", m.Name)
+			}
+			continue
+		}
+		if m.Type == "" {
 			return fmt.Errorf("第%d个模型类型不能为空", i+1)
 		}
 	}
 	
+	// 模拟嵌入向量没有语义，不相关的查询也会命中缓存
+	if c.Agent.AnswerCache.Enabled && !c.Embedding.Configured() {
+		return fmt.Errorf("启用语义答案缓存时必须配置嵌入模型embedding")
+	}
+	
 	//验证数据库配置（如果启用了RAG）
 	if c.Features.EnableRAG {
 		if c.Database.URL == "" && c.Database.Host == "" {
@@ -266,6 +329,30 @@ func (c *Config) GetModelConfigs() []model.ModelConfig {
 			MaxTokens:   modelConfig.MaxTokens,
 			Temperature: modelConfig.Temperature,
 			Timeout:     modelConfig.Timeout,
+			
+			Provider:     modelConfig.Provider,
+			Headers:      modelConfig.Headers,
+			Organization: modelConfig.Organization,
+			Project:      modelConfig.Project,
+			Path:         modelConfig.Path,
+			Vision:       modelConfig.Vision,
+			Capabilities: modelConfig.Capabilities,
+			Options:      modelConfig.Options,
+			Fallback:     modelConfig.Fallback,
+			FallbackOn:   modelConfig.FallbackOn,
+			Pool:         modelConfig.Pool,
+			RateLimit:    modelConfig.RateLimit,
+			Breaker:      modelConfig.Breaker,
+			Retry:        modelConfig.Retry,
+		}
+
+		// postgres缓存默认使用应用的数据库
+		if modelConfig.Cache != nil {
+			cache := *modelConfig.Cache
+			if cache.Backend == model.CachePostgres && cache.DatabaseURL == "" {
+				cache.DatabaseURL = c.GetDatabaseURL()
+			}
+			config.Cache = &cache
 		}
 		
 		if config.Timeout <= 0 {
@@ -284,6 +371,13 @@ func (c *Config) ToCoreAgentConfig() core.AgentConfig {
 		MaxIterations: c.Agent.MaxIterations,
 		Timeout:       c.Agent.Timeout,
 		Debug:         c.Agent.Debug,
+		Planner: core.PlannerConfig{
+			Mode:      c.Agent.Planner.Mode,
+			Samples:   c.Agent.Planner.Samples,
+			Selection: c.Agent.Planner.Selection,
+		},
+		SystemPrompt: c.Agent.SystemPrompt,
+		Profile:      c.Agent.Profile,
 	}
 }
 
@@ -413,9 +507,14 @@ func MergeConfig(configFile string) (*Config, error) {
 			MaxIterations: getEnvOrDefaultInt(envConfig.Agent.MaxIterations, fileConfig.Agent.MaxIterations),
 			Timeout:      getEnvOrDefaultDuration(envConfig.Agent.Timeout, fileConfig.Agent.Timeout),
 			Debug:        envConfig.Agent.Debug || fileConfig.Agent.Debug,
+			Planner:      fileConfig.Agent.Planner,
+			SystemPrompt: fileConfig.Agent.SystemPrompt,
+			Profile:      fileConfig.Agent.Profile,
+			AnswerCache:  fileConfig.Agent.AnswerCache,
 		},
 		Models:   fileConfig.Models, //模型配置通常在配置文件中定义
 		Database: fileConfig.Database,
+		Embedding: fileConfig.Embedding,
 		Logging:  fileConfig.Logging,
 		Features: FeaturesConfig{
 			EnableRAG:     envConfig.Features.EnableRAG || fileConfig.Features.EnableRAG,
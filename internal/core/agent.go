@@ -3,6 +3,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -24,6 +25,7 @@ const (
 	StatusExecuting  AgentStatus = "executing"
 	StatusCompleted  AgentStatus = "completed"
 	StatusError      AgentStatus = "error"
+	StatusWaitingInput AgentStatus = "waiting_input"
 )
 
 // AgentEvent表示Agent执行过程中的事件
@@ -41,6 +43,9 @@ type AgentConfig struct {
 	MaxIterations int           `json:"max_iterations"`
 	Timeout       time.Duration `json:"timeout"`
 	Debug         bool          `json:"debug"`
+	Planner       PlannerConfig `json:"planner"`
+	SystemPrompt  string        `json:"system_prompt,omitempty"` // 作为system消息随每次模型调用发送
+	Profile       string        `json:"profile,omitempty"`       // Agent配置名称，答案缓存按此隔离，默认default
 }
 
 // Agent AI Agent核心实现
@@ -50,6 +55,18 @@ type Agent struct {
 	toolManager *tool.Manager
 	ragEngine   *rag.Engine
 	sseBroker   *sse.Broker
+	hooks       []Hooks
+	strategy    Strategy
+	inputs      *InputBroker
+	runID       string
+	trace       *RunTrace
+	observations *observationLog
+	thinkNotes  []string
+	history     []model.Message // 之前的对话轮次，随每次模型调用发送
+	images      []model.ImagePart // 随查询发送的图片，附加在每次模型调用的user消息上
+	simulated   bool // 试运行模拟模式，检索和提问不访问外部
+	answerCache *AnswerCache
+	tenant      string
 	logger      *logrus.Logger
 }
 
@@ -61,17 +78,38 @@ func NewAgent(config AgentConfig) *Agent {
 	}
 	
 	return &Agent{
-		config: config,
-		logger: logger,
+		config:   config,
+		strategy: &PlanExecuteStrategy{},
+		inputs:   GlobalInputBroker,
+		trace:    NewRunTrace(),
+		observations: &observationLog{},
+		logger:   logger,
 	}
 }
 
+// Config 返回Agent配置
+func (a *Agent) Config() AgentConfig {
+	return a.config
+}
+
 // WithModel 设置模型
 func (a *Agent) WithModel(m model.Model) *Agent {
 	a.model = m
 	return a
 }
 
+// WithHistory 设置对话历史（不含本次查询）
+func (a *Agent) WithHistory(history []model.Message) *Agent {
+	a.history = history
+	return a
+}
+
+// WithImages 设置随查询发送的图片，模型需支持视觉输入
+func (a *Agent) WithImages(images []model.ImagePart) *Agent {
+	a.images = images
+	return a
+}
+
 // WithToolManager 设置工具管理器
 func (a *Agent) WithToolManager(tm *tool.Manager) *Agent {
 	a.toolManager = tm
@@ -90,39 +128,82 @@ func (a *Agent) WithSSE(broker *sse.Broker) *Agent {
 	return a
 }
 
-// Execute执行Think-Execute循环
+// Execute按执行策略处理请求（默认为Think-Execute循环），返回最终答案
 func (a *Agent) Execute(ctx context.Context, query string) (string, error) {
+	result, err := a.Run(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	return result.Answer, nil
+}
+
+// Run按执行策略处理请求，并综合观察结果生成带引用的最终答案
+func (a *Agent) Run(ctx context.Context, query string) (*RunResult, error) {
 	if a.model == nil {
-		return "", fmt.Errorf("model not configured")
+		return nil, fmt.Errorf("model not configured")
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, a.config.Timeout)
 	defer cancel()
 
+	a.trace = NewRunTrace()
+	a.observations = &observationLog{}
+	a.thinkNotes = nil
+	if a.runID == "" {
+		a.runID = fmt.Sprintf("run_%d", time.Now().UnixNano())
+	}
+
 	// 发送开始事件
-	a.sendEvent("start", StatusThinking, "开始处理请求", nil)
+	a.sendEvent("start", StatusThinking, "开始处理请求", map[string]interface{}{
+		"run_id": a.runID,
+	})
 
-	result, err := a.thinkExecuteLoop(ctx, query)
+	cached, embedding := a.cachedAnswer(ctx, query)
+	if cached != nil {
+		a.sendEvent("complete", StatusCompleted, "任务完成（命中答案缓存）", map[string]interface{}{
+			"result":    cached.Answer,
+			"citations": cached.Citations,
+			"cached":    true,
+		})
+		return cached, nil
+	}
+
+	draft, err := a.strategy.Run(ctx, a, query)
 	if err != nil {
+		a.runOnError(ctx, err)
 		a.sendEvent("error", StatusError, fmt.Sprintf("执行出错: %v", err), nil)
-		return "", err
+		return nil, err
 	}
 
+	result := a.synthesize(ctx, query, draft)
+	a.runOnComplete(ctx, &result.Answer)
+	a.cacheAnswer(query, embedding, result)
+
 	a.sendEvent("complete", StatusCompleted, "任务完成", map[string]interface{}{
-		"result": result,
+		"result":    result.Answer,
+		"citations": result.Citations,
 	})
 	
 	return result, nil
 }
 
+// Trace 返回最近一次运行的轨迹
+func (a *Agent) Trace() *RunTrace {
+	return a.trace
+}
+
 // thinkWithRetryInternal 带重试的思考函数
 func (a *Agent) thinkWithRetryInternal(ctx context.Context, query string, retryCount int) (*ExecutionPlan, error) {
 	// 构建重试提示词，包含错误信息
 	prompt := a.buildRetryThinkPrompt(query, retryCount)
+	prompt, err := a.runBeforeThink(ctx, query, retryCount, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("思考前钩子失败: %w", err)
+	}
 	
 	a.logger.Debugf("重试思考提示词: %s", prompt)
 	
-	response, err := a.model.Generate(ctx, prompt)
+	response, err := a.generateWith(ctx, prompt, a.planOptions())
 	if err != nil {
 		return nil, fmt.Errorf("重试思考时模型生成失败: %w", err)
 	}
@@ -135,6 +216,10 @@ func (a *Agent) thinkWithRetryInternal(ctx context.Context, query string, retryC
 		return nil, fmt.Errorf("重试解析执行计划失败: %w", err)
 	}
 
+	if err := a.runAfterThink(ctx, plan); err != nil {
+		return nil, fmt.Errorf("思考后钩子失败: %w", err)
+	}
+
 	return plan, nil
 }
 
@@ -142,6 +227,7 @@ func (a *Agent) thinkWithRetryInternal(ctx context.Context, query string, retryC
 func (a *Agent) thinkExecuteLoop(ctx context.Context, query string) (string, error) {
 	iteration := 0
 	currentQuery := query
+	detector := newStallDetector()
 	
 	for iteration < a.config.MaxIterations {
 		iteration++
@@ -172,6 +258,18 @@ func (a *Agent) thinkExecuteLoop(ctx context.Context, query string) (string, err
 			return result, nil
 		}
 		
+		// 检测重复计划和无进展的迭代，逐级干预
+		if reason := detector.check(plan, result); reason != "" {
+			err := a.interveneStall(detector, iteration, reason)
+			if errors.Is(err, errForceSynthesis) {
+				// 以本轮结果作为初步答案，由Run综合全部观察结果
+				return result, nil
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		
 		// 更新查询为执行结果，继续下一轮
 		currentQuery = result
 	}
@@ -183,10 +281,26 @@ func (a *Agent) thinkExecuteLoop(ctx context.Context, query string) (string, err
 func (a *Agent) think(ctx context.Context, query string, iteration int) (*ExecutionPlan, error) {
 	//构建思考提示词
 	prompt := a.buildThinkPrompt(query, iteration)
+	prompt, err := a.runBeforeThink(ctx, query, iteration, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("思考前钩子失败: %w", err)
+	}
+	
+	// 自洽规划：并行采样多个候选计划并选出一个
+	if a.config.Planner.selfConsistencyEnabled() {
+		plan, err := a.thinkSelfConsistent(ctx, query, iteration, prompt)
+		if err != nil {
+			return nil, fmt.Errorf("自洽规划失败: %w", err)
+		}
+		if err := a.runAfterThink(ctx, plan); err != nil {
+			return nil, fmt.Errorf("思考后钩子失败: %w", err)
+		}
+		return plan, nil
+	}
 	
 	a.logger.Debugf("思考提示词: %s", prompt)
 	
-	response, err := a.model.Generate(ctx, prompt)
+	response, err := a.generateWith(ctx, prompt, a.planOptions())
 	if err != nil {
 		return nil, fmt.Errorf("模型生成失败: %w", err)
 	}
@@ -209,6 +323,10 @@ func (a *Agent) think(ctx context.Context, query string, iteration int) (*Execut
 		return nil, fmt.Errorf("执行计划验证失败: %w", err)
 	}
 
+	if err := a.runAfterThink(ctx, plan); err != nil {
+		return nil, fmt.Errorf("思考后钩子失败: %w", err)
+	}
+
 	return plan, nil
 }
 
@@ -217,19 +335,44 @@ func (a *Agent) execute(ctx context.Context, plan *ExecutionPlan) (string, bool,
 	result := ""
 	shouldContinue := false
 	executionHistory := []string{} // 记录执行历史
+	stepResults := map[string]string{} // 按步骤ID记录结果，供条件和循环引用
 
 	for i, step := range plan.Steps {
 		a.logger.Debugf("执行步骤 %d: %s", i+1, step.Action)
 		
+		step, err := a.runBeforeStep(ctx, i, step)
+		if errors.Is(err, ErrSkipStep) {
+			a.sendEvent(fmt.Sprintf("step_%d_skipped", i+1), StatusExecuting, 
+				fmt.Sprintf("步骤 %d已被钩子跳过", i+1), nil)
+			continue
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("步骤 %d执行前钩子失败: %w", i+1, err)
+		}
+		
+		// 条件不满足时跳过该步骤
+		if ok, err := step.conditionMet(stepResults); err != nil {
+			return "", false, fmt.Errorf("步骤 %d条件求值失败: %w", i+1, err)
+		} else if !ok {
+			a.sendEvent(fmt.Sprintf("step_%d_skipped", i+1), StatusExecuting, 
+				fmt.Sprintf("步骤 %d条件不满足，已跳过: %s", i+1, step.If), nil)
+			continue
+		}
+		
 		// 发送步骤执行事件
 		a.sendEvent(fmt.Sprintf("step_%d_start", i+1), StatusExecuting, 
 			fmt.Sprintf("执行步骤 %d: %s", i+1, step.Action), step)
 		
-		stepResult, err := a.executeStep(ctx, step)
+		var stepResult string
+		if step.Action == "foreach" {
+			stepResult, err = a.executeForeach(ctx, step, stepResults)
+		} else {
+			stepResult, err = a.executeStep(ctx, step)
+		}
 		if err != nil {
 			// 记录错误并尝试恢复
 			errorMsg := fmt.Sprintf("执行步骤 %d失败: %v", i+1, err)
-			a.logger.Errorf(errorMsg)
+			a.logger.Error(errorMsg)
 			
 			// 发送错误事件
 			a.sendEvent(fmt.Sprintf("step_%d_error", i+1), StatusError, errorMsg, nil)
@@ -237,6 +380,7 @@ func (a *Agent) execute(ctx context.Context, plan *ExecutionPlan) (string, bool,
 			// 尝试错误恢复
 			if recoveredResult, recoverErr := a.recoverFromError(ctx, step, err, executionHistory); recoverErr == nil {
 				stepResult = recoveredResult
+				a.observeRecovered(step, stepResult)
 				a.sendEvent(fmt.Sprintf("step_%d_recovered", i+1), StatusExecuting, 
 					"步骤执行已恢复", stepResult)
 			} else {
@@ -244,8 +388,14 @@ func (a *Agent) execute(ctx context.Context, plan *ExecutionPlan) (string, bool,
 			}
 		}
 
+		stepResult, err = a.runAfterStep(ctx, i, step, stepResult)
+		if err != nil {
+			return "", false, fmt.Errorf("步骤 %d执行后钩子失败: %w", i+1, err)
+		}
+
 		result = stepResult
 		executionHistory = append(executionHistory, result)
+		stepResults[step.ID] = stepResult
 		shouldContinue = step.ShouldContinue
 		
 		// 发送步骤完成事件
@@ -268,16 +418,31 @@ func (a *Agent) execute(ctx context.Context, plan *ExecutionPlan) (string, bool,
 
 // executeStep执行单个步骤
 func (a *Agent) executeStep(ctx context.Context, step *PlanStep) (string, error) {
+	var result string
+	var ragResults []rag.SearchResult
+	var err error
+	
 	switch step.Action {
 	case "search_tool":
-		return a.executeToolStep(ctx, step)
+		result, err = a.executeToolStep(ctx, step)
 	case "rag_search":
-		return a.executeRAGStep(ctx, step)
+		ragResults, err = a.executeRAGStep(ctx, step)
+		result = formatRAGResults(ragResults)
 	case "reason":
-		return a.executeReasonStep(ctx, step)
+		result, err = a.executeReasonStep(ctx, step)
+	case "ask_user":
+		result, err = a.executeAskUserStep(ctx, step)
 	default:
 		return "", fmt.Errorf("未知的执行动作: %s", step.Action)
 	}
+	if err != nil {
+		return "", err
+	}
+	
+	// 记录观察结果，供最终答案合成时引用
+	a.observe(step, result, ragResults)
+	
+	return result, nil
 }
 
 // executeToolStep执行工具调用步骤
@@ -286,8 +451,14 @@ func (a *Agent) executeToolStep(ctx context.Context, step *PlanStep) (string, er
 		return "", fmt.Errorf("工具管理器未配置")
 	}
 
-	toolName := step.Parameters["tool_name"].(string)
-	toolInput := step.Parameters["input"].(string)
+	toolName, err := step.stringParam("tool_name")
+	if err != nil {
+		return "", err
+	}
+	toolInput, err := step.stringParam("input")
+	if err != nil {
+		return "", err
+	}
 	
 	result, err := a.toolManager.ExecuteTool(ctx, toolName, toolInput)
 	if err != nil {
@@ -298,12 +469,20 @@ func (a *Agent) executeToolStep(ctx context.Context, step *PlanStep) (string, er
 }
 
 // executeRAGStep执行RAG检索步骤
-func (a *Agent) executeRAGStep(ctx context.Context, step *PlanStep) (string, error) {
+func (a *Agent) executeRAGStep(ctx context.Context, step *PlanStep) ([]rag.SearchResult, error) {
+	if a.simulated {
+		query, _ := step.Parameters["query"].(string)
+		return simulatedRAGResults(query), nil
+	}
+	
 	if a.ragEngine == nil {
-		return "", fmt.Errorf("RAG引擎未配置")
+		return nil, fmt.Errorf("RAG引擎未配置")
 	}
 
-	query := step.Parameters["query"].(string)
+	query, err := step.stringParam("query")
+	if err != nil {
+		return nil, err
+	}
 	topK := 5
 	if k, ok := step.Parameters["top_k"].(float64); ok {
 		topK = int(k)
@@ -311,17 +490,20 @@ func (a *Agent) executeRAGStep(ctx context.Context, step *PlanStep) (string, err
 	
 	results, err := a.ragEngine.Search(ctx, query, topK)
 	if err != nil {
-		return "", fmt.Errorf("RAG检索失败: %w", err)
+		return nil, fmt.Errorf("RAG检索失败: %w", err)
 	}
 
-	return formatRAGResults(results), nil
+	return results, nil
 }
 
 // executeReasonStep执行推理步骤
 func (a *Agent) executeReasonStep(ctx context.Context, step *PlanStep) (string, error) {
-	prompt := step.Parameters["prompt"].(string)
+	prompt, err := step.stringParam("prompt")
+	if err != nil {
+		return "", err
+	}
 	
-	response, err := a.model.Generate(ctx, prompt)
+	response, err := a.generateStreaming(ctx, phaseReason, step.ID, prompt)
 	if err != nil {
 		return "", fmt.Errorf("推理失败: %w", err)
 	}
@@ -339,56 +521,79 @@ func (a *Agent) validatePlan(plan *ExecutionPlan, query string) error {
 		return fmt.Errorf("执行计划必须包含至少一个步骤")
 	}
 	
+	if err := a.validateSteps(plan); err != nil {
+		return err
+	}
+	
+	// 检查计划的最终目标相关性
+	if !a.isPlanRelevant(plan, query) {
+		return fmt.Errorf("执行计划与用户查询的相关性不足")
+	}
+	
+	return nil
+}
+
+// validateSteps 检查步骤依赖的组件和参数是否可用
+func (a *Agent) validateSteps(plan *ExecutionPlan) error {
 	// 检查步骤的逻辑连贯性
 	for i, step := range plan.Steps {
-		// 检查工具调用步骤的参数
-		if step.Action == "search_tool" {
-			if a.toolManager == nil {
-				return fmt.Errorf("步骤 %d需要工具调用，但工具管理器未配置", i+1)
-			}
-			
-			toolName, ok := step.Parameters["tool_name"].(string)
-			if !ok || toolName == "" {
-				return fmt.Errorf("步骤 %d的工具调用缺少tool_name参数", i+1)
-			}
-			
-			// 检查工具是否存在
-			tools := a.toolManager.ListTools()
-			toolExists := false
-			for _, t := range tools {
-				if t.Name == toolName {
-					toolExists = true
-					break
-				}
-			}
-			if !toolExists {
-				return fmt.Errorf("步骤 %d指定的工具 %s 不存在", i+1, toolName)
-			}
+		if err := a.validateStep(i, step); err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+// validateStep 检查单个步骤依赖的组件和参数是否可用
+func (a *Agent) validateStep(i int, step *PlanStep) error {
+	// 循环步骤检查其子步骤
+	if step.Action == "foreach" && step.Foreach != nil && step.Foreach.Step != nil {
+		step = step.Foreach.Step
+	}
+	
+	// 检查工具调用步骤的参数
+	if step.Action == "search_tool" {
+		if a.toolManager == nil {
+			return fmt.Errorf("步骤 %d需要工具调用，但工具管理器未配置", i+1)
 		}
 		
-		// 检查RAG检索步骤
-		if step.Action == "rag_search" {
-			if a.ragEngine == nil {
-				return fmt.Errorf("步骤 %d需要RAG检索，但RAG引擎未配置", i+1)
-			}
-			
-			queryParam, ok := step.Parameters["query"].(string)
-			if !ok || queryParam == "" {
-				return fmt.Errorf("步骤 %d的RAG检索缺少query参数", i+1)
-			}
+		toolName, ok := step.Parameters["tool_name"].(string)
+		if !ok || toolName == "" {
+			return fmt.Errorf("步骤 %d的工具调用缺少tool_name参数", i+1)
 		}
 		
-		// 检查推理步骤
-		if step.Action == "reason" {
-			if _, ok := step.Parameters["prompt"].(string); !ok {
-				return fmt.Errorf("步骤 %d的推理缺少prompt参数", i+1)
+		// 检查工具是否存在
+		tools := a.toolManager.ListTools()
+		toolExists := false
+		for _, t := range tools {
+			if t.Name == toolName {
+				toolExists = true
+				break
 			}
 		}
+		if !toolExists {
+			return fmt.Errorf("步骤 %d指定的工具 %s 不存在", i+1, toolName)
+		}
 	}
 	
-	// 检查计划的最终目标相关性
-	if !a.isPlanRelevant(plan, query) {
-		return fmt.Errorf("执行计划与用户查询的相关性不足")
+	// 检查RAG检索步骤
+	if step.Action == "rag_search" {
+		if a.ragEngine == nil {
+			return fmt.Errorf("步骤 %d需要RAG检索，但RAG引擎未配置", i+1)
+		}
+		
+		queryParam, ok := step.Parameters["query"].(string)
+		if !ok || queryParam == "" {
+			return fmt.Errorf("步骤 %d的RAG检索缺少query参数", i+1)
+		}
+	}
+	
+	// 检查推理步骤
+	if step.Action == "reason" {
+		if _, ok := step.Parameters["prompt"].(string); !ok {
+			return fmt.Errorf("步骤 %d的推理缺少prompt参数", i+1)
+		}
 	}
 	
 	return nil
@@ -438,20 +643,14 @@ func (a *Agent) sendEvent(id string, status AgentStatus, message string, data in
 
 // buildRetryThinkPrompt构建重试思考提示词
 func (a *Agent) buildRetryThinkPrompt(query string, retryCount int) string {
-	availableTools := []string{}
-	if a.toolManager != nil {
-		tools := a.toolManager.ListTools()
-		for _, t := range tools {
-			availableTools = append(availableTools, t.Name)
-		}
-	}
+	availableTools := a.availableTools()
 
 	template := `你是一个智能AI助手，之前的执行计划解析失败了，请重新分析用户问题并制定正确的执行计划。
 
 用户问题: %s
 重试次数: 第%d次
 
-可用工具: %v
+可用工具: %s
 
 请重新分析问题并制定执行计划，使用以下JSON格式:
 
@@ -459,7 +658,7 @@ func (a *Agent) buildRetryThinkPrompt(query string, retryCount int) string {
   "thought": "你的思考过程，需要更详细地分析问题",
   "steps": [
     {
-      "action": "具体执行动作(search_tool/rag_search/reason)",
+      "action": "具体执行动作(search_tool/rag_search/reason/ask_user/foreach)",
       "parameters": {
         "相关参数": "值"
       },
@@ -481,19 +680,13 @@ func (a *Agent) buildRetryThinkPrompt(query string, retryCount int) string {
 
 // buildThinkPrompt构建思考阶段的提示词
 func (a *Agent) buildThinkPrompt(query string, iteration int) string {
-	availableTools := []string{}
-	if a.toolManager != nil {
-		tools := a.toolManager.ListTools()
-		for _, t := range tools {
-			availableTools = append(availableTools, t.Name)
-		}
-	}
+	availableTools := a.availableTools()
 
 	template := `你是一个智能AI助手，需要分析用户问题并制定执行计划。
 
 当前轮次: 第 %d用户问题: %s
 
-可用工具: %v
+可用工具: %s
 
 请分析问题并制定执行计划，使用以下JSON格式:
 
@@ -501,7 +694,7 @@ func (a *Agent) buildThinkPrompt(query string, iteration int) string {
   "thought": "你的思考过程",
   "steps": [
     {
-      "action": "具体执行动作(search_tool/rag_search/reason)",
+      "action": "具体执行动作(search_tool/rag_search/reason/ask_user/foreach)",
       "parameters": {
         "相关参数": "值"
       },
@@ -514,10 +707,24 @@ func (a *Agent) buildThinkPrompt(query string, iteration int) string {
 - search_tool:调用工具，参数包括tool_name, input
 - rag_search:向检索，参数包括query, top_k
 - reason:推分析，参数包括prompt
+- ask_user:问题有歧义时向用户提问并等待回答，参数包括question, default(超时默认值), timeout_seconds
+- foreach:对前序步骤产生的列表逐项执行子步骤，需提供foreach字段:
+  {"items": "steps.<id>.json.<路径>", "step": {子步骤}, "max_items": 20, "concurrency": 2}
+  子步骤参数中的{{item}}会被替换为当前项
+
+步骤可选字段:
+- id:步骤ID，默认为step_<序号>
+- if:条件表达式，为假时跳过该步骤，如 steps.step_1.output contains "北京"
+  或 steps.step_1.json.temp > 20，可用&&、||、!组合
 
 请只返回JSON格式的计划，不要其他说明。`
 
-	return fmt.Sprintf(template, iteration, query, availableTools)
+	prompt := fmt.Sprintf(template, iteration, query, availableTools)
+	if len(a.thinkNotes) > 0 {
+		prompt += "\n\n" + strings.Join(a.thinkNotes, "\n")
+	}
+	
+	return prompt
 }
 
 // recoverFromError 从错误中恢复
@@ -550,7 +757,10 @@ func (a *Agent) recoverToolError(ctx context.Context, step *PlanStep, history []
 		return "", fmt.Errorf("工具管理器未配置，无法恢复")
 	}
 	
-	toolName := step.Parameters["tool_name"].(string)
+	toolName, err := step.stringParam("tool_name")
+	if err != nil {
+		return "", err
+	}
 	
 	// 尝试使用不同的参数重新调用
 	alternativeInputs := a.generateAlternativeInputs(step, history)
@@ -571,7 +781,10 @@ func (a *Agent) recoverRAGError(ctx context.Context, step *PlanStep, history []s
 		return "", fmt.Errorf("RAG引擎未配置，无法恢复")
 	}
 	
-	query := step.Parameters["query"].(string)
+	query, err := step.stringParam("query")
+	if err != nil {
+		return "", err
+	}
 	
 	// 尝试修改查询语句
 	alternativeQueries := a.generateAlternativeQueries(query, history)
@@ -588,13 +801,16 @@ func (a *Agent) recoverRAGError(ctx context.Context, step *PlanStep, history []s
 
 // recoverReasonError 推理错误恢复
 func (a *Agent) recoverReasonError(ctx context.Context, step *PlanStep, history []string) (string, error) {
-	originalPrompt := step.Parameters["prompt"].(string)
+	originalPrompt, err := step.stringParam("prompt")
+	if err != nil {
+		return "", err
+	}
 	
 	// 基于历史信息生成新的推理提示词
 	recoveryPrompt := fmt.Sprintf("之前的推理过程出现了问题，请基于以下历史信息重新思考：\n\n历史执行结果: %v\n\n原始问题: %s\n\n请重新分析并给出合理的回答。", 
 		strings.Join(history, "; "), originalPrompt)
 	
-	response, err := a.model.Generate(ctx, recoveryPrompt)
+	response, err := a.generate(ctx, recoveryPrompt)
 	if err != nil {
 		return "", fmt.Errorf("恢复推理失败: %w", err)
 	}
@@ -607,7 +823,7 @@ func (a *Agent) defaultRecovery(ctx context.Context, step *PlanStep, history []s
 	recoveryPrompt := fmt.Sprintf("执行过程中遇到错误: %s\n\n历史执行情况: %v\n\n请基于现有信息给出一个合理的回答或解决方案。", 
 		errorMsg, strings.Join(history, "; "))
 	
-	response, err := a.model.Generate(ctx, recoveryPrompt)
+	response, err := a.generate(ctx, recoveryPrompt)
 	if err != nil {
 		return "", fmt.Errorf("默认恢复策略失败: %w", err)
 	}
@@ -0,0 +1,331 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"aigent/internal/rag"
+)
+
+// 答案缓存默认参数
+const (
+	DefaultProfile = "default"
+
+	defaultAnswerCacheThreshold  = 0.95
+	defaultAnswerCacheTTL        = 3600 // 秒
+	defaultAnswerCacheMaxEntries = 1000
+)
+
+// AnswerCacheConfig 语义答案缓存配置
+type AnswerCacheConfig struct {
+	Enabled          bool     `json:"enabled"`
+	Threshold        float64  `json:"threshold,omitempty"`         // 命中所需的最小余弦相似度，默认0.95
+	TTL              int      `json:"ttl,omitempty"`               // 过期时间（秒），默认3600
+	MaxEntries       int      `json:"max_entries,omitempty"`       // 最大条目数，超出时淘汰最早的条目，默认1000
+	DisabledProfiles []string `json:"disabled_profiles,omitempty"` // 不使用缓存的Agent配置
+}
+
+// AnswerScope 缓存隔离范围：同一Agent配置和租户内的查询才会互相命中
+type AnswerScope struct {
+	Profile string `json:"profile"`
+	Tenant  string `json:"tenant,omitempty"`
+}
+
+// AnswerCacheFilter 失效条件，空字段匹配全部
+type AnswerCacheFilter struct {
+	Profile string `json:"profile,omitempty"`
+	Tenant  string `json:"tenant,omitempty"`
+	ID      string `json:"id,omitempty"`
+}
+
+// AnswerCacheHit 命中的缓存答案
+type AnswerCacheHit struct {
+	EntryID    string     `json:"entry_id"`
+	Query      string     `json:"query"` // 缓存中的原始查询
+	Similarity float64    `json:"similarity"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Result     *RunResult `json:"-"`
+}
+
+// AnswerCacheStats 答案缓存统计
+type AnswerCacheStats struct {
+	Entries     int   `json:"entries"`
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Invalidated int64 `json:"invalidated"`
+}
+
+// answerEntry 缓存条目
+type answerEntry struct {
+	id        string
+	scope     AnswerScope
+	query     string
+	embedding []float32
+	result    RunResult
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// AnswerCache 按查询语义相似度复用最终答案的缓存
+//
+// 查询通过嵌入模型向量化，在同一范围内查找相似度不低于阈值的未过期条目。
+type AnswerCache struct {
+	embedder  rag.EmbeddingModel
+	threshold float64
+	ttl       time.Duration
+	maxSize   int
+	disabled  map[string]bool
+
+	mu      sync.Mutex
+	entries map[AnswerScope][]*answerEntry
+	size    int
+	seq     int64
+	stats   AnswerCacheStats
+}
+
+// NewAnswerCache 创建语义答案缓存
+func NewAnswerCache(embedder rag.EmbeddingModel, config AnswerCacheConfig) *AnswerCache {
+	threshold := config.Threshold
+	if threshold <= 0 {
+		threshold = defaultAnswerCacheThreshold
+	}
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = defaultAnswerCacheTTL
+	}
+	maxSize := config.MaxEntries
+	if maxSize <= 0 {
+		maxSize = defaultAnswerCacheMaxEntries
+	}
+
+	disabled := make(map[string]bool, len(config.DisabledProfiles))
+	for _, profile := range config.DisabledProfiles {
+		disabled[profile] = true
+	}
+
+	return &AnswerCache{
+		embedder:  embedder,
+		threshold: threshold,
+		ttl:       time.Duration(ttl) * time.Second,
+		maxSize:   maxSize,
+		disabled:  disabled,
+		entries:   make(map[AnswerScope][]*answerEntry),
+	}
+}
+
+// Enabled 判断Agent配置是否使用缓存
+func (c *AnswerCache) Enabled(profile string) bool {
+	return !c.disabled[profile]
+}
+
+// Embed 向量化查询
+func (c *AnswerCache) Embed(ctx context.Context, query string) ([]float32, error) {
+	embedding, err := c.embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("生成查询向量失败: %w", err)
+	}
+	return embedding, nil
+}
+
+// Lookup 在范围内查找最相似的未过期答案，低于阈值时返回nil
+func (c *AnswerCache) Lookup(scope AnswerScope, embedding []float32) *AnswerCacheHit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(scope)
+
+	var best *answerEntry
+	bestScore := 0.0
+	for _, entry := range c.entries[scope] {
+		if score := rag.CosineSimilarity(embedding, entry.embedding); score >= c.threshold && score > bestScore {
+			best, bestScore = entry, score
+		}
+	}
+
+	if best == nil {
+		c.stats.Misses++
+		return nil
+	}
+
+	c.stats.Hits++
+	result := best.result
+	return &AnswerCacheHit{
+		EntryID:    best.id,
+		Query:      best.query,
+		Similarity: bestScore,
+		CreatedAt:  best.createdAt,
+		Result:     &result,
+	}
+}
+
+// Store 缓存最终答案，返回条目ID
+func (c *AnswerCache) Store(scope AnswerScope, query string, embedding []float32, result *RunResult) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	now := time.Now()
+	entry := &answerEntry{
+		id:        fmt.Sprintf("ans_%d_%d", now.UnixNano(), c.seq),
+		scope:     scope,
+		query:     query,
+		embedding: embedding,
+		result:    *result,
+		createdAt: now,
+		expiresAt: now.Add(c.ttl),
+	}
+	c.entries[scope] = append(c.entries[scope], entry)
+	c.size++
+
+	for c.size > c.maxSize {
+		c.evictOldest()
+	}
+
+	return entry.id
+}
+
+// Invalidate 删除符合条件的条目，返回删除数量
+func (c *AnswerCache) Invalidate(filter AnswerCacheFilter) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for scope, entries := range c.entries {
+		if (filter.Profile != "" && scope.Profile != filter.Profile) ||
+			(filter.Tenant != "" && scope.Tenant != filter.Tenant) {
+			continue
+		}
+
+		kept := entries[:0]
+		for _, entry := range entries {
+			if filter.ID != "" && entry.id != filter.ID {
+				kept = append(kept, entry)
+				continue
+			}
+			removed++
+		}
+		c.setScope(scope, kept)
+	}
+
+	c.size -= removed
+	c.stats.Invalidated += int64(removed)
+	return removed
+}
+
+// Stats 返回缓存统计
+func (c *AnswerCache) Stats() AnswerCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.size
+	return stats
+}
+
+// expire 删除范围内已过期的条目，调用方持有锁
+func (c *AnswerCache) expire(scope AnswerScope) {
+	now := time.Now()
+	entries := c.entries[scope]
+	kept := entries[:0]
+	for _, entry := range entries {
+		if now.Before(entry.expiresAt) {
+			kept = append(kept, entry)
+		}
+	}
+	c.size -= len(entries) - len(kept)
+	c.setScope(scope, kept)
+}
+
+// evictOldest 淘汰最早创建的条目，调用方持有锁
+func (c *AnswerCache) evictOldest() {
+	var oldest *answerEntry
+	for _, entries := range c.entries {
+		// 每个范围内按创建顺序排列，只需比较各范围的首个条目
+		if len(entries) > 0 && (oldest == nil || entries[0].createdAt.Before(oldest.createdAt)) {
+			oldest = entries[0]
+		}
+	}
+	if oldest == nil {
+		return
+	}
+	c.setScope(oldest.scope, c.entries[oldest.scope][1:])
+	c.size--
+}
+
+// setScope 更新范围内的条目，为空时删除范围，调用方持有锁
+func (c *AnswerCache) setScope(scope AnswerScope, entries []*answerEntry) {
+	if len(entries) == 0 {
+		delete(c.entries, scope)
+		return
+	}
+	c.entries[scope] = entries
+}
+
+// WithAnswerCache 设置语义答案缓存
+func (a *Agent) WithAnswerCache(cache *AnswerCache) *Agent {
+	a.answerCache = cache
+	return a
+}
+
+// WithTenant 设置租户，答案缓存按租户隔离
+func (a *Agent) WithTenant(tenant string) *Agent {
+	a.tenant = tenant
+	return a
+}
+
+// answerScope 返回本次运行的缓存范围
+func (a *Agent) answerScope() AnswerScope {
+	profile := a.config.Profile
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	return AnswerScope{Profile: profile, Tenant: a.tenant}
+}
+
+// cachedAnswer 查找缓存的答案，命中时推送cache_hit事件；同时返回查询向量供写入缓存
+//
+// 带对话历史或图片的查询依赖上下文，不读写缓存。
+func (a *Agent) cachedAnswer(ctx context.Context, query string) (*RunResult, []float32) {
+	scope := a.answerScope()
+	if a.answerCache == nil || len(a.history) > 0 || len(a.images) > 0 || !a.answerCache.Enabled(scope.Profile) {
+		return nil, nil
+	}
+
+	embedding, err := a.answerCache.Embed(ctx, query)
+	if err != nil {
+		a.logger.WithError(err).Warn("答案缓存查询失败")
+		return nil, nil
+	}
+
+	hit := a.answerCache.Lookup(scope, embedding)
+	if hit == nil {
+		return nil, embedding
+	}
+
+	result := hit.Result
+	result.RunID = a.runID
+
+	if a.sseBroker != nil {
+		a.sseBroker.Broadcast("cache_hit", map[string]interface{}{
+			"run_id":        a.runID,
+			"query":         query,
+			"matched_query": hit.Query,
+			"similarity":    hit.Similarity,
+			"entry_id":      hit.EntryID,
+			"cached_at":     hit.CreatedAt,
+			"profile":       scope.Profile,
+			"tenant":        scope.Tenant,
+		})
+	}
+	return result, nil
+}
+
+// cacheAnswer 写入最终答案
+func (a *Agent) cacheAnswer(query string, embedding []float32, result *RunResult) {
+	if embedding == nil {
+		return
+	}
+	a.answerCache.Store(a.answerScope(), query, embedding, result)
+}
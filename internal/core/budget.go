@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"aigent/internal/model"
+)
+
+// toolDetailMinContext 规划提示词附带工具说明所需的最小上下文窗口，窗口较小的模型只列出工具名
+const toolDetailMinContext = 32000
+
+// capabilities 返回当前模型的能力描述
+func (a *Agent) capabilities() model.Capabilities {
+	return model.ModelCapabilities(a.model)
+}
+
+// planOptions 规划调用的生成参数：模型支持JSON模式时强制输出JSON，避免计划夹带说明文字
+func (a *Agent) planOptions() model.ChatOptions {
+	return model.ChatOptions{JSONMode: a.capabilities().JSONMode}
+}
+
+// availableTools 规划提示词中的可用工具：上下文窗口足够时附带工具说明，否则只列出名称
+func (a *Agent) availableTools() string {
+	if a.toolManager == nil {
+		return "[]"
+	}
+	tools := a.toolManager.ListTools()
+
+	if a.model == nil || a.capabilities().ContextWindow < toolDetailMinContext {
+		names := make([]string, 0, len(tools))
+		for _, t := range tools {
+			names = append(names, t.Name)
+		}
+		return fmt.Sprint(names)
+	}
+
+	var sb strings.Builder
+	for _, t := range tools {
+		sb.WriteString("\n- " + t.Name)
+		if t.Description != "" {
+			sb.WriteString(": " + t.Description)
+		}
+	}
+	return sb.String()
+}
+
+// fitHistory 返回能放入上下文窗口的对话历史：为system提示词、本次提示词和输出预留空间后，
+// 从最近的轮次向前保留，丢弃最早的消息；保留部分以user消息开头
+func (a *Agent) fitHistory(prompt string) []model.Message {
+	if len(a.history) == 0 {
+		return nil
+	}
+	caps := a.capabilities()
+	if caps.ContextWindow <= 0 {
+		return a.history
+	}
+
+	modelID := a.model.Config().ModelID
+	fixed := []model.Message{{Role: model.RoleUser, Content: prompt}}
+	if a.config.SystemPrompt != "" {
+		fixed = append(fixed, model.Message{Role: model.RoleSystem, Content: a.config.SystemPrompt})
+	}
+	budget := caps.ContextWindow - a.outputReserve(caps) - model.CountMessageTokens(modelID, fixed)
+
+	// 每条消息的token数（不含回复引导的固定开销）
+	base := model.CountMessageTokens(modelID, nil)
+	start := len(a.history)
+	for start > 0 {
+		cost := model.CountMessageTokens(modelID, a.history[start-1:start]) - base
+		if cost > budget {
+			break
+		}
+		budget -= cost
+		start--
+	}
+	for start < len(a.history) && a.history[start].Role != model.RoleUser {
+		start++
+	}
+
+	if start > 0 {
+		a.logger.Debugf("对话历史超出模型上下文窗口，丢弃最早的%d条消息", start)
+	}
+	return a.history[start:]
+}
+
+// outputReserve 为模型输出预留的token数：模型配置的max_tokens，未配置时使用模型的最大输出
+func (a *Agent) outputReserve(caps model.Capabilities) int {
+	reserve := a.model.Config().MaxTokens
+	if reserve <= 0 || (caps.MaxOutputTokens > 0 && reserve > caps.MaxOutputTokens) {
+		reserve = caps.MaxOutputTokens
+	}
+	return reserve
+}
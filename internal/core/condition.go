@@ -0,0 +1,517 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 条件表达式语法:
+//
+//	expr       := or
+//	or         := and ("||" and)*
+//	and        := unary ("&&" unary)*
+//	unary      := "!" unary | "(" expr ")" | comparison
+//	comparison := ref [op literal]
+//	op         := "==" | "!=" | ">" | ">=" | "<" | "<=" | "contains"
+//	ref        := steps.<id>.output | steps.<id>.json[.<path>]
+//	literal    := "字符串" | 数字 | true | false | null
+//
+// 示例: steps.search.output contains "北京" && steps.weather.json.temp > 20
+
+// conditionNode 条件表达式语法树节点
+type conditionNode interface {
+	eval(results map[string]string) (interface{}, error)
+}
+
+// stepRef 对前序步骤结果的引用
+type stepRef struct {
+	StepID string
+	JSON   bool
+	Path   []string
+}
+
+// literalNode 字面量
+type literalNode struct {
+	value interface{}
+}
+
+// notNode 逻辑非
+type notNode struct {
+	operand conditionNode
+}
+
+// logicalNode 逻辑与/或
+type logicalNode struct {
+	op          string
+	left, right conditionNode
+}
+
+// compareNode 比较运算
+type compareNode struct {
+	op          string
+	left, right conditionNode
+}
+
+// parseCondition 解析条件表达式
+func parseCondition(expr string) (conditionNode, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &conditionParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("表达式存在多余内容: %s", p.tokens[p.pos].text)
+	}
+
+	return node, nil
+}
+
+// parseStepRef 解析形如 steps.<id>.output 的引用
+func parseStepRef(text string) (*stepRef, error) {
+	parts := strings.Split(text, ".")
+	if len(parts) < 3 || parts[0] != "steps" || parts[1] == "" {
+		return nil, fmt.Errorf("无效的步骤引用: %s，应为 steps.<id>.output 或 steps.<id>.json.<path>", text)
+	}
+
+	ref := &stepRef{StepID: parts[1]}
+	switch parts[2] {
+	case "output":
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("无效的步骤引用: %s，output后不能再跟路径", text)
+		}
+	case "json":
+		ref.JSON = true
+		ref.Path = parts[3:]
+		for _, p := range ref.Path {
+			if p == "" {
+				return nil, fmt.Errorf("无效的步骤引用: %s，路径不能为空", text)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("无效的步骤引用: %s，未知的字段 %s", text, parts[2])
+	}
+
+	return ref, nil
+}
+
+// collectRefs 收集表达式中引用的步骤ID
+func collectRefs(node conditionNode) []string {
+	switch n := node.(type) {
+	case *stepRef:
+		return []string{n.StepID}
+	case *notNode:
+		return collectRefs(n.operand)
+	case *logicalNode:
+		return append(collectRefs(n.left), collectRefs(n.right)...)
+	case *compareNode:
+		return append(collectRefs(n.left), collectRefs(n.right)...)
+	default:
+		return nil
+	}
+}
+
+// evalCondition 求值条件表达式并转换为布尔值
+func evalCondition(node conditionNode, results map[string]string) (bool, error) {
+	value, err := node.eval(results)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+func (r *stepRef) eval(results map[string]string) (interface{}, error) {
+	output, ok := results[r.StepID]
+	if !ok {
+		// 被跳过或尚未执行的步骤视为空值
+		return nil, nil
+	}
+
+	if !r.JSON {
+		return output, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(output), &value); err != nil {
+		jsonStr := extractJSONFromResponse(output)
+		if jsonStr == "" || json.Unmarshal([]byte(jsonStr), &value) != nil {
+			return nil, fmt.Errorf("步骤 %s的结果不是有效的JSON", r.StepID)
+		}
+	}
+
+	for _, key := range r.Path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, nil
+			}
+			value = v[idx]
+		default:
+			return nil, nil
+		}
+	}
+
+	return value, nil
+}
+
+func (n *literalNode) eval(results map[string]string) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *notNode) eval(results map[string]string) (interface{}, error) {
+	value, err := evalCondition(n.operand, results)
+	if err != nil {
+		return nil, err
+	}
+	return !value, nil
+}
+
+func (n *logicalNode) eval(results map[string]string) (interface{}, error) {
+	left, err := evalCondition(n.left, results)
+	if err != nil {
+		return nil, err
+	}
+
+	// 短路求值
+	if n.op == "&&" && !left {
+		return false, nil
+	}
+	if n.op == "||" && left {
+		return true, nil
+	}
+
+	return evalCondition(n.right, results)
+}
+
+func (n *compareNode) eval(results map[string]string) (interface{}, error) {
+	left, err := n.left.eval(results)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(results)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "contains":
+		if list, ok := left.([]interface{}); ok {
+			for _, item := range list {
+				if valueString(item) == valueString(right) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return strings.Contains(valueString(left), valueString(right)), nil
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	}
+
+	l, lok := toNumber(left)
+	r, rok := toNumber(right)
+	if !lok || !rok {
+		return false, nil
+	}
+
+	switch n.op {
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	}
+
+	return nil, fmt.Errorf("未知的运算符: %s", n.op)
+}
+
+// valuesEqual 比较两个值，数字按数值比较，其余按字符串比较
+func valuesEqual(a, b interface{}) bool {
+	if an, ok := toNumber(a); ok {
+		if bn, ok := toNumber(b); ok {
+			return an == bn
+		}
+	}
+	return valueString(a) == valueString(b)
+}
+
+// toNumber 尝试将值转换为数字
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// valueString 将值转换为字符串用于比较
+func valueString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case float64, bool:
+		return fmt.Sprintf("%v", s)
+	default:
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+}
+
+// truthy 判断值的真假
+func truthy(v interface{}) bool {
+	switch b := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return b
+	case string:
+		return strings.TrimSpace(b) != ""
+	case float64:
+		return b != 0
+	case []interface{}:
+		return len(b) > 0
+	case map[string]interface{}:
+		return len(b) > 0
+	default:
+		return true
+	}
+}
+
+// conditionToken 词法单元
+type conditionToken struct {
+	kind string // ident/string/number/op
+	text string
+}
+
+// tokenizeCondition 将表达式切分为词法单元
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	tokens := []conditionToken{}
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			quote := r
+			j := i + 1
+			var sb strings.Builder
+			for j < len(runes) && runes[j] != quote {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("字符串缺少结束引号")
+			}
+			tokens = append(tokens, conditionToken{kind: "string", text: sb.String()})
+			i = j + 1
+		case strings.ContainsRune("=!<>&|", r):
+			j := i + 1
+			if j < len(runes) && strings.ContainsRune("=&|", runes[j]) {
+				j++
+			}
+			op := string(runes[i:j])
+			switch op {
+			case "==", "!=", ">", ">=", "<", "<=", "&&", "||", "!":
+			default:
+				return nil, fmt.Errorf("无效的运算符: %s", op)
+			}
+			tokens = append(tokens, conditionToken{kind: "op", text: op})
+			i = j
+		case r == '(' || r == ')':
+			tokens = append(tokens, conditionToken{kind: "op", text: string(r)})
+			i++
+		case r == '-' || unicode.IsDigit(r):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, conditionToken{kind: "number", text: string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || strings.ContainsRune("_.-", runes[j])) {
+				j++
+			}
+			tokens = append(tokens, conditionToken{kind: "ident", text: string(runes[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("无效的字符: %c", r)
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("表达式不能为空")
+	}
+
+	return tokens, nil
+}
+
+// conditionParser 递归下降解析器
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+func (p *conditionParser) peek() *conditionToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.text == "||"; t = p.peek() {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.text == "&&"; t = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseUnary() (conditionNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("表达式意外结束")
+	}
+
+	switch {
+	case t.kind == "op" && t.text == "!":
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	case t.kind == "op" && t.text == "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.text != ")" {
+			return nil, fmt.Errorf("缺少右括号")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *conditionParser) parseComparison() (conditionNode, error) {
+	t := p.peek()
+	if t.kind != "ident" || !strings.HasPrefix(t.text, "steps.") {
+		return nil, fmt.Errorf("比较的左侧必须是步骤引用，实际为: %s", t.text)
+	}
+	p.pos++
+
+	ref, err := parseStepRef(t.text)
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	if op == nil || !isCompareOp(op) {
+		// 单独的引用按真假值判断
+		return ref, nil
+	}
+	p.pos++
+
+	right, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+
+	return &compareNode{op: op.text, left: ref, right: right}, nil
+}
+
+func (p *conditionParser) parseLiteral() (conditionNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("运算符后缺少值")
+	}
+	p.pos++
+
+	switch t.kind {
+	case "string":
+		return &literalNode{value: t.text}, nil
+	case "number":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的数字: %s", t.text)
+		}
+		return &literalNode{value: f}, nil
+	case "ident":
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("无效的值: %s，字符串需要加引号", t.text)
+}
+
+// isCompareOp 是否为比较运算符
+func isCompareOp(t *conditionToken) bool {
+	if t.kind == "ident" {
+		return t.text == "contains"
+	}
+	switch t.text {
+	case "==", "!=", ">", ">=", "<", "<=":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 规划模式
+const (
+	PlannerSingle          = "single"
+	PlannerSelfConsistency = "self_consistency"
+)
+
+// 候选计划的选择方式
+const (
+	SelectionVote  = "vote"
+	SelectionJudge = "judge"
+)
+
+// maxPlanSamples 自洽规划的最大采样数
+const maxPlanSamples = 10
+
+// PlannerConfig 规划器配置
+type PlannerConfig struct {
+	Mode      string `json:"mode"`      // single/self_consistency
+	Samples   int    `json:"samples"`   // 自洽规划的采样数N
+	Selection string `json:"selection"` // vote/judge
+}
+
+// selfConsistencyEnabled 是否启用自洽规划
+func (c PlannerConfig) selfConsistencyEnabled() bool {
+	return c.Mode == PlannerSelfConsistency && c.Samples > 1
+}
+
+// planCandidate 候选计划
+type planCandidate struct {
+	Index       int            `json:"index"`
+	Plan        *ExecutionPlan `json:"plan,omitempty"`
+	Fingerprint string         `json:"fingerprint,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// thinkSelfConsistent 并行采样N个候选计划并从中选出一个
+func (a *Agent) thinkSelfConsistent(ctx context.Context, query string, iteration int, prompt string) (*ExecutionPlan, error) {
+	samples := a.config.Planner.Samples
+	if samples > maxPlanSamples {
+		samples = maxPlanSamples
+	}
+
+	candidates := make([]*planCandidate, samples)
+	var wg sync.WaitGroup
+	for i := 0; i < samples; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			candidates[i] = a.samplePlan(ctx, query, prompt, i)
+		}(i)
+	}
+	wg.Wait()
+
+	valid := []*planCandidate{}
+	for _, c := range candidates {
+		if c.Error == "" {
+			valid = append(valid, c)
+		} else {
+			a.trace.Add(iteration, "plan_candidate_invalid", fmt.Sprintf("候选计划 %d无效", c.Index+1), c)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("全部 %d个候选计划均无效", samples)
+	}
+
+	var chosen *planCandidate
+	if a.config.Planner.Selection == SelectionJudge && len(valid) > 1 {
+		judged, err := a.judgePlans(ctx, query, valid)
+		if err != nil {
+			a.logger.Warnf("模型评判候选计划失败，改为投票: %v", err)
+		} else {
+			chosen = judged
+		}
+	}
+	if chosen == nil {
+		chosen = votePlans(valid)
+	}
+
+	rejected := []*planCandidate{}
+	for _, c := range valid {
+		if c != chosen {
+			rejected = append(rejected, c)
+		}
+	}
+	a.trace.Add(iteration, "plan_candidates_rejected",
+		fmt.Sprintf("选中候选计划 %d，否决 %d个", chosen.Index+1, len(rejected)), rejected)
+	a.sendEvent(fmt.Sprintf("plan_candidates_%d", iteration), StatusPlanning,
+		fmt.Sprintf("从 %d个候选计划中选中第 %d个", len(valid), chosen.Index+1),
+		map[string]interface{}{
+			"chosen":   chosen.Index,
+			"rejected": rejected,
+		})
+
+	return chosen.Plan, nil
+}
+
+// samplePlan 采样并验证一个候选计划
+func (a *Agent) samplePlan(ctx context.Context, query, prompt string, index int) *planCandidate {
+	candidate := &planCandidate{Index: index}
+
+	response, err := a.generateWith(ctx, prompt, a.planOptions())
+	if err != nil {
+		candidate.Error = fmt.Sprintf("模型生成失败: %v", err)
+		return candidate
+	}
+
+	plan, err := ParseExecutionPlan(response)
+	if err != nil {
+		candidate.Error = fmt.Sprintf("解析执行计划失败: %v", err)
+		return candidate
+	}
+
+	if err := a.validatePlan(plan, query); err != nil {
+		candidate.Error = fmt.Sprintf("执行计划验证失败: %v", err)
+		return candidate
+	}
+
+	candidate.Plan = plan
+	candidate.Fingerprint = planFingerprint(plan)
+	return candidate
+}
+
+// votePlans 按规范化动作序列投票，票数相同时取最早的候选
+func votePlans(candidates []*planCandidate) *planCandidate {
+	votes := map[string]int{}
+	for _, c := range candidates {
+		votes[c.Fingerprint]++
+	}
+
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if votes[c.Fingerprint] > votes[best.Fingerprint] {
+			best = c
+		}
+	}
+	return best
+}
+
+// judgePlans 请模型评判哪个候选计划最好
+func (a *Agent) judgePlans(ctx context.Context, query string, candidates []*planCandidate) (*planCandidate, error) {
+	var sb strings.Builder
+	for i, c := range candidates {
+		data, err := json.Marshal(c.Plan)
+		if err != nil {
+			return nil, fmt.Errorf("序列化候选计划失败: %w", err)
+		}
+		fmt.Fprintf(&sb, "候选 %d:\n%s\n\n", i+1, data)
+	}
+
+	prompt := fmt.Sprintf(`你是一个严格的评审，需要从多个候选执行计划中选出最能解决用户问题的一个。
+
+用户问题: %s
+
+%s请只返回最佳候选的编号（1-%d），不要其他说明。`, query, sb.String(), len(candidates))
+
+	response, err := a.generate(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("模型生成失败: %w", err)
+	}
+
+	choice, err := strconv.Atoi(strings.Trim(strings.TrimSpace(response), "候选 .。"))
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return nil, fmt.Errorf("无效的评判结果: %q", response)
+	}
+
+	return candidates[choice-1], nil
+}
+
+// planFingerprint 计划的规范化动作序列，如 "search_tool:calculator>reason"
+func planFingerprint(plan *ExecutionPlan) string {
+	parts := make([]string, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		part := strings.ToLower(strings.TrimSpace(step.Action))
+		if toolName, ok := step.Parameters["tool_name"].(string); ok {
+			part += ":" + strings.ToLower(strings.TrimSpace(toolName))
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ">")
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"aigent/internal/model"
+	"aigent/internal/rag"
+	"aigent/internal/tool"
+)
+
+// DryRunResult 试运行规划的结果
+type DryRunResult struct {
+	Plan       *ExecutionPlan    `json:"plan"`
+	Warnings   []string          `json:"warnings"`
+	Tools      []ResolvedTool    `json:"tools"`
+	Simulation *SimulationResult `json:"simulation,omitempty"`
+}
+
+// ResolvedTool 计划中用到的工具及其Schema
+type ResolvedTool struct {
+	Name   string                 `json:"name"`
+	Steps  []string               `json:"steps"`
+	Schema map[string]interface{} `json:"schema,omitempty"`
+}
+
+// SimulationResult 使用模拟工具和模拟模型执行计划的结果
+type SimulationResult struct {
+	Result         string        `json:"result"`
+	ShouldContinue bool          `json:"should_continue"`
+	Observations   []Observation `json:"observations"`
+}
+
+// DryRun 只制定并验证执行计划，不调用真实工具
+//
+// 验证问题作为警告返回而不是错误；simulate为true时使用模拟工具、模拟检索和模拟模型执行一次计划，
+// 推理步骤和错误恢复不调用真实模型，只有制定计划时调用一次模型。
+func (a *Agent) DryRun(ctx context.Context, query string, simulate bool) (*DryRunResult, error) {
+	if a.model == nil {
+		return nil, fmt.Errorf("model not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.config.Timeout)
+	defer cancel()
+
+	prompt := a.buildThinkPrompt(query, 1)
+	prompt, err := a.runBeforeThink(ctx, query, 1, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("思考前钩子失败: %w", err)
+	}
+
+	response, err := a.generateWith(ctx, prompt, a.planOptions())
+	if err != nil {
+		return nil, fmt.Errorf("模型生成失败: %w", err)
+	}
+
+	plan, err := ParseExecutionPlan(response)
+	if err != nil {
+		return nil, fmt.Errorf("解析执行计划失败: %w", err)
+	}
+
+	if err := a.runAfterThink(ctx, plan); err != nil {
+		return nil, fmt.Errorf("思考后钩子失败: %w", err)
+	}
+
+	result := &DryRunResult{
+		Plan:     plan,
+		Warnings: a.planWarnings(plan, query),
+		Tools:    a.resolveTools(plan),
+	}
+
+	if simulate {
+		sim, err := a.simulate(ctx, plan)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("模拟执行失败: %v", err))
+		}
+		result.Simulation = sim
+	}
+
+	return result, nil
+}
+
+// planWarnings 收集计划的全部验证问题
+func (a *Agent) planWarnings(plan *ExecutionPlan, query string) []string {
+	warnings := []string{}
+	for i, step := range plan.Steps {
+		if err := a.validateStep(i, step); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+
+	if !a.isPlanRelevant(plan, query) {
+		warnings = append(warnings, "执行计划与用户查询的相关性不足")
+	}
+
+	return warnings
+}
+
+// resolveTools 解析计划中用到的工具及其Schema
+func (a *Agent) resolveTools(plan *ExecutionPlan) []ResolvedTool {
+	tools := []ResolvedTool{}
+	index := map[string]int{}
+
+	for _, step := range plan.Steps {
+		s := step
+		if s.Action == "foreach" && s.Foreach != nil && s.Foreach.Step != nil {
+			s = s.Foreach.Step
+		}
+		if s.Action != "search_tool" {
+			continue
+		}
+
+		name, _ := s.Parameters["tool_name"].(string)
+		if name == "" {
+			continue
+		}
+
+		i, exists := index[name]
+		if !exists {
+			resolved := ResolvedTool{Name: name}
+			if a.toolManager != nil {
+				if schema, err := a.toolManager.GetToolSchema(name); err == nil {
+					resolved.Schema = schema
+				}
+			}
+			tools = append(tools, resolved)
+			i = len(tools) - 1
+			index[name] = i
+		}
+		tools[i].Steps = append(tools[i].Steps, step.ID)
+	}
+
+	return tools
+}
+
+// simulate 在Agent副本上使用模拟工具和模拟模型执行一次计划
+func (a *Agent) simulate(ctx context.Context, plan *ExecutionPlan) (*SimulationResult, error) {
+	sim := *a
+	sim.model = &simulatedModel{config: a.model.Config()}
+	sim.toolManager = tool.NewMockManager(a.toolManager)
+	sim.ragEngine = nil
+	sim.simulated = true
+	sim.observations = &observationLog{}
+	sim.sseBroker = nil
+	sim.hooks = nil // 模拟的步骤不触发审计、指标等用户钩子
+
+	result, shouldContinue, err := sim.execute(ctx, plan)
+	return &SimulationResult{
+		Result:         result,
+		ShouldContinue: shouldContinue,
+		Observations:   sim.observations.list(),
+	}, err
+}
+
+// simulatedRAGResults 模拟模式下的检索结果
+func simulatedRAGResults(query string) []rag.SearchResult {
+	return []rag.SearchResult{
+		{
+			Document: rag.Document{
+				ID:      "simulated",
+				Content: fmt.Sprintf("[模拟] 关于 '%s' 的检索结果", query),
+			},
+			Similarity: 1,
+		},
+	}
+}
+
+// simulatedModel 模拟模式下代替真实模型，返回模拟结果而不产生调用费用
+type simulatedModel struct {
+	config model.ModelConfig
+}
+
+// Generate 返回模拟结果
+func (m *simulatedModel) Generate(ctx context.Context, prompt string) (string, error) {
+	return simulatedResponse(prompt), nil
+}
+
+// Chat 返回针对最后一条消息的模拟结果
+func (m *simulatedModel) Chat(ctx context.Context, messages []model.Message, opts model.ChatOptions) (string, error) {
+	if len(messages) == 0 {
+		return simulatedResponse(""), nil
+	}
+	return simulatedResponse(messages[len(messages)-1].Content), nil
+}
+
+// SupportsVision 模拟模型接受图片输入
+func (m *simulatedModel) SupportsVision() bool {
+	return true
+}
+
+// Name 模型名称
+func (m *simulatedModel) Name() string {
+	return m.config.Name
+}
+
+// Config 模型配置
+func (m *simulatedModel) Config() model.ModelConfig {
+	return m.config
+}
+
+// simulatedResponse 模拟模型的输出，附带截断后的提示词便于核对
+func simulatedResponse(prompt string) string {
+	const maxRunes = 200
+	runes := []rune(prompt)
+	if len(runes) > maxRunes {
+		prompt = string(runes[:maxRunes]) + "..."
+	}
+	return fmt.Sprintf("[模拟] 模型的回答，提示词: %s", prompt)
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// executeForeach 对列表中的每一项执行子步骤，并发数受限
+//
+// 结果为子步骤输出组成的JSON数组，后续步骤可通过 steps.<id>.json.<n> 引用。
+func (a *Agent) executeForeach(ctx context.Context, step *PlanStep, results map[string]string) (string, error) {
+	spec := step.Foreach
+	if spec == nil || spec.Step == nil {
+		return "", fmt.Errorf("foreach步骤缺少子步骤")
+	}
+
+	ref := spec.items
+	if ref == nil {
+		parsed, err := parseStepRef(spec.Items)
+		if err != nil {
+			return "", err
+		}
+		ref = parsed
+	}
+
+	value, err := ref.eval(results)
+	if err != nil {
+		return "", fmt.Errorf("解析循环列表失败: %w", err)
+	}
+
+	items := foreachItems(value)
+	if maxItems := spec.MaxItems; maxItems > 0 && len(items) > maxItems {
+		a.logger.Warnf("循环列表共 %d项，超过上限 %d，仅处理前 %d项", len(items), maxItems, maxItems)
+		items = items[:maxItems]
+	}
+
+	concurrency := spec.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	outputs := make([]string, len(items))
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, item string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			sub := substituteItem(step.ID, spec.Step, item, i)
+			a.sendEvent(fmt.Sprintf("%s_item_%d_start", step.ID, i+1), StatusExecuting,
+				fmt.Sprintf("循环第 %d项: %s", i+1, sub.Action), sub)
+
+			outputs[i], errs[i] = a.executeStep(ctx, sub)
+		}(i, item)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return "", fmt.Errorf("循环第 %d项执行失败: %w", i+1, err)
+		}
+	}
+
+	data, err := json.Marshal(outputs)
+	if err != nil {
+		return "", fmt.Errorf("序列化循环结果失败: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// foreachItems 将引用的值转换为列表：JSON数组逐项展开，字符串按JSON数组或非空行拆分
+func foreachItems(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, valueString(item))
+		}
+		return items
+	case string:
+		var list []interface{}
+		if err := json.Unmarshal([]byte(v), &list); err == nil {
+			return foreachItems(list)
+		}
+		items := []string{}
+		for _, line := range strings.Split(v, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				items = append(items, line)
+			}
+		}
+		return items
+	default:
+		return []string{valueString(v)}
+	}
+}
+
+// substituteItem 复制子步骤并替换字符串参数中的{{item}}和{{index}}，子步骤ID为<循环步骤ID>_<序号>
+func substituteItem(parentID string, step *PlanStep, item string, index int) *PlanStep {
+	replacer := strings.NewReplacer("{{item}}", item, "{{index}}", fmt.Sprintf("%d", index))
+
+	params := make(map[string]interface{}, len(step.Parameters))
+	for k, v := range step.Parameters {
+		if s, ok := v.(string); ok {
+			params[k] = replacer.Replace(s)
+		} else {
+			params[k] = v
+		}
+	}
+
+	return &PlanStep{
+		ID:         fmt.Sprintf("%s_%d", parentID, index),
+		Action:     step.Action,
+		Parameters: params,
+	}
+}
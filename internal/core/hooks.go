@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrSkipStep 由BeforeStep返回时跳过当前步骤（否决执行）
+var ErrSkipStep = errors.New("步骤已被钩子否决")
+
+// ThinkInput 思考阶段的输入，钩子可以修改Prompt
+type ThinkInput struct {
+	Query     string
+	Iteration int
+	Prompt    string
+}
+
+// StepInput 步骤执行前的输入，钩子可以修改Step
+type StepInput struct {
+	Index int
+	Step  *PlanStep
+}
+
+// StepOutput 步骤执行后的输出，钩子可以修改Result
+type StepOutput struct {
+	Index  int
+	Step   *PlanStep
+	Result string
+}
+
+// Hooks Agent生命周期钩子
+//
+// 钩子按注册顺序调用。Before*/After*返回错误会中止当前阶段，
+// BeforeStep返回ErrSkipStep时跳过该步骤而不视为失败。
+type Hooks interface {
+	// BeforeThink 在调用模型制定计划前调用，可修改提示词
+	BeforeThink(ctx context.Context, in *ThinkInput) error
+
+	// AfterThink 在计划解析并验证后调用，可修改计划
+	AfterThink(ctx context.Context, plan *ExecutionPlan) error
+
+	// BeforeStep 在步骤执行前调用，可修改或否决步骤
+	BeforeStep(ctx context.Context, in *StepInput) error
+
+	// AfterStep 在步骤执行后调用，可修改步骤结果
+	AfterStep(ctx context.Context, out *StepOutput) error
+
+	// OnError 在执行失败时调用
+	OnError(ctx context.Context, err error)
+
+	// OnComplete 在执行成功时调用，可修改最终结果
+	OnComplete(ctx context.Context, result *string)
+}
+
+// BaseHooks 空实现，嵌入后只需覆盖关心的方法
+type BaseHooks struct{}
+
+// BeforeThink 空实现
+func (BaseHooks) BeforeThink(ctx context.Context, in *ThinkInput) error { return nil }
+
+// AfterThink 空实现
+func (BaseHooks) AfterThink(ctx context.Context, plan *ExecutionPlan) error { return nil }
+
+// BeforeStep 空实现
+func (BaseHooks) BeforeStep(ctx context.Context, in *StepInput) error { return nil }
+
+// AfterStep 空实现
+func (BaseHooks) AfterStep(ctx context.Context, out *StepOutput) error { return nil }
+
+// OnError 空实现
+func (BaseHooks) OnError(ctx context.Context, err error) {}
+
+// OnComplete 空实现
+func (BaseHooks) OnComplete(ctx context.Context, result *string) {}
+
+// WithHooks 注册生命周期钩子
+func (a *Agent) WithHooks(hooks ...Hooks) *Agent {
+	a.hooks = append(a.hooks, hooks...)
+	return a
+}
+
+// runBeforeThink 依次调用BeforeThink钩子，返回可能被修改的提示词
+func (a *Agent) runBeforeThink(ctx context.Context, query string, iteration int, prompt string) (string, error) {
+	in := &ThinkInput{Query: query, Iteration: iteration, Prompt: prompt}
+	for _, h := range a.hooks {
+		if err := h.BeforeThink(ctx, in); err != nil {
+			return "", err
+		}
+	}
+	return in.Prompt, nil
+}
+
+// runAfterThink 依次调用AfterThink钩子
+func (a *Agent) runAfterThink(ctx context.Context, plan *ExecutionPlan) error {
+	for _, h := range a.hooks {
+		if err := h.AfterThink(ctx, plan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBeforeStep 依次调用BeforeStep钩子，返回可能被替换的步骤；钩子把步骤置空视为错误，
+// 需要跳过步骤时应返回ErrSkipStep
+func (a *Agent) runBeforeStep(ctx context.Context, index int, step *PlanStep) (*PlanStep, error) {
+	in := &StepInput{Index: index, Step: step}
+	for _, h := range a.hooks {
+		if err := h.BeforeStep(ctx, in); err != nil {
+			return nil, err
+		}
+		if in.Step == nil {
+			return nil, fmt.Errorf("钩子返回了空步骤，跳过步骤请返回ErrSkipStep")
+		}
+	}
+	return in.Step, nil
+}
+
+// runAfterStep 依次调用AfterStep钩子，返回可能被修改的结果
+func (a *Agent) runAfterStep(ctx context.Context, index int, step *PlanStep, result string) (string, error) {
+	out := &StepOutput{Index: index, Step: step, Result: result}
+	for _, h := range a.hooks {
+		if err := h.AfterStep(ctx, out); err != nil {
+			return "", err
+		}
+	}
+	return out.Result, nil
+}
+
+// runOnError 依次调用OnError钩子
+func (a *Agent) runOnError(ctx context.Context, err error) {
+	for _, h := range a.hooks {
+		h.OnError(ctx, err)
+	}
+}
+
+// runOnComplete 依次调用OnComplete钩子
+func (a *Agent) runOnComplete(ctx context.Context, result *string) {
+	for _, h := range a.hooks {
+		h.OnComplete(ctx, result)
+	}
+}
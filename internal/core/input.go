@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNoPendingInput 运行当前没有等待中的问题
+var ErrNoPendingInput = errors.New("该运行没有等待中的问题")
+
+// defaultAskUserTimeout 等待用户回答的默认超时
+const defaultAskUserTimeout = 5 * time.Minute
+
+// maxAnswerHeadroom 等待用户回答时为后续步骤和合成最终答案预留的最长时间
+const maxAnswerHeadroom = 30 * time.Second
+
+// InputBroker 管理等待用户输入而挂起的运行
+type InputBroker struct {
+	pending map[string]chan string
+	mu      sync.Mutex
+}
+
+// NewInputBroker 创建用户输入代理
+func NewInputBroker() *InputBroker {
+	return &InputBroker{
+		pending: make(map[string]chan string),
+	}
+}
+
+// Submit 提交用户对某个运行的回答，恢复挂起的运行
+func (b *InputBroker) Submit(runID, answer string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch, exists := b.pending[runID]
+	if !exists {
+		return ErrNoPendingInput
+	}
+
+	delete(b.pending, runID)
+	ch <- answer
+	return nil
+}
+
+// Pending 返回正在等待输入的运行ID
+func (b *InputBroker) Pending() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ids := make([]string, 0, len(b.pending))
+	for id := range b.pending {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// wait 登记等待并返回回答通道，cancel用于超时后取消登记
+func (b *InputBroker) wait(runID string) (<-chan string, func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.pending[runID]; exists {
+		return nil, nil, fmt.Errorf("运行 %s已有等待中的问题", runID)
+	}
+
+	ch := make(chan string, 1)
+	b.pending[runID] = ch
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.pending[runID] == ch {
+			delete(b.pending, runID)
+		}
+	}
+
+	return ch, cancel, nil
+}
+
+// GlobalInputBroker 全局用户输入代理
+var GlobalInputBroker = NewInputBroker()
+
+// WithRunID 设置运行ID，客户端通过它提交回答
+func (a *Agent) WithRunID(id string) *Agent {
+	a.runID = id
+	return a
+}
+
+// WithInputBroker 设置用户输入代理
+func (a *Agent) WithInputBroker(b *InputBroker) *Agent {
+	a.inputs = b
+	return a
+}
+
+// RunID 返回当前运行ID
+func (a *Agent) RunID() string {
+	return a.runID
+}
+
+// executeAskUserStep 向用户提问并挂起运行，直到收到回答或超时
+func (a *Agent) executeAskUserStep(ctx context.Context, step *PlanStep) (string, error) {
+	question, _ := step.Parameters["question"].(string)
+	if question == "" {
+		return "", fmt.Errorf("提问步骤缺少question参数")
+	}
+	defaultAnswer, _ := step.Parameters["default"].(string)
+
+	timeout := defaultAskUserTimeout
+	if secs, ok := step.Parameters["timeout_seconds"].(float64); ok && secs > 0 {
+		timeout = time.Duration(secs) * time.Second
+	}
+	timeout = capAskUserTimeout(ctx, timeout)
+
+	// 模拟模式下不挂起，直接使用默认值
+	if a.simulated {
+		return fmt.Sprintf("问题: %s\n[模拟] 用户回答: %s", question, defaultAnswer), nil
+	}
+
+	answers, cancel, err := a.inputs.wait(a.runID)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+
+	a.sendEvent("input_required", StatusWaitingInput, question, nil)
+	if a.sseBroker != nil {
+		a.sseBroker.Broadcast("input_required", map[string]interface{}{
+			"run_id":          a.runID,
+			"question":        question,
+			"default":         defaultAnswer,
+			"timeout_seconds": int(timeout.Seconds()),
+		})
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case answer := <-answers:
+		a.sendEvent("input_received", StatusExecuting, "已收到用户回答", answer)
+		return fmt.Sprintf("问题: %s\n用户回答: %s", question, answer), nil
+	case <-timer.C:
+		a.sendEvent("input_timeout", StatusExecuting, "等待用户回答超时，使用默认值", defaultAnswer)
+		if defaultAnswer == "" {
+			return fmt.Sprintf("问题: %s\n用户未在规定时间内回答，且没有默认值", question), nil
+		}
+		return fmt.Sprintf("问题: %s\n用户未回答，使用默认值: %s", question, defaultAnswer), nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("等待用户回答时取消: %w", ctx.Err())
+	}
+}
+
+// capAskUserTimeout 把等待时间限制在运行截止时间之前，并预留剩余时间的1/5（最多maxAnswerHeadroom）
+// 供后续步骤和合成最终答案使用，保证超时后能以默认值继续运行
+func capAskUserTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return timeout
+	}
+
+	remaining := time.Until(deadline)
+	headroom := remaining / 5
+	if headroom > maxAnswerHeadroom {
+		headroom = maxAnswerHeadroom
+	}
+	if limit := remaining - headroom; limit < timeout {
+		timeout = limit
+	}
+	if timeout < 0 {
+		timeout = 0
+	}
+	return timeout
+}
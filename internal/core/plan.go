@@ -13,11 +13,34 @@ type ExecutionPlan struct {
 
 // PlanStep计划步骤
 type PlanStep struct {
+	ID            string                 `json:"id,omitempty"`
 	Action        string                 `json:"action"`
 	Parameters    map[string]interface{} `json:"parameters"`
 	ShouldContinue bool                  `json:"should_continue"`
+	If            string                 `json:"if,omitempty"`      // 条件表达式，为假时跳过该步骤
+	Foreach       *ForeachSpec           `json:"foreach,omitempty"` // action为foreach时的循环定义
+
+	condition    conditionNode
+	conditionSrc string
+}
+
+// ForeachSpec 对前序步骤产生的列表逐项执行子步骤
+type ForeachSpec struct {
+	Items       string    `json:"items"`       // 列表引用，如 steps.search.json.items
+	Step        *PlanStep `json:"step"`        // 子步骤，字符串参数中的{{item}}和{{index}}会被替换
+	MaxItems    int       `json:"max_items"`   // 最多处理的项数
+	Concurrency int       `json:"concurrency"` // 并发数
+
+	items *stepRef
 }
 
+// 循环限制
+const (
+	defaultForeachItems   = 20
+	maxForeachItems       = 100
+	maxForeachConcurrency = 8
+)
+
 // ParseExecutionPlan解析执行计划JSON
 func ParseExecutionPlan(response string) (*ExecutionPlan, error) {
 	var plan ExecutionPlan
@@ -112,36 +135,162 @@ func validatePlan(plan *ExecutionPlan) error {
 		return fmt.Errorf("执行计划缺少步骤")
 	}
 	
+	// 已定义的步骤ID，条件只能引用之前的步骤
+	defined := map[string]bool{}
+	
 	for i, step := range plan.Steps {
-		if step.Action == "" {
-			return fmt.Errorf("步骤 %d缺少执行动作", i+1)
+		if step == nil {
+			return fmt.Errorf("步骤 %d不能为空", i+1)
 		}
 		
-		if step.Parameters == nil {
-			return fmt.Errorf("步骤 %d缺少参数", i+1)
+		if step.ID == "" {
+			step.ID = fmt.Sprintf("step_%d", i+1)
+		}
+		if defined[step.ID] {
+			return fmt.Errorf("步骤 %d的ID %s重复", i+1, step.ID)
 		}
 		
-		//验证特定动作的必需参数
-		switch step.Action {
-		case "search_tool":
-			if _, ok := step.Parameters["tool_name"]; !ok {
-				return fmt.Errorf("工具调用步骤缺少tool_name参数")
-			}
-			if _, ok := step.Parameters["input"]; !ok {
-				return fmt.Errorf("工具调用步骤缺少input参数")
+		if step.If != "" {
+			cond, err := parseCondition(step.If)
+			if err != nil {
+				return fmt.Errorf("步骤 %d的条件表达式无效: %w", i+1, err)
 			}
-		case "rag_search":
-			if _, ok := step.Parameters["query"]; !ok {
-				return fmt.Errorf("RAG检索步骤缺少query参数")
+			for _, id := range collectRefs(cond) {
+				if !defined[id] {
+					return fmt.Errorf("步骤 %d的条件引用了未定义或之后的步骤: %s", i+1, id)
+				}
 			}
-		case "reason":
-			if _, ok := step.Parameters["prompt"]; !ok {
-				return fmt.Errorf("推理步骤缺少prompt参数")
+			step.condition, step.conditionSrc = cond, step.If
+		}
+		
+		if step.Action == "foreach" {
+			if err := validateForeach(step, defined); err != nil {
+				return fmt.Errorf("步骤 %d的循环无效: %w", i+1, err)
 			}
-		default:
-			return fmt.Errorf("未知的执行动作: %s", step.Action)
+			defined[step.ID] = true
+			continue
 		}
+		
+		if err := validateStepAction(step); err != nil {
+			return fmt.Errorf("步骤 %d: %w", i+1, err)
+		}
+		
+		defined[step.ID] = true
+	}
+	
+	return nil
+}
+
+// validateForeach 验证循环步骤的列表引用、子步骤和循环限制
+func validateForeach(step *PlanStep, defined map[string]bool) error {
+	spec := step.Foreach
+	if spec == nil {
+		return fmt.Errorf("foreach步骤缺少foreach定义")
+	}
+	
+	ref, err := parseStepRef(spec.Items)
+	if err != nil {
+		return err
+	}
+	if !defined[ref.StepID] {
+		return fmt.Errorf("items引用了未定义或之后的步骤: %s", ref.StepID)
+	}
+	spec.items = ref
+	
+	if spec.MaxItems == 0 {
+		spec.MaxItems = defaultForeachItems
+	}
+	if spec.MaxItems < 0 || spec.MaxItems > maxForeachItems {
+		return fmt.Errorf("max_items必须在1-%d之间", maxForeachItems)
+	}
+	
+	if spec.Concurrency == 0 {
+		spec.Concurrency = 1
+	}
+	if spec.Concurrency < 0 || spec.Concurrency > maxForeachConcurrency {
+		return fmt.Errorf("concurrency必须在1-%d之间", maxForeachConcurrency)
 	}
 	
+	sub := spec.Step
+	if sub == nil {
+		return fmt.Errorf("foreach缺少子步骤")
+	}
+	if sub.Action == "foreach" || sub.Foreach != nil {
+		return fmt.Errorf("不支持嵌套的foreach")
+	}
+	if sub.If != "" {
+		return fmt.Errorf("子步骤不支持if条件")
+	}
+	if step.Parameters == nil {
+		step.Parameters = map[string]interface{}{}
+	}
+	
+	return validateStepAction(sub)
+}
+
+// validateStepAction 验证单个步骤的动作和必需参数
+func validateStepAction(step *PlanStep) error {
+	if step.Action == "" {
+		return fmt.Errorf("缺少执行动作")
+	}
+	
+	if step.Parameters == nil {
+		return fmt.Errorf("缺少参数")
+	}
+	
+	//验证特定动作的必需参数
+	switch step.Action {
+	case "search_tool":
+		if err := requireString(step, "工具调用", "tool_name"); err != nil {
+			return err
+		}
+		return requireString(step, "工具调用", "input")
+	case "rag_search":
+		return requireString(step, "RAG检索", "query")
+	case "reason":
+		return requireString(step, "推理", "prompt")
+	case "ask_user":
+		return requireString(step, "提问", "question")
+	default:
+		return fmt.Errorf("未知的执行动作: %s", step.Action)
+	}
+}
+
+// requireString 检查步骤参数存在且为字符串，模型常把input等参数输出为JSON对象或数组
+func requireString(step *PlanStep, kind, key string) error {
+	value, exists := step.Parameters[key]
+	if !exists {
+		return fmt.Errorf("%s步骤缺少%s参数", kind, key)
+	}
+	if _, ok := value.(string); !ok {
+		return fmt.Errorf("%s步骤的%s参数必须是字符串", kind, key)
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// stringParam 读取步骤的字符串参数；钩子可能在验证之后修改参数，执行时再次检查类型
+func (s *PlanStep) stringParam(key string) (string, error) {
+	value, ok := s.Parameters[key].(string)
+	if !ok {
+		return "", fmt.Errorf("步骤 %s 的%s参数必须是字符串", s.ID, key)
+	}
+	return value, nil
+}
+
+// conditionMet 判断步骤的if条件是否满足，没有条件时总是满足
+func (s *PlanStep) conditionMet(results map[string]string) (bool, error) {
+	if s.If == "" {
+		return true, nil
+	}
+	
+	// 钩子可能在解析后修改了条件，此时重新编译
+	if s.condition == nil || s.conditionSrc != s.If {
+		cond, err := parseCondition(s.If)
+		if err != nil {
+			return false, err
+		}
+		s.condition, s.conditionSrc = cond, s.If
+	}
+	
+	return evalCondition(s.condition, results)
+}
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ReActStrategy 逐步执行Thought/Action/Observation的策略
+type ReActStrategy struct{}
+
+// Name 策略名称
+func (s *ReActStrategy) Name() string {
+	return StrategyReAct
+}
+
+// Run 执行ReAct循环，直到模型给出最终答案
+func (s *ReActStrategy) Run(ctx context.Context, a *Agent, query string) (string, error) {
+	scratchpad := []string{}
+
+	for iteration := 1; iteration <= a.config.MaxIterations; iteration++ {
+		a.sendEvent(fmt.Sprintf("think_%d", iteration), StatusThinking,
+			fmt.Sprintf("第 %d轮思考中...", iteration), nil)
+
+		prompt := a.buildReActPrompt(query, scratchpad)
+		prompt, err := a.runBeforeThink(ctx, query, iteration, prompt)
+		if err != nil {
+			return "", fmt.Errorf("思考前钩子失败: %w", err)
+		}
+
+		response, err := a.generate(ctx, prompt)
+		if err != nil {
+			return "", fmt.Errorf("模型生成失败: %w", err)
+		}
+
+		a.logger.Debugf("ReAct模型响应: %s", response)
+
+		turn := parseReActTurn(response)
+		if turn.FinalAnswer != "" {
+			return turn.FinalAnswer, nil
+		}
+
+		a.sendEvent(fmt.Sprintf("react_thought_%d", iteration), StatusPlanning, turn.Thought, turn)
+
+		observation := s.act(ctx, a, iteration, turn)
+		scratchpad = append(scratchpad, fmt.Sprintf("Thought: %s\nAction: %s\nAction Input: %s\nObservation: %s",
+			turn.Thought, turn.Action, turn.ActionInput, observation))
+
+		a.sendEvent(fmt.Sprintf("react_observation_%d", iteration), StatusExecuting,
+			fmt.Sprintf("第 %d轮观察结果", iteration), observation)
+	}
+
+	return "", fmt.Errorf("超过最大迭代次数 %d", a.config.MaxIterations)
+}
+
+// act 执行一个动作并返回观察结果，错误也作为观察结果反馈给模型
+func (s *ReActStrategy) act(ctx context.Context, a *Agent, iteration int, turn *reActTurn) string {
+	if turn.Action == "" {
+		return "错误: 响应中缺少Action或Final Answer，请按格式输出"
+	}
+
+	params := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(turn.ActionInput), &params); err != nil {
+		return fmt.Sprintf("错误: Action Input不是有效的JSON对象: %v", err)
+	}
+
+	plan := &ExecutionPlan{
+		Thought: turn.Thought,
+		Steps:   []*PlanStep{{Action: turn.Action, Parameters: params}},
+	}
+	if err := validatePlan(plan); err != nil {
+		return fmt.Sprintf("错误: %v", err)
+	}
+	if err := a.validateSteps(plan); err != nil {
+		return fmt.Sprintf("错误: %v", err)
+	}
+
+	step, err := a.runBeforeStep(ctx, iteration-1, plan.Steps[0])
+	if errors.Is(err, ErrSkipStep) {
+		return "该动作已被跳过"
+	}
+	if err != nil {
+		return fmt.Sprintf("错误: %v", err)
+	}
+
+	a.sendEvent(fmt.Sprintf("react_action_%d", iteration), StatusExecuting,
+		fmt.Sprintf("执行动作: %s", step.Action), step)
+
+	result, err := a.executeStep(ctx, step)
+	if err != nil {
+		return fmt.Sprintf("错误: %v", err)
+	}
+
+	result, err = a.runAfterStep(ctx, iteration-1, step, result)
+	if err != nil {
+		return fmt.Sprintf("错误: %v", err)
+	}
+
+	return result
+}
+
+// reActTurn 模型单轮输出
+type reActTurn struct {
+	Thought     string `json:"thought"`
+	Action      string `json:"action,omitempty"`
+	ActionInput string `json:"action_input,omitempty"`
+	FinalAnswer string `json:"final_answer,omitempty"`
+}
+
+// parseReActTurn 解析Thought/Action/Action Input/Final Answer格式的输出
+func parseReActTurn(response string) *reActTurn {
+	turn := &reActTurn{}
+
+	if idx := strings.Index(response, "Final Answer:"); idx != -1 {
+		turn.FinalAnswer = strings.TrimSpace(response[idx+len("Final Answer:"):])
+	}
+
+	current := ""
+	var input strings.Builder
+	for _, line := range strings.Split(response, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "Thought:"):
+			turn.Thought = strings.TrimSpace(strings.TrimPrefix(trimmed, "Thought:"))
+			current = "thought"
+		case strings.HasPrefix(trimmed, "Action Input:"):
+			input.WriteString(strings.TrimSpace(strings.TrimPrefix(trimmed, "Action Input:")))
+			current = "input"
+		case strings.HasPrefix(trimmed, "Action:"):
+			turn.Action = strings.TrimSpace(strings.TrimPrefix(trimmed, "Action:"))
+			current = "action"
+		case strings.HasPrefix(trimmed, "Observation:"), strings.HasPrefix(trimmed, "Final Answer:"):
+			current = ""
+		case current == "input":
+			input.WriteString("\n" + line)
+		}
+	}
+
+	actionInput := input.String()
+	if start, end := strings.Index(actionInput, "{"), strings.LastIndex(actionInput, "}"); start != -1 && end > start {
+		actionInput = actionInput[start : end+1]
+	}
+	turn.ActionInput = strings.TrimSpace(actionInput)
+
+	return turn
+}
+
+// buildReActPrompt构建ReAct提示词
+func (a *Agent) buildReActPrompt(query string, scratchpad []string) string {
+	availableTools := []string{}
+	if a.toolManager != nil {
+		tools := a.toolManager.ListTools()
+		for _, t := range tools {
+			availableTools = append(availableTools, t.Name)
+		}
+	}
+
+	template := `你是一个智能AI助手，请通过交替进行思考、行动和观察来回答用户问题。
+
+用户问题: %s
+
+可用工具: %v
+
+每一轮请严格使用以下格式之一输出:
+
+Thought: 你的思考过程
+Action: 执行动作(search_tool/rag_search/reason/ask_user)
+Action Input: {"参数名": "值"}
+
+或者在信息足够时:
+
+Thought: 你的思考过程
+Final Answer: 最终答案
+
+执行动作说明:
+- search_tool:调用工具，参数包括tool_name, input
+- rag_search:向量检索，参数包括query, top_k
+- reason:推理分析，参数包括prompt
+- ask_user:问题有歧义时向用户提问，参数包括question, default
+
+每轮只执行一个动作，不要自己编写Observation。
+
+%s`
+
+	history := ""
+	if len(scratchpad) > 0 {
+		history = "之前的过程:\n\n" + strings.Join(scratchpad, "\n\n") + "\n"
+	}
+
+	return fmt.Sprintf(template, query, availableTools, history)
+}
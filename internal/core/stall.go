@@ -0,0 +1,122 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 停滞干预级别，逐级升级
+const (
+	stallNone = iota
+	stallWarn
+	stallForceSynthesis
+	stallAbort
+)
+
+// errForceSynthesis 循环停滞时停止迭代，由调用方基于已有观察结果合成最终答案
+var errForceSynthesis = errors.New("循环停滞，强制合成最终答案")
+
+// StallError Think-Execute循环停滞且干预无效时返回的错误
+type StallError struct {
+	Iteration int
+	Reason    string
+}
+
+// Error 实现error接口
+func (e *StallError) Error() string {
+	return fmt.Sprintf("第 %d轮检测到循环停滞，已中止: %s", e.Iteration, e.Reason)
+}
+
+// stallDetector 通过计划和观察结果的指纹检测重复和无进展的迭代
+type stallDetector struct {
+	plans        map[string]int
+	observations map[string]int
+	level        int
+}
+
+// newStallDetector 创建停滞检测器
+func newStallDetector() *stallDetector {
+	return &stallDetector{
+		plans:        make(map[string]int),
+		observations: make(map[string]int),
+	}
+}
+
+// check 记录本轮的计划和结果，检测到停滞时返回原因
+func (d *stallDetector) check(plan *ExecutionPlan, result string) string {
+	planKey := fingerprint(planSignature(plan))
+	obsKey := fingerprint(strings.Join(strings.Fields(result), " "))
+
+	d.plans[planKey]++
+	d.observations[obsKey]++
+
+	switch {
+	case d.plans[planKey] > 1:
+		return "模型重复输出了相同的执行计划"
+	case d.observations[obsKey] > 1:
+		return "本轮执行结果与之前相同，没有取得进展"
+	default:
+		return ""
+	}
+}
+
+// escalate 升级干预级别并返回新级别
+func (d *stallDetector) escalate() int {
+	if d.level < stallAbort {
+		d.level++
+	}
+	return d.level
+}
+
+// planSignature 计划的规范化表示，包含动作和参数但忽略思考内容
+func planSignature(plan *ExecutionPlan) string {
+	steps := make([]map[string]interface{}, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		steps = append(steps, map[string]interface{}{
+			"action":     strings.ToLower(strings.TrimSpace(step.Action)),
+			"parameters": step.Parameters,
+			"if":         step.If,
+			"foreach":    step.Foreach,
+		})
+	}
+	// map的键在序列化时有序，保证相同计划得到相同签名
+	data, _ := json.Marshal(steps)
+	return string(data)
+}
+
+// fingerprint 计算文本指纹
+func fingerprint(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// interveneStall 根据干预级别处理停滞，返回errForceSynthesis时应停止循环并合成最终答案，
+// 返回其他非nil错误时应中止循环；没有可供合成的观察结果时直接中止
+func (a *Agent) interveneStall(detector *stallDetector, iteration int, reason string) error {
+	level := detector.escalate()
+	if level == stallForceSynthesis && len(a.observations.list()) == 0 {
+		level = stallAbort
+	}
+
+	switch level {
+	case stallWarn:
+		a.thinkNotes = append(a.thinkNotes,
+			fmt.Sprintf("警告: %s。请不要重复之前的计划，换一种方法或直接给出结论。", reason))
+		a.sendEvent(fmt.Sprintf("stall_warning_%d", iteration), StatusThinking,
+			"检测到循环停滞，已在提示词中加入警告", reason)
+	case stallForceSynthesis:
+		a.sendEvent(fmt.Sprintf("stall_force_synthesis_%d", iteration), StatusThinking,
+			"循环仍然停滞，停止迭代并基于已有观察结果合成最终答案", reason)
+		return errForceSynthesis
+	default:
+		err := &StallError{Iteration: iteration, Reason: reason}
+		a.sendEvent(fmt.Sprintf("stall_abort_%d", iteration), StatusError,
+			"循环停滞且干预无效，中止执行", err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// 内置执行策略名称
+const (
+	StrategyPlanExecute = "plan_execute"
+	StrategyReAct       = "react"
+)
+
+// Strategy 执行策略，决定Agent如何在工具、RAG和推理之间推进
+type Strategy interface {
+	// Name 策略名称
+	Name() string
+
+	// Run 执行策略并返回最终结果
+	Run(ctx context.Context, a *Agent, query string) (string, error)
+}
+
+// StrategyFactory 策略工厂函数
+type StrategyFactory func() Strategy
+
+var (
+	strategies   = map[string]StrategyFactory{}
+	strategiesMu sync.RWMutex
+)
+
+// RegisterStrategy 注册执行策略
+func RegisterStrategy(name string, factory StrategyFactory) error {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+
+	if _, exists := strategies[name]; exists {
+		return fmt.Errorf("执行策略 %s已注册", name)
+	}
+
+	strategies[name] = factory
+	return nil
+}
+
+// NewStrategy 按名称创建执行策略
+func NewStrategy(name string) (Strategy, error) {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+
+	factory, exists := strategies[name]
+	if !exists {
+		return nil, fmt.Errorf("未知的执行策略: %s", name)
+	}
+
+	return factory(), nil
+}
+
+// ListStrategies 列出所有已注册的执行策略
+func ListStrategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// PlanExecuteStrategy 先制定完整计划再执行的策略
+type PlanExecuteStrategy struct{}
+
+// Name 策略名称
+func (s *PlanExecuteStrategy) Name() string {
+	return StrategyPlanExecute
+}
+
+// Run 执行Think-Execute循环
+func (s *PlanExecuteStrategy) Run(ctx context.Context, a *Agent, query string) (string, error) {
+	return a.thinkExecuteLoop(ctx, query)
+}
+
+// WithStrategy 设置执行策略
+func (a *Agent) WithStrategy(s Strategy) *Agent {
+	a.strategy = s
+	return a
+}
+
+// 初始化时注册内置策略
+func init() {
+	RegisterStrategy(StrategyPlanExecute, func() Strategy {
+		return &PlanExecuteStrategy{}
+	})
+	RegisterStrategy(StrategyReAct, func() Strategy {
+		return &ReActStrategy{}
+	})
+}
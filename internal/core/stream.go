@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+
+	"aigent/internal/model"
+)
+
+// 流式输出的阶段
+const (
+	phaseReason = "reason"
+	phaseAnswer = "answer"
+)
+
+// generate 以消息形式调用模型：system提示词、对话历史，再加上本次提示词
+func (a *Agent) generate(ctx context.Context, prompt string) (string, error) {
+	return a.generateWith(ctx, prompt, model.ChatOptions{})
+}
+
+// generateWith 以指定的生成参数调用模型
+func (a *Agent) generateWith(ctx context.Context, prompt string, opts model.ChatOptions) (string, error) {
+	return model.Chat(ctx, a.model, a.messages(prompt), opts)
+}
+
+// messages 构建发送给模型的消息列表，超出上下文窗口的早期历史会被丢弃
+func (a *Agent) messages(prompt string) []model.Message {
+	history := a.fitHistory(prompt)
+	messages := make([]model.Message, 0, len(history)+2)
+	if a.config.SystemPrompt != "" {
+		messages = append(messages, model.Message{Role: model.RoleSystem, Content: a.config.SystemPrompt})
+	}
+	messages = append(messages, history...)
+	return append(messages, model.Message{Role: model.RoleUser, Content: prompt, Images: a.images})
+}
+
+// generateStreaming 流式调用模型，把增量文本作为agent_token事件推送，返回完整文本
+//
+// 与generate一样发送system提示词、对话历史和图片；模型不支持消息流式时
+// 由model.StreamChat退化为普通调用，完整文本作为一个事件推送。
+func (a *Agent) generateStreaming(ctx context.Context, phase, stepID, prompt string) (string, error) {
+	ch, err := model.StreamChat(ctx, a.model, a.messages(prompt), model.ChatOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return model.Collect(ch, func(delta string) {
+		a.sendToken(phase, stepID, delta)
+	})
+}
+
+// sendToken 推送一个增量文本事件
+func (a *Agent) sendToken(phase, stepID, delta string) {
+	if a.sseBroker == nil {
+		return
+	}
+
+	a.sseBroker.Broadcast("agent_token", map[string]interface{}{
+		"run_id":  a.runID,
+		"phase":   phase,
+		"step_id": stepID,
+		"delta":   delta,
+	})
+}
@@ -0,0 +1,246 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"aigent/internal/rag"
+)
+
+// Observation 执行过程中获得的一条观察结果，是引用的来源
+type Observation struct {
+	Ref         int      `json:"ref"` // 引用编号，对应答案中的[n]
+	StepID      string   `json:"step_id"`
+	Action      string   `json:"action"`
+	Tool        string   `json:"tool,omitempty"`
+	Content     string   `json:"content"`
+	URLs        []string `json:"urls,omitempty"`
+	DocumentIDs []string `json:"document_ids,omitempty"`
+	Recovered   bool     `json:"recovered,omitempty"` // 步骤失败后由错误恢复得到的结果
+}
+
+// Citation 答案中一条论断及其来源
+type Citation struct {
+	Claim   string        `json:"claim"`
+	Sources []Observation `json:"sources"`
+}
+
+// RunResult 一次运行的结果
+type RunResult struct {
+	RunID        string        `json:"run_id"`
+	Answer       string        `json:"answer"`
+	Citations    []Citation    `json:"citations,omitempty"`
+	Observations []Observation `json:"observations,omitempty"`
+}
+
+// observationLog 并发安全的观察结果记录
+type observationLog struct {
+	items []Observation
+	mu    sync.Mutex
+}
+
+// add 追加观察结果并分配引用编号
+func (l *observationLog) add(obs Observation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	obs.Ref = len(l.items) + 1
+	l.items = append(l.items, obs)
+}
+
+// list 返回观察结果的副本
+func (l *observationLog) list() []Observation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	items := make([]Observation, len(l.items))
+	copy(items, l.items)
+	return items
+}
+
+var (
+	urlPattern      = regexp.MustCompile(`https?://[^\s"'<>)\]]+`)
+	citationPattern = regexp.MustCompile(`\[(\d+)\]`)
+	sentencePattern = regexp.MustCompile(`[^。！？!?\n]+[。！？!?]?`)
+)
+
+// observe 记录步骤的观察结果
+func (a *Agent) observe(step *PlanStep, content string, results []rag.SearchResult) {
+	a.observations.add(newObservation(step, content, results))
+}
+
+// observeRecovered 记录步骤失败后由错误恢复得到的观察结果
+func (a *Agent) observeRecovered(step *PlanStep, content string) {
+	obs := newObservation(step, content, nil)
+	obs.Recovered = true
+	a.observations.add(obs)
+}
+
+// newObservation 根据步骤和结果构建观察结果
+func newObservation(step *PlanStep, content string, results []rag.SearchResult) Observation {
+	obs := Observation{
+		StepID:  step.ID,
+		Action:  step.Action,
+		Content: content,
+	}
+
+	if toolName, ok := step.Parameters["tool_name"].(string); ok {
+		obs.Tool = toolName
+	}
+	if step.Action == "search_tool" {
+		obs.URLs = urlPattern.FindAllString(content, -1)
+	}
+	for _, r := range results {
+		obs.DocumentIDs = append(obs.DocumentIDs, r.Document.ID)
+	}
+	return obs
+}
+
+// synthesize 综合用户问题和全部观察结果生成带引用的最终答案
+//
+// 没有观察结果时直接使用策略的结果；合成失败时退回到策略的结果。
+func (a *Agent) synthesize(ctx context.Context, query, draft string) *RunResult {
+	result := &RunResult{
+		RunID:        a.runID,
+		Answer:       draft,
+		Observations: a.observations.list(),
+	}
+	if len(result.Observations) == 0 {
+		return result
+	}
+
+	a.sendEvent("synthesize", StatusThinking, "综合观察结果生成最终答案", nil)
+
+	response, err := a.generateStreaming(ctx, phaseAnswer, "", buildSynthesisPrompt(query, draft, result.Observations))
+	if err != nil {
+		a.logger.Warnf("合成最终答案失败，使用最后一步的结果: %v", err)
+		return result
+	}
+
+	answer, claims := parseSynthesis(response)
+	if answer == "" {
+		a.logger.Warn("合成的最终答案为空，使用最后一步的结果")
+		return result
+	}
+
+	result.Answer = answer
+	result.Citations = resolveCitations(claims, result.Observations)
+	return result
+}
+
+// synthesisClaim 模型返回的论断及其引用编号
+type synthesisClaim struct {
+	Claim   string `json:"claim"`
+	Sources []int  `json:"sources"`
+}
+
+// parseSynthesis 解析合成结果；通常为带[n]标注的文本，也兼容JSON格式
+func parseSynthesis(response string) (string, []synthesisClaim) {
+	var out struct {
+		Answer    string           `json:"answer"`
+		Citations []synthesisClaim `json:"citations"`
+	}
+
+	if err := json.Unmarshal([]byte(response), &out); err != nil {
+		jsonStr := extractJSONFromResponse(response)
+		if jsonStr == "" || json.Unmarshal([]byte(jsonStr), &out) != nil {
+			answer := strings.TrimSpace(response)
+			return answer, claimsFromMarkers(answer)
+		}
+	}
+
+	if len(out.Citations) == 0 {
+		out.Citations = claimsFromMarkers(out.Answer)
+	}
+	return strings.TrimSpace(out.Answer), out.Citations
+}
+
+// claimsFromMarkers 按句子切分答案，把含有[n]标注的句子作为论断
+func claimsFromMarkers(answer string) []synthesisClaim {
+	claims := []synthesisClaim{}
+	sentences := sentencePattern.FindAllString(answer, -1)
+	for _, sentence := range sentences {
+		matches := citationPattern.FindAllStringSubmatch(sentence, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		claim := synthesisClaim{Claim: strings.TrimSpace(citationPattern.ReplaceAllString(sentence, ""))}
+		for _, m := range matches {
+			if ref, err := strconv.Atoi(m[1]); err == nil {
+				claim.Sources = append(claim.Sources, ref)
+			}
+		}
+		claims = append(claims, claim)
+	}
+	return claims
+}
+
+// resolveCitations 把引用编号解析为观察结果，丢弃无效编号
+func resolveCitations(claims []synthesisClaim, observations []Observation) []Citation {
+	citations := []Citation{}
+	for _, c := range claims {
+		refs := map[int]bool{}
+		for _, ref := range c.Sources {
+			if ref >= 1 && ref <= len(observations) {
+				refs[ref] = true
+			}
+		}
+		if len(refs) == 0 || c.Claim == "" {
+			continue
+		}
+
+		ordered := make([]int, 0, len(refs))
+		for ref := range refs {
+			ordered = append(ordered, ref)
+		}
+		sort.Ints(ordered)
+
+		citation := Citation{Claim: c.Claim}
+		for _, ref := range ordered {
+			citation.Sources = append(citation.Sources, observations[ref-1])
+		}
+		citations = append(citations, citation)
+	}
+	return citations
+}
+
+// buildSynthesisPrompt构建最终答案合成提示词
+func buildSynthesisPrompt(query, draft string, observations []Observation) string {
+	var sb strings.Builder
+	for _, obs := range observations {
+		source := fmt.Sprintf("步骤 %s, 动作 %s", obs.StepID, obs.Action)
+		if obs.Tool != "" {
+			source += ", 工具 " + obs.Tool
+		}
+		if len(obs.DocumentIDs) > 0 {
+			source += ", 文档 " + strings.Join(obs.DocumentIDs, ",")
+		}
+		if obs.Recovered {
+			source += ", 步骤失败后恢复的结果"
+		}
+		fmt.Fprintf(&sb, "[%d] (%s)\n%s\n\n", obs.Ref, source, obs.Content)
+	}
+
+	template := `你是一个智能AI助手，请基于执行过程中获得的观察结果回答用户问题。
+
+用户问题: %s
+
+观察结果:
+
+%s初步结果: %s
+
+要求:
+1. 直接回答用户问题，不要原样复制工具输出
+2. 每个事实性论断所在句子的末尾用[编号]标注其来源的观察结果，如: 北京今天晴[2]。
+3. 观察结果中没有依据的内容不要编造
+
+请直接输出最终答案，不要其他说明。`
+
+	return fmt.Sprintf(template, query, sb.String(), draft)
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// TraceEntry 运行轨迹中的一条记录
+type TraceEntry struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Iteration int         `json:"iteration"`
+	Kind      string      `json:"kind"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// RunTrace 记录一次运行中的决策过程（如被否决的候选计划）
+type RunTrace struct {
+	entries []TraceEntry
+	mu      sync.RWMutex
+}
+
+// NewRunTrace 创建运行轨迹
+func NewRunTrace() *RunTrace {
+	return &RunTrace{}
+}
+
+// Add 追加一条轨迹记录
+func (t *RunTrace) Add(iteration int, kind, message string, data interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries = append(t.entries, TraceEntry{
+		Timestamp: time.Now(),
+		Iteration: iteration,
+		Kind:      kind,
+		Message:   message,
+		Data:      data,
+	})
+}
+
+// Entries 返回轨迹记录的副本
+func (t *RunTrace) Entries() []TraceEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	entries := make([]TraceEntry, len(t.entries))
+	copy(entries, t.entries)
+	return entries
+}
@@ -3,6 +3,8 @@ package http
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -17,9 +19,10 @@ import (
 
 // Server HTTP服务
 type Server struct {
-	router    *gin.Engine
-	agent     *core.Agent
-	sseBroker *sse.Broker
+	router      *gin.Engine
+	agent       *core.Agent
+	answerCache *core.AnswerCache
+	sseBroker   *sse.Broker
 	logger    *logrus.Logger
 	port      string
 }
@@ -28,8 +31,9 @@ type Server struct {
 type Config struct {
 	Port      string
 	Debug     bool
-	Agent     *core.Agent
-	SSEBroker *sse.Broker
+	Agent       *core.Agent
+	AnswerCache *core.AnswerCache // 语义答案缓存，为nil时不启用
+	SSEBroker   *sse.Broker
 }
 
 // NewServer创建新的HTTP服务器
@@ -40,8 +44,9 @@ func NewServer(config Config) *Server {
 	}
 
 	server := &Server{
-		agent:     config.Agent,
-		sseBroker: config.SSEBroker,
+		agent:       config.Agent,
+		answerCache: config.AnswerCache,
+		sseBroker:   config.SSEBroker,
 		logger:    logger,
 		port:      config.Port,
 	}
@@ -65,11 +70,16 @@ func (s *Server) setupRouter() {
 	{
 		// Agent相关接口
 		api.POST("/agent/execute", s.handleAgentExecute)
+		api.POST("/agent/plan", s.handleAgentPlan)
 		api.GET("/agent/status", s.handleAgentStatus)
+		api.POST("/agent/runs/:id/input", s.handleAgentInput)
+		api.GET("/agent/cache", s.handleAnswerCacheStats)
+		api.DELETE("/agent/cache", s.handleInvalidateAnswerCache)
 
 		//模型相关接口
 		api.GET("/models", s.handleListModels)
 		api.POST("/models", s.handleCreateModel)
+		api.GET("/models/:name/local", s.handleListLocalModels)
 
 		//工具相关接口
 		api.GET("/tools", s.handleListTools)
@@ -98,6 +108,14 @@ type AgentExecuteRequest struct {
 	MaxTokens   int     `json:"max_tokens"`
 	Temperature float64 `json:"temperature"`
 	Timeout     int     `json:"timeout"`
+	Strategy    string  `json:"strategy"` // plan_execute/react，默认plan_execute
+	// History 之前的对话轮次（user/assistant），本次查询不需要包含在内
+	History []model.Message `json:"history,omitempty"`
+	// Profile 覆盖应用级Agent配置名称；Tenant 租户，为空时读取X-Tenant-ID请求头。答案缓存按二者隔离
+	Profile string `json:"profile,omitempty"`
+	Tenant  string `json:"tenant,omitempty"`
+	// Images 随查询发送的图片（截图、图表等），url和data（base64）二选一，模型需支持视觉输入
+	Images []model.ImagePart `json:"images,omitempty"`
 }
 
 func (s *Server) handleAgentExecute(c *gin.Context) {
@@ -107,12 +125,89 @@ func (s *Server) handleAgentExecute(c *gin.Context) {
 		s.writeError(c, http.StatusBadRequest, "无效的请求体", err)
 		return
 	}
+	if req.Tenant == "" {
+		req.Tenant = c.GetHeader("X-Tenant-ID")
+	}
 
-	if req.Query == "" {
-		s.writeError(c, http.StatusBadRequest, "查询不能为空", nil)
+	agent, reqErr := s.newRequestAgent(&req)
+	if reqErr != nil {
+		s.writeError(c, reqErr.status, reqErr.message, reqErr.err)
+		return
+	}
+	runID := agent.RunID()
+
+	//在后台执行
+	go func() {
+		ctx := context.Background()
+		result, err := agent.Run(ctx, req.Query)
+		if err != nil {
+			s.sseBroker.Broadcast("agent_error", map[string]interface{}{
+				"error":  err.Error(),
+				"query":  req.Query,
+				"run_id": runID,
+			})
+			return
+		}
+
+		s.sseBroker.Broadcast("agent_result", map[string]interface{}{
+			"result":    result.Answer,
+			"citations": result.Citations,
+			"query":     req.Query,
+			"run_id":    runID,
+		})
+	}()
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "Agent执行已启动",
+		"query":    req.Query,
+		"strategy": req.Strategy,
+		"run_id":   runID,
+	})
+}
+
+// AgentPlanRequest 试运行规划请求
+type AgentPlanRequest struct {
+	AgentExecuteRequest
+	Simulate bool `json:"simulate"` // 使用模拟工具执行计划
+}
+
+// handleAgentPlan处理试运行规划：只制定并验证计划，不调用真实工具
+func (s *Server) handleAgentPlan(c *gin.Context) {
+	var req AgentPlanRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.writeError(c, http.StatusBadRequest, "无效的请求体", err)
 		return
 	}
 
+	agent, reqErr := s.newRequestAgent(&req.AgentExecuteRequest)
+	if reqErr != nil {
+		s.writeError(c, reqErr.status, reqErr.message, reqErr.err)
+		return
+	}
+
+	result, err := agent.DryRun(c.Request.Context(), req.Query, req.Simulate)
+	if err != nil {
+		s.writeError(c, http.StatusUnprocessableEntity, "制定执行计划失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// requestError请求处理错误及对应的HTTP状态码
+type requestError struct {
+	status  int
+	message string
+	err     error
+}
+
+// newRequestAgent根据请求创建Agent
+func (s *Server) newRequestAgent(req *AgentExecuteRequest) (*core.Agent, *requestError) {
+	if req.Query == "" {
+		return nil, &requestError{http.StatusBadRequest, "查询不能为空", nil}
+	}
+
 	//设置默认值
 	if req.MaxTokens <= 0 {
 		req.MaxTokens = 2000
@@ -123,6 +218,14 @@ func (s *Server) handleAgentExecute(c *gin.Context) {
 	if req.Timeout <= 0 {
 		req.Timeout = 300
 	}
+	if req.Strategy == "" {
+		req.Strategy = core.StrategyPlanExecute
+	}
+
+	strategy, err := core.NewStrategy(req.Strategy)
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, "无效的执行策略", err}
+	}
 
 	//创建模型配置
 	modelConfig := model.ModelConfig{
@@ -136,50 +239,98 @@ func (s *Server) handleAgentExecute(c *gin.Context) {
 	//创建模型实例
 	llm, err := model.CreateModel(modelConfig)
 	if err != nil {
-		s.writeError(c, http.StatusInternalServerError, "创建模型失败", err)
-		return
+		return nil, &requestError{http.StatusInternalServerError, "创建模型失败", err}
+	}
+	if len(req.Images) > 0 {
+		if err := model.ValidateImages(modelConfig.Name, req.Images); err != nil {
+			return nil, &requestError{http.StatusBadRequest, "图片输入无效", err}
+		}
 	}
 
-	//配置Agent
-	agentConfig := core.AgentConfig{
-		ModelName:     req.ModelName,
-		MaxIterations: 10,
-		Timeout:       time.Duration(req.Timeout) * time.Second,
-		Debug:         s.logger.GetLevel() == logrus.DebugLevel,
+	//配置Agent，以应用级Agent的配置作为基础
+	agentConfig := core.AgentConfig{MaxIterations: 10}
+	if s.agent != nil {
+		agentConfig = s.agent.Config()
+	}
+	agentConfig.ModelName = req.ModelName
+	agentConfig.Timeout = time.Duration(req.Timeout) * time.Second
+	agentConfig.Debug = s.logger.GetLevel() == logrus.DebugLevel
+	if req.Profile != "" {
+		agentConfig.Profile = req.Profile
 	}
 
-	// 更新Agent配置
+	runID := fmt.Sprintf("run_%d", time.Now().UnixNano())
+
 	agent := core.NewAgent(agentConfig).
+		WithRunID(runID).
 		WithModel(llm).
 		WithToolManager(tool.GlobalManager).
-		WithSSE(s.sseBroker)
+		WithSSE(s.sseBroker).
+		WithStrategy(strategy).
+		WithHistory(req.History).
+		WithImages(req.Images).
+		WithAnswerCache(s.answerCache).
+		WithTenant(req.Tenant)
+
+	return agent, nil
+}
 
-	if s.agent != nil {
-		// 如果已有RAG引擎，复用它
-		//这里需要获取现有的RAG引擎引用
+// AgentInputRequest 用户对挂起运行的回答
+type AgentInputRequest struct {
+	Answer string `json:"answer"`
+}
+
+// handleAgentInput处理用户对input_required事件的回答
+func (s *Server) handleAgentInput(c *gin.Context) {
+	var req AgentInputRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.writeError(c, http.StatusBadRequest, "无效的请求体", err)
+		return
 	}
 
-	//在后台执行
-	go func() {
-		ctx := context.Background()
-		result, err := agent.Execute(ctx, req.Query)
-		if err != nil {
-			s.sseBroker.Broadcast("agent_error", map[string]interface{}{
-				"error": err.Error(),
-				"query": req.Query,
-			})
+	runID := c.Param("id")
+	if err := core.GlobalInputBroker.Submit(runID, req.Answer); err != nil {
+		if errors.Is(err, core.ErrNoPendingInput) {
+			s.writeError(c, http.StatusNotFound, "该运行没有等待中的问题", err)
 			return
 		}
+		s.writeError(c, http.StatusInternalServerError, "提交回答失败", err)
+		return
+	}
 
-		s.sseBroker.Broadcast("agent_result", map[string]interface{}{
-			"result": result,
-			"query":  req.Query,
-		})
-	}()
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "回答已提交",
+		"run_id":  runID,
+	})
+}
+
+// handleAnswerCacheStats处理答案缓存统计查询
+func (s *Server) handleAnswerCacheStats(c *gin.Context) {
+	if s.answerCache == nil {
+		s.writeError(c, http.StatusNotFound, "答案缓存未启用", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, s.answerCache.Stats())
+}
+
+// handleInvalidateAnswerCache处理答案缓存失效，按profile、tenant、id筛选，均为空时清空
+func (s *Server) handleInvalidateAnswerCache(c *gin.Context) {
+	if s.answerCache == nil {
+		s.writeError(c, http.StatusNotFound, "答案缓存未启用", nil)
+		return
+	}
+
+	removed := s.answerCache.Invalidate(core.AnswerCacheFilter{
+		Profile: c.Query("profile"),
+		Tenant:  c.Query("tenant"),
+		ID:      c.Query("id"),
+	})
 
 	c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "Agent执行已启动",
-		"query":   req.Query,
+		"message": "答案缓存已失效",
+		"removed": removed,
 	})
 }
 
@@ -199,7 +350,45 @@ func (s *Server) handleAgentStatus(c *gin.Context) {
 func (s *Server) handleListModels(c *gin.Context) {
 	models := model.GlobalRegistry.ListModels()
 
+	// 模型类型名既可能是模型ID（gpt-4o）也可能是提供方（anthropic）
+	capabilities := make(map[string]model.Capabilities, len(models))
+	for _, name := range models {
+		capabilities[name] = model.GlobalRegistry.TypeCapabilities(name, name)
+	}
+
+	instances := []model.InstanceInfo{}
+	for _, m := range model.GlobalRegistry.Instances() {
+		instances = append(instances, model.DescribeModel(m))
+	}
+
 	c.JSON(http.StatusOK, map[string]interface{}{
+		"models":       models,
+		"count":        len(models),
+		"capabilities": capabilities,
+		"instances":    instances,
+	})
+}
+
+// handleListLocalModels处理Ollama模型实例所在服务的本地模型查询
+func (s *Server) handleListLocalModels(c *gin.Context) {
+	name := c.Param("name")
+	if _, exists := model.GlobalRegistry.GetModel(name); !exists {
+		s.writeError(c, http.StatusNotFound, "模型不存在", nil)
+		return
+	}
+
+	models, err := model.ListOllamaModels(c.Request.Context(), name)
+	if err != nil {
+		if errors.Is(err, model.ErrNotOllama) {
+			s.writeError(c, http.StatusBadRequest, "只有Ollama模型支持列出本地模型", err)
+			return
+		}
+		s.writeError(c, http.StatusBadGateway, "获取本地模型失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"name":   name,
 		"models": models,
 		"count":  len(models),
 	})
@@ -214,6 +403,27 @@ type CreateModelRequest struct {
 	MaxTokens   int     `json:"max_tokens"`
 	Temperature float64 `json:"temperature"`
 	Timeout     int     `json:"timeout"`
+
+	Provider     string            `json:"provider"`
+	Headers      map[string]string `json:"headers"`
+	Organization string            `json:"organization"`
+	Project      string            `json:"project"`
+	Path         string            `json:"path"`
+
+	Vision       *bool                      `json:"vision"`
+	Capabilities *model.CapabilityOverrides `json:"capabilities"`
+
+	Options map[string]interface{} `json:"options"`
+
+	Fallback   []string `json:"fallback"`
+	FallbackOn []string `json:"fallback_on"`
+
+	Pool *model.PoolConfig `json:"pool"`
+
+	RateLimit *model.RateLimitConfig `json:"rate_limit"`
+	Breaker   *model.BreakerConfig   `json:"breaker"`
+	Cache     *model.CacheConfig     `json:"cache"`
+	Retry     *model.RetryConfig     `json:"retry"`
 }
 
 // handleCreateModel处理模型创建
@@ -233,6 +443,22 @@ func (s *Server) handleCreateModel(c *gin.Context) {
 		MaxTokens:   req.MaxTokens,
 		Temperature: req.Temperature,
 		Timeout:     req.Timeout,
+
+		Provider:     req.Provider,
+		Headers:      req.Headers,
+		Organization: req.Organization,
+		Project:      req.Project,
+		Path:         req.Path,
+		Vision:       req.Vision,
+		Capabilities: req.Capabilities,
+		Options:      req.Options,
+		Fallback:     req.Fallback,
+		FallbackOn:   req.FallbackOn,
+		Pool:         req.Pool,
+		RateLimit:    req.RateLimit,
+		Breaker:      req.Breaker,
+		Cache:        req.Cache,
+		Retry:        req.Retry,
 	}
 
 	if config.Timeout <= 0 {
@@ -0,0 +1,312 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Anthropic接口默认配置
+const (
+	defaultAnthropicBaseURL   = "https://api.anthropic.com/v1"
+	defaultAnthropicPath      = "/messages"
+	defaultAnthropicModel     = "claude-3-5-sonnet-latest"
+	defaultAnthropicMaxTokens = 1024 // Messages API要求必须指定max_tokens
+	anthropicVersion          = "2023-06-01"
+)
+
+// AnthropicModel Anthropic Messages API模型实现
+type AnthropicModel struct {
+	config ModelConfig
+	client *http.Client
+	usageCounter
+}
+
+// NewAnthropicModel 创建Anthropic模型
+func NewAnthropicModel(config ModelConfig) (Model, error) {
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("Anthropic API key is required")
+	}
+
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = defaultAnthropicBaseURL
+	}
+
+	if config.ModelID == "" || config.ModelID == "anthropic" {
+		config.ModelID = defaultAnthropicModel
+	}
+
+	client := newHTTPClient(config)
+
+	return &AnthropicModel{
+		config: config,
+		client: client,
+	}, nil
+}
+
+// Name 返回模型名称
+func (m *AnthropicModel) Name() string {
+	return m.config.Name
+}
+
+// Config 返回模型配置
+func (m *AnthropicModel) Config() ModelConfig {
+	return m.config
+}
+
+// Generate 生成文本响应
+func (m *AnthropicModel) Generate(ctx context.Context, prompt string) (string, error) {
+	return m.Chat(ctx, []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+}
+
+// Chat 以消息列表的形式生成响应
+//
+// 返回所有text块拼接的文本；响应只包含tool_use块时返回这些块的JSON数组。
+func (m *AnthropicModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	response, err := m.CreateMessage(ctx, m.buildRequest(messages, opts))
+	if err != nil {
+		return "", err
+	}
+
+	if text := response.Text(); text != "" {
+		return text, nil
+	}
+
+	if toolUses := response.ToolUses(); len(toolUses) > 0 {
+		data, err := json.Marshal(toolUses)
+		if err != nil {
+			return "", fmt.Errorf("序列化工具调用失败: %w", err)
+		}
+		return string(data), nil
+	}
+
+	return "", fmt.Errorf("API返回空响应")
+}
+
+// CreateMessage 直接调用Messages API，调用方需要tools或原始内容块时使用
+func (m *AnthropicModel) CreateMessage(ctx context.Context, request AnthropicRequest) (*AnthropicResponse, error) {
+	request.Stream = false
+	if request.Model == "" {
+		request.Model = m.config.ModelID
+	}
+	if request.MaxTokens <= 0 {
+		request.MaxTokens = defaultAnthropicMaxTokens
+	}
+
+	req, err := m.newRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var response AnthropicResponse
+	if err := doJSON(m.client, req, &response); err != nil {
+		return nil, err
+	}
+
+	m.recordUsage(response.Usage)
+	return &response, nil
+}
+
+// GenerateStream 流式生成文本响应
+func (m *AnthropicModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	return m.ChatStream(ctx, []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+}
+
+// ChatStream 以消息列表的形式流式生成响应
+func (m *AnthropicModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	request := m.buildRequest(messages, opts)
+	request.Stream = true
+
+	req, err := m.newRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamSSE(m.client, req, m.parseStreamData)
+}
+
+// buildRequest 把通用消息转换为Messages API请求：system消息合并为顶层system，
+// tool消息转换为带tool_result块的user消息
+func (m *AnthropicModel) buildRequest(messages []Message, opts ChatOptions) AnthropicRequest {
+	request := AnthropicRequest{
+		Model:         m.config.ModelID,
+		MaxTokens:     opts.maxTokens(m.config.MaxTokens),
+		StopSequences: opts.Stop,
+	}
+	if request.MaxTokens <= 0 {
+		request.MaxTokens = defaultAnthropicMaxTokens
+	}
+	request.Temperature = opts.requestTemperature(m.config.Temperature)
+
+	var system []string
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem:
+			system = append(system, msg.Content)
+		case RoleTool:
+			request.Messages = append(request.Messages, AnthropicMessage{
+				Role: RoleUser,
+				Content: []ContentBlock{{
+					Type:      "tool_result",
+					ToolUseID: msg.ToolCallID,
+					Content:   msg.Content,
+				}},
+			})
+		default:
+			request.Messages = append(request.Messages, AnthropicMessage{
+				Role:    msg.Role,
+				Content: []ContentBlock{{Type: "text", Text: msg.Content}},
+			})
+		}
+	}
+	request.System = strings.Join(system, "\n\n")
+
+	return request
+}
+
+// newRequest 创建Messages API HTTP请求
+func (m *AnthropicModel) newRequest(ctx context.Context, request AnthropicRequest) (*http.Request, error) {
+	path := m.config.Path
+	if path == "" {
+		path = defaultAnthropicPath
+	}
+
+	headers := map[string]string{
+		"x-api-key":         m.config.APIKey,
+		"anthropic-version": anthropicVersion,
+	}
+	for key, value := range m.config.Headers {
+		headers[key] = value
+	}
+
+	return newJSONRequest(ctx, joinURL(m.config.APIEndpoint, path), request, headers)
+}
+
+// parseStreamData 解析Messages API流式事件
+//
+// 输入用量来自message_start，输出用量以message_delta中的累计值为准。
+func (m *AnthropicModel) parseStreamData(data string) (string, bool, error) {
+	var event AnthropicStreamEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return "", false, fmt.Errorf("解析流式响应失败: %w", err)
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			m.recordUsage(Usage{InputTokens: event.Message.Usage.InputTokens})
+		}
+	case "content_block_delta":
+		if event.Delta != nil && event.Delta.Type == "text_delta" {
+			return event.Delta.Text, false, nil
+		}
+	case "message_delta":
+		if event.Usage != nil {
+			m.recordUsage(Usage{OutputTokens: event.Usage.OutputTokens})
+		}
+	case "message_stop":
+		return "", true, nil
+	case "error":
+		if event.Error != nil {
+			return "", false, fmt.Errorf("API流式错误: %s - %s", event.Error.Type, event.Error.Message)
+		}
+		return "", false, fmt.Errorf("API流式错误")
+	}
+
+	return "", false, nil
+}
+
+// AnthropicRequest Messages API请求结构
+type AnthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []AnthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []AnthropicTool    `json:"tools,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+// AnthropicMessage 消息，内容为内容块列表
+type AnthropicMessage struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// AnthropicTool 工具定义
+type AnthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+// ContentBlock 内容块（text/tool_use/tool_result）
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+// AnthropicResponse Messages API响应结构
+type AnthropicResponse struct {
+	ID         string         `json:"id"`
+	Model      string         `json:"model"`
+	Role       string         `json:"role"`
+	Content    []ContentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      Usage          `json:"usage"`
+}
+
+// Text 拼接所有text块
+func (r *AnthropicResponse) Text() string {
+	var sb strings.Builder
+	for _, block := range r.Content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
+		}
+	}
+	return sb.String()
+}
+
+// ToolUses 返回所有tool_use块
+func (r *AnthropicResponse) ToolUses() []ContentBlock {
+	var blocks []ContentBlock
+	for _, block := range r.Content {
+		if block.Type == "tool_use" {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// AnthropicStreamEvent 流式事件
+type AnthropicStreamEvent struct {
+	Type    string             `json:"type"`
+	Message *AnthropicResponse `json:"message,omitempty"`
+	Delta   *struct {
+		Type       string `json:"type"`
+		Text       string `json:"text,omitempty"`
+		StopReason string `json:"stop_reason,omitempty"`
+	} `json:"delta,omitempty"`
+	Usage *Usage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// isAnthropic检查是否为Anthropic模型
+func isAnthropic(modelType string) bool {
+	return strings.HasPrefix(modelType, "claude-")
+}
@@ -0,0 +1,256 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Azure OpenAI默认配置
+const (
+	defaultAzureAPIVersion       = "2024-06-01"
+	defaultAzureIdentityEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureCognitiveResource       = "https://cognitiveservices.azure.com"
+	defaultTokenCommandTTL       = 10 * time.Minute // 令牌命令只输出令牌时的缓存时间
+	tokenRefreshMargin           = 2 * time.Minute  // 令牌过期前提前刷新的时间
+)
+
+// Azure OpenAI认证方式
+const (
+	AzureAuthAPIKey          = "api_key"          // api-key请求头
+	AzureAuthEntra           = "entra"            // Microsoft Entra ID令牌，Bearer认证
+	AzureAuthManagedIdentity = "managed_identity" // 托管标识，从实例元数据服务获取Entra令牌
+	AzureAuthCommand         = "command"          // 执行token_command获取Entra令牌
+)
+
+// TokenProvider 返回当前有效的访问令牌，由调用方负责缓存和刷新
+type TokenProvider func(ctx context.Context) (string, error)
+
+// AzureOpenAIModel Azure OpenAI模型实现
+//
+// APIEndpoint为资源地址（如https://my-resource.openai.azure.com），ModelID为模型名。
+// ModelConfig.Options支持：
+//   - api_version: api-version查询参数，默认2024-06-01
+//   - deployment: 部署名，默认与ModelID相同
+//   - deployments: 模型名到部署名的映射，优先于deployment
+//   - auth: api_key（默认）、entra、managed_identity或command；entra时APIKey作为Entra令牌使用
+//   - client_id: managed_identity时用户分配托管标识的客户端ID
+//   - identity_endpoint: managed_identity时的令牌地址，默认为实例元数据服务
+//   - token_command: command时执行的命令，输出令牌或az account get-access-token的JSON
+type AzureOpenAIModel struct {
+	*OpenAIModel
+	deployment string
+}
+
+// NewAzureOpenAIModel 创建Azure OpenAI模型
+func NewAzureOpenAIModel(config ModelConfig) (Model, error) {
+	auth := config.OptionString("auth")
+	if auth == "" {
+		auth = AzureAuthAPIKey
+	}
+
+	var authorize authorizeFunc
+	switch auth {
+	case AzureAuthAPIKey:
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("Azure OpenAI API key is required")
+		}
+		authorize = func(ctx context.Context, headers map[string]string) error {
+			headers["api-key"] = config.APIKey
+			return nil
+		}
+	case AzureAuthEntra:
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("Azure OpenAI Entra令牌不能为空")
+		}
+		authorize = bearerAuth(config.APIKey)
+	case AzureAuthManagedIdentity:
+		authorize = tokenAuth(newCachedToken(managedIdentityToken(config)))
+	case AzureAuthCommand:
+		command := config.OptionString("token_command")
+		if command == "" {
+			return nil, fmt.Errorf("Azure OpenAI命令认证需要配置token_command")
+		}
+		authorize = tokenAuth(newCachedToken(commandToken(command)))
+	default:
+		return nil, fmt.Errorf("不支持的Azure认证方式: %s", auth)
+	}
+
+	return newAzureOpenAIModel(config, authorize)
+}
+
+// NewAzureOpenAIModelWithTokenProvider 创建使用Entra令牌认证的Azure OpenAI模型，
+// 每次请求前调用provider获取令牌
+func NewAzureOpenAIModelWithTokenProvider(config ModelConfig, provider TokenProvider) (Model, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("令牌提供者不能为空")
+	}
+
+	return newAzureOpenAIModel(config, tokenAuth(provider))
+}
+
+// tokenAuth 每次请求前从provider获取令牌，以Bearer认证发送
+func tokenAuth(provider TokenProvider) authorizeFunc {
+	return func(ctx context.Context, headers map[string]string) error {
+		token, err := provider(ctx)
+		if err != nil {
+			return err
+		}
+		headers["Authorization"] = "Bearer " + token
+		return nil
+	}
+}
+
+// newAzureOpenAIModel 解析部署和版本，构建部署地址
+func newAzureOpenAIModel(config ModelConfig, authorize authorizeFunc) (*AzureOpenAIModel, error) {
+	if config.APIEndpoint == "" {
+		return nil, fmt.Errorf("Azure OpenAI需要配置资源地址api_endpoint")
+	}
+
+	deployment := azureDeployment(config)
+	if deployment == "" {
+		return nil, fmt.Errorf("Azure OpenAI需要配置部署名或模型ID")
+	}
+
+	apiVersion := config.OptionString("api_version")
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+
+	m := newOpenAIModel(config)
+	m.url = joinURL(config.APIEndpoint, "/openai/deployments/"+url.PathEscape(deployment)+"/chat/completions") +
+		"?" + url.Values{"api-version": {apiVersion}}.Encode()
+	m.authorize = authorize
+
+	return &AzureOpenAIModel{
+		OpenAIModel: m,
+		deployment:  deployment,
+	}, nil
+}
+
+// Deployment 返回实际调用的部署名
+func (m *AzureOpenAIModel) Deployment() string {
+	return m.deployment
+}
+
+// azureDeployment 按deployments映射、deployment、ModelID的顺序确定部署名
+func azureDeployment(config ModelConfig) string {
+	if deployment, ok := config.OptionStringMap("deployments")[config.ModelID]; ok {
+		return deployment
+	}
+	if deployment := config.OptionString("deployment"); deployment != "" {
+		return deployment
+	}
+	return config.ModelID
+}
+
+// tokenFetcher 获取令牌及其过期时间
+type tokenFetcher func(ctx context.Context) (string, time.Time, error)
+
+// cachedToken 缓存令牌，过期前tokenRefreshMargin内重新获取
+type cachedToken struct {
+	fetch tokenFetcher
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// newCachedToken 创建带缓存的令牌提供者
+func newCachedToken(fetch tokenFetcher) TokenProvider {
+	c := &cachedToken{fetch: fetch}
+	return c.get
+}
+
+// get 返回缓存的令牌，即将过期时重新获取
+func (c *cachedToken) get(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Until(c.expires) > tokenRefreshMargin {
+		return c.token, nil
+	}
+
+	token, expires, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expires = token, expires
+	return token, nil
+}
+
+// managedIdentityToken 从实例元数据服务获取托管标识的Entra令牌
+func managedIdentityToken(config ModelConfig) tokenFetcher {
+	endpoint := config.OptionString("identity_endpoint")
+	if endpoint == "" {
+		endpoint = defaultAzureIdentityEndpoint
+	}
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureCognitiveResource}}
+	if clientID := config.OptionString("client_id"); clientID != "" {
+		query.Set("client_id", clientID)
+	}
+	client := newHTTPClient(config)
+
+	return func(ctx context.Context) (string, time.Time, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("创建请求失败: %w", err)
+		}
+		req.Header.Set("Metadata", "true")
+
+		var response struct {
+			AccessToken string `json:"access_token"`
+			ExpiresOn   string `json:"expires_on"` // Unix秒
+		}
+		if err := doJSON(client, req, &response); err != nil {
+			return "", time.Time{}, fmt.Errorf("获取托管标识令牌失败: %w", err)
+		}
+		if response.AccessToken == "" {
+			return "", time.Time{}, fmt.Errorf("托管标识令牌为空")
+		}
+
+		seconds, err := strconv.ParseInt(response.ExpiresOn, 10, 64)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("解析令牌过期时间失败: %w", err)
+		}
+		return response.AccessToken, time.Unix(seconds, 0), nil
+	}
+}
+
+// commandToken 执行命令获取Entra令牌
+//
+// 输出为az account get-access-token的JSON时按expires_on缓存，
+// 否则整段输出作为令牌缓存defaultTokenCommandTTL。
+func commandToken(command string) tokenFetcher {
+	return func(ctx context.Context) (string, time.Time, error) {
+		output, err := exec.CommandContext(ctx, "sh", "-c", command).Output()
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("执行令牌命令失败: %w", err)
+		}
+
+		var response struct {
+			AccessToken string `json:"accessToken"`
+			ExpiresOn   int64  `json:"expires_on"`
+		}
+		if json.Unmarshal(output, &response) == nil && response.AccessToken != "" {
+			expires := time.Now().Add(defaultTokenCommandTTL)
+			if response.ExpiresOn > 0 {
+				expires = time.Unix(response.ExpiresOn, 0)
+			}
+			return response.AccessToken, expires, nil
+		}
+
+		token := strings.TrimSpace(string(output))
+		if token == "" {
+			return "", time.Time{}, fmt.Errorf("令牌命令没有输出令牌")
+		}
+		return token, time.Now().Add(defaultTokenCommandTTL), nil
+	}
+}
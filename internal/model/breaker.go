@@ -0,0 +1,305 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// 熔断默认参数
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerOpenTimeout      = 30 // 秒
+	defaultBreakerHalfOpenRequests = 1
+)
+
+// ErrBreakerOpen 熔断器打开时快速失败
+var ErrBreakerOpen = errors.New("模型熔断中")
+
+// BreakerConfig 熔断器配置
+type BreakerConfig struct {
+	FailureThreshold int `json:"failure_threshold,omitempty"`  // 连续失败多少次后打开，默认5
+	OpenTimeout      int `json:"open_timeout,omitempty"`       // 打开后多久进入半开（秒），默认30
+	HalfOpenRequests int `json:"half_open_requests,omitempty"` // 半开时允许的试探请求数，默认1
+}
+
+// BreakerEvent 熔断器状态变化事件
+type BreakerEvent struct {
+	Model     string    `json:"model"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// BreakerStats 熔断器统计
+type BreakerStats struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`             // 当前连续失败次数
+	Trips     int64      `json:"trips"`                // 累计打开次数
+	Rejected  int64      `json:"rejected"`             // 熔断期间被拒绝的请求数
+	OpenUntil *time.Time `json:"open_until,omitempty"` // 打开状态下进入半开的时间
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// CircuitBreakerModel 带熔断器的模型包装
+//
+// 连续失败达到阈值后打开，期间请求直接返回ErrBreakerOpen而不再等待服务超时；
+// 超过打开时长后进入半开，放行少量试探请求，成功则关闭，失败则重新打开。
+// 调用方取消、4xx等请求自身的错误不计为失败。
+type CircuitBreakerModel struct {
+	Model
+	threshold   int
+	openTimeout time.Duration
+	halfOpenMax int
+	onChange    func(BreakerEvent)
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	probes    int
+	trips     int64
+	rejected  int64
+	lastError string
+}
+
+// NewCircuitBreakerModel 创建熔断器包装，onChange在状态变化时调用，可为nil
+func NewCircuitBreakerModel(m Model, config BreakerConfig, onChange func(BreakerEvent)) *CircuitBreakerModel {
+	threshold := config.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultBreakerFailureThreshold
+	}
+	openTimeout := config.OpenTimeout
+	if openTimeout <= 0 {
+		openTimeout = defaultBreakerOpenTimeout
+	}
+	halfOpenMax := config.HalfOpenRequests
+	if halfOpenMax <= 0 {
+		halfOpenMax = defaultBreakerHalfOpenRequests
+	}
+
+	return &CircuitBreakerModel{
+		Model:       m,
+		threshold:   threshold,
+		openTimeout: time.Duration(openTimeout) * time.Second,
+		halfOpenMax: halfOpenMax,
+		onChange:    onChange,
+		state:       BreakerClosed,
+	}
+}
+
+// Unwrap 返回被包装的模型
+func (m *CircuitBreakerModel) Unwrap() Model {
+	return m.Model
+}
+
+// Generate 生成文本响应
+func (m *CircuitBreakerModel) Generate(ctx context.Context, prompt string) (string, error) {
+	if err := m.allow(); err != nil {
+		return "", err
+	}
+	text, err := m.Model.Generate(ctx, prompt)
+	m.record(err)
+	return text, err
+}
+
+// Chat 以消息列表的形式生成响应
+func (m *CircuitBreakerModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	if err := m.allow(); err != nil {
+		return "", err
+	}
+	text, err := Chat(ctx, m.Model, messages, opts)
+	m.record(err)
+	return text, err
+}
+
+// GenerateStream 流式生成文本响应，流中途的错误同样计入失败
+func (m *CircuitBreakerModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	return m.stream(ctx, func() (<-chan Chunk, error) {
+		return Stream(ctx, m.Model, prompt)
+	})
+}
+
+// ChatStream 以消息列表的形式流式生成响应，流中途的错误同样计入失败
+func (m *CircuitBreakerModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	return m.stream(ctx, func() (<-chan Chunk, error) {
+		return StreamChat(ctx, m.Model, messages, opts)
+	})
+}
+
+// stream 在熔断器允许时建立流，并在流结束后记录结果
+func (m *CircuitBreakerModel) stream(ctx context.Context, open func() (<-chan Chunk, error)) (<-chan Chunk, error) {
+	if err := m.allow(); err != nil {
+		return nil, err
+	}
+
+	ch, err := open()
+	if err != nil {
+		m.record(err)
+		return nil, err
+	}
+
+	out := make(chan Chunk, cap(ch))
+	go func() {
+		defer close(out)
+		var streamErr error
+		for chunk := range ch {
+			if chunk.Err != nil {
+				streamErr = chunk.Err
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				streamErr = ctx.Err()
+			}
+		}
+		m.record(streamErr)
+	}()
+	return out, nil
+}
+
+// State 返回当前状态
+func (m *CircuitBreakerModel) State() string {
+	return m.Stats().State
+}
+
+// Stats 返回熔断器统计
+func (m *CircuitBreakerModel) Stats() BreakerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := BreakerStats{
+		State:     m.state,
+		Failures:  m.failures,
+		Trips:     m.trips,
+		Rejected:  m.rejected,
+		LastError: m.lastError,
+	}
+	if m.state == BreakerOpen {
+		until := m.openedAt.Add(m.openTimeout)
+		stats.OpenUntil = &until
+	}
+	return stats
+}
+
+// allow 判断是否放行请求，打开超时后转入半开
+func (m *CircuitBreakerModel) allow() error {
+	m.mu.Lock()
+
+	var event *BreakerEvent
+	if m.state == BreakerOpen && time.Since(m.openedAt) >= m.openTimeout {
+		event = m.transition(BreakerHalfOpen)
+	}
+
+	var err error
+	switch m.state {
+	case BreakerOpen:
+		err = fmt.Errorf("%w: %s 将于%s后重试", ErrBreakerOpen, m.Name(),
+			time.Until(m.openedAt.Add(m.openTimeout)).Round(time.Second))
+	case BreakerHalfOpen:
+		if m.probes >= m.halfOpenMax {
+			err = fmt.Errorf("%w: %s 正在试探恢复", ErrBreakerOpen, m.Name())
+		} else {
+			m.probes++
+		}
+	}
+	if err != nil {
+		m.rejected++
+	}
+	m.mu.Unlock()
+
+	m.notify(event)
+	return err
+}
+
+// record 根据调用结果更新状态
+func (m *CircuitBreakerModel) record(err error) {
+	m.mu.Lock()
+
+	var event *BreakerEvent
+	failed := breakerFailure(err)
+	if failed {
+		m.lastError = err.Error()
+	}
+
+	switch m.state {
+	case BreakerHalfOpen:
+		if m.probes > 0 {
+			m.probes--
+		}
+		if failed {
+			m.failures++
+			event = m.transition(BreakerOpen)
+		} else if err == nil {
+			m.failures = 0
+			event = m.transition(BreakerClosed)
+		}
+	case BreakerClosed:
+		if !failed {
+			if err == nil {
+				m.failures = 0
+			}
+			break
+		}
+		m.failures++
+		if m.failures >= m.threshold {
+			event = m.transition(BreakerOpen)
+		}
+	}
+	m.mu.Unlock()
+
+	m.notify(event)
+}
+
+// transition 切换状态并返回事件，调用方持有锁
+func (m *CircuitBreakerModel) transition(to string) *BreakerEvent {
+	event := &BreakerEvent{
+		Model:     m.Name(),
+		From:      m.state,
+		To:        to,
+		Failures:  m.failures,
+		LastError: m.lastError,
+		Time:      time.Now(),
+	}
+
+	m.state = to
+	m.probes = 0
+	if to == BreakerOpen {
+		m.openedAt = event.Time
+		m.trips++
+	}
+	return event
+}
+
+// notify 在锁外通知状态变化
+func (m *CircuitBreakerModel) notify(event *BreakerEvent) {
+	if event != nil && m.onChange != nil {
+		m.onChange(*event)
+	}
+}
+
+// breakerFailure 错误是否说明服务不可用：超时、连接失败、429和5xx；
+// 调用方取消、本地限流、模型不支持图片和其他4xx错误不计入
+func breakerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrRateLimitWait) || errors.Is(err, ErrVisionUnsupported) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return true
+}
@@ -0,0 +1,296 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缓存后端
+const (
+	CacheMemory   = "memory"
+	CacheDisk     = "disk"
+	CachePostgres = "postgres"
+)
+
+// 缓存默认参数
+const (
+	defaultCacheTTL        = 3600 // 秒
+	defaultCacheMaxEntries = 1000
+	defaultCacheTable      = "model_response_cache"
+)
+
+// CacheConfig 响应缓存配置
+type CacheConfig struct {
+	Backend     string `json:"backend,omitempty"`      // memory（默认）/disk/postgres
+	TTL         int    `json:"ttl,omitempty"`          // 过期时间（秒），默认3600，-1表示不过期
+	MaxEntries  int    `json:"max_entries,omitempty"`  // memory后端的最大条目数，默认1000
+	Dir         string `json:"dir,omitempty"`          // disk后端的目录
+	DatabaseURL string `json:"database_url,omitempty"` // postgres后端的连接地址，默认使用database配置
+	Table       string `json:"table,omitempty"`        // postgres后端的表名，默认model_response_cache
+	Force       bool   `json:"force,omitempty"`        // temperature大于0时也使用缓存
+}
+
+// CacheStats 缓存命中统计
+type CacheStats struct {
+	Backend  string `json:"backend"`
+	Hits     int64  `json:"hits"`
+	Misses   int64  `json:"misses"`
+	Bypassed int64  `json:"bypassed"` // 因temperature大于0未使用缓存的请求
+	Errors   int64  `json:"errors"`   // 读写存储失败的次数，失败时直接调用模型
+}
+
+// CachedModel 缓存生成结果的模型包装
+//
+// 缓存键由模型ID、规范化后的提示词/消息和生成参数计算。temperature大于0时输出不确定，
+// 默认不读写缓存，除非配置了Force。存储出错时不影响调用，只计入统计。
+type CachedModel struct {
+	Model
+	store   CacheStore
+	backend string
+	ttl     time.Duration
+	force   bool
+
+	mu    sync.Mutex
+	stats CacheStats
+}
+
+// NewCachedModel 创建缓存包装
+func NewCachedModel(m Model, store CacheStore, config CacheConfig) *CachedModel {
+	ttl := config.TTL
+	if ttl == 0 {
+		ttl = defaultCacheTTL
+	}
+
+	backend := config.Backend
+	if backend == "" {
+		backend = CacheMemory
+	}
+
+	return &CachedModel{
+		Model:   m,
+		store:   store,
+		backend: backend,
+		ttl:     time.Duration(ttl) * time.Second,
+		force:   config.Force,
+	}
+}
+
+// newCacheStore 按配置创建存储后端
+func newCacheStore(config CacheConfig) (CacheStore, error) {
+	switch config.Backend {
+	case "", CacheMemory:
+		maxEntries := config.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = defaultCacheMaxEntries
+		}
+		return NewMemoryCache(maxEntries), nil
+	case CacheDisk:
+		return NewDiskCache(config.Dir)
+	case CachePostgres:
+		if config.DatabaseURL == "" {
+			return nil, fmt.Errorf("postgres缓存需要配置数据库地址")
+		}
+		table := config.Table
+		if table == "" {
+			table = defaultCacheTable
+		}
+		pool, err := sharedPostgresPool(config.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		return NewPostgresCache(pool, table)
+	default:
+		return nil, fmt.Errorf("不支持的缓存后端: %s", config.Backend)
+	}
+}
+
+// Unwrap 返回被包装的模型
+func (m *CachedModel) Unwrap() Model {
+	return m.Model
+}
+
+// Generate 生成文本响应，命中缓存时直接返回
+func (m *CachedModel) Generate(ctx context.Context, prompt string) (string, error) {
+	config := m.Model.Config()
+	key, ok := m.key(config.Temperature, "generate", []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+	if !ok {
+		return m.Model.Generate(ctx, prompt)
+	}
+
+	if text, hit := m.get(ctx, key); hit {
+		return text, nil
+	}
+
+	text, err := m.Model.Generate(ctx, prompt)
+	if err == nil {
+		m.set(ctx, key, text)
+	}
+	return text, err
+}
+
+// Chat 以消息列表的形式生成响应，命中缓存时直接返回
+func (m *CachedModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	config := m.Model.Config()
+	key, ok := m.key(opts.temperature(config.Temperature), "chat", messages, opts)
+	if !ok {
+		return Chat(ctx, m.Model, messages, opts)
+	}
+
+	if text, hit := m.get(ctx, key); hit {
+		return text, nil
+	}
+
+	text, err := Chat(ctx, m.Model, messages, opts)
+	if err == nil {
+		m.set(ctx, key, text)
+	}
+	return text, err
+}
+
+// GenerateStream 流式生成文本响应，命中时一次性返回缓存内容，未命中时在流正常结束后写入缓存
+func (m *CachedModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	config := m.Model.Config()
+	key, ok := m.key(config.Temperature, "generate", []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+	return m.stream(ctx, key, ok, func() (<-chan Chunk, error) {
+		return Stream(ctx, m.Model, prompt)
+	})
+}
+
+// ChatStream 以消息列表的形式流式生成响应，与Chat共用缓存键
+func (m *CachedModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	config := m.Model.Config()
+	key, ok := m.key(opts.temperature(config.Temperature), "chat", messages, opts)
+	return m.stream(ctx, key, ok, func() (<-chan Chunk, error) {
+		return StreamChat(ctx, m.Model, messages, opts)
+	})
+}
+
+// stream 命中时一次性返回缓存内容，未命中时建立流并在正常结束后写入缓存
+func (m *CachedModel) stream(ctx context.Context, key string, ok bool, open func() (<-chan Chunk, error)) (<-chan Chunk, error) {
+	if !ok {
+		return open()
+	}
+
+	if text, hit := m.get(ctx, key); hit {
+		return completeStream(text), nil
+	}
+
+	ch, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Chunk, cap(ch))
+	go func() {
+		defer close(out)
+		var sb strings.Builder
+		complete := true
+		for chunk := range ch {
+			if chunk.Err != nil {
+				complete = false
+			}
+			sb.WriteString(chunk.Content)
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				complete = false
+			}
+		}
+		if complete {
+			m.set(context.Background(), key, sb.String())
+		}
+	}()
+	return out, nil
+}
+
+// Stats 返回缓存统计
+func (m *CachedModel) Stats() CacheStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Backend = m.backend
+	return stats
+}
+
+// cacheKeyInput 参与计算缓存键的内容
+type cacheKeyInput struct {
+	ModelID     string    `json:"model_id"`
+	Kind        string    `json:"kind"`
+	Messages    []Message `json:"messages"`
+	Temperature float64   `json:"temperature"`
+	MaxTokens   int       `json:"max_tokens"`
+	Stop        []string  `json:"stop,omitempty"`
+	Seed        *int      `json:"seed,omitempty"`
+	JSONMode    bool      `json:"json_mode,omitempty"`
+}
+
+// key 计算缓存键；temperature大于0且未强制缓存时返回false
+func (m *CachedModel) key(temperature float64, kind string, messages []Message, opts ChatOptions) (string, bool) {
+	if temperature > 0 && !m.force {
+		m.count(func(s *CacheStats) { s.Bypassed++ })
+		return "", false
+	}
+
+	config := m.Model.Config()
+	normalized := make([]Message, len(messages))
+	for i, msg := range messages {
+		msg.Content = normalizePrompt(msg.Content)
+		normalized[i] = msg
+	}
+
+	data, _ := json.Marshal(cacheKeyInput{
+		ModelID:     config.ModelID,
+		Kind:        kind,
+		Messages:    normalized,
+		Temperature: temperature,
+		MaxTokens:   opts.maxTokens(config.MaxTokens),
+		Stop:        opts.Stop,
+		Seed:        opts.Seed,
+		JSONMode:    opts.JSONMode,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// get 读取缓存并计数
+func (m *CachedModel) get(ctx context.Context, key string) (string, bool) {
+	text, hit, err := m.store.Get(ctx, key)
+	m.count(func(s *CacheStats) {
+		switch {
+		case err != nil:
+			s.Errors++
+			s.Misses++
+		case hit:
+			s.Hits++
+		default:
+			s.Misses++
+		}
+	})
+	return text, hit && err == nil
+}
+
+// set 写入缓存，失败只计数
+func (m *CachedModel) set(ctx context.Context, key, text string) {
+	if err := m.store.Set(ctx, key, text, m.ttl); err != nil {
+		m.count(func(s *CacheStats) { s.Errors++ })
+	}
+}
+
+// count 更新统计
+func (m *CachedModel) count(update func(s *CacheStats)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	update(&m.stats)
+}
+
+// normalizePrompt 去掉首尾空白并把连续空白折叠为一个空格，使排版差异不影响命中
+func normalizePrompt(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,287 @@
+package model
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CacheStore 响应缓存的存储后端
+type CacheStore interface {
+	// Get 读取未过期的缓存
+	Get(ctx context.Context, key string) (string, bool, error)
+
+	// Set 写入缓存，ttl为0表示不过期
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+}
+
+// expiresAt 根据ttl计算过期时间，ttl为0时返回零值
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// expired 判断过期时间是否已到，零值表示不过期
+func expired(at time.Time) bool {
+	return !at.IsZero() && time.Now().After(at)
+}
+
+// memoryEntry 内存缓存条目
+type memoryEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// MemoryCache 按最近使用淘汰的内存缓存
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // 队首为最近使用
+}
+
+// NewMemoryCache 创建内存LRU缓存，maxEntries为0表示不限
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get 读取未过期的缓存
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return "", false, nil
+	}
+
+	entry := elem.Value.(*memoryEntry)
+	if expired(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return "", false, nil
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set 写入缓存，超出容量时淘汰最久未使用的条目
+func (c *MemoryCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt(ttl)
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, value: value, expiresAt: expiresAt(ttl)})
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Len 返回缓存条目数
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// diskEntry 磁盘缓存文件内容
+type diskEntry struct {
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// DiskCache 每个键一个JSON文件的磁盘缓存，重启后仍然有效
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache 创建磁盘缓存，目录不存在时自动创建
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("磁盘缓存需要配置目录")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %w", err)
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// Get 读取未过期的缓存，过期的文件会被删除
+func (c *DiskCache) Get(ctx context.Context, key string) (string, bool, error) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("读取缓存文件失败: %w", err)
+	}
+
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return "", false, fmt.Errorf("解析缓存文件失败: %w", err)
+	}
+	if expired(entry.ExpiresAt) {
+		os.Remove(path)
+		return "", false, nil
+	}
+
+	return entry.Value, true, nil
+}
+
+// Set 写入缓存，先写临时文件再重命名，避免读到不完整的内容
+func (c *DiskCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	data, err := json.Marshal(diskEntry{Value: value, ExpiresAt: expiresAt(ttl)})
+	if err != nil {
+		return fmt.Errorf("序列化缓存失败: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("创建缓存文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入缓存文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入缓存文件失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("写入缓存文件失败: %w", err)
+	}
+	return nil
+}
+
+// path 返回键对应的文件路径，键为十六进制摘要，可直接作为文件名
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// tableNamePattern 合法的缓存表名
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PostgresCache 存储在PostgreSQL表中的缓存，可在多个实例间共享
+type PostgresCache struct {
+	pool  *pgxpool.Pool
+	table string
+}
+
+// NewPostgresCache 使用已有连接池创建缓存，并确保缓存表存在
+func NewPostgresCache(pool *pgxpool.Pool, table string) (*PostgresCache, error) {
+	if !tableNamePattern.MatchString(table) {
+		return nil, fmt.Errorf("无效的缓存表名: %s", table)
+	}
+
+	schemaSQL := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			expires_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_%s_expires_at ON %s (expires_at);
+	`, table, table, table)
+
+	if _, err := pool.Exec(context.Background(), schemaSQL); err != nil {
+		return nil, fmt.Errorf("初始化缓存表失败: %w", err)
+	}
+
+	return &PostgresCache{pool: pool, table: table}, nil
+}
+
+// Get 读取未过期的缓存
+func (c *PostgresCache) Get(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	err := c.pool.QueryRow(ctx,
+		fmt.Sprintf("SELECT value FROM %s WHERE key = $1 AND (expires_at IS NULL OR expires_at > NOW())", c.table),
+		key).Scan(&value)
+	if err == pgx.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("查询缓存失败: %w", err)
+	}
+	return value, true, nil
+}
+
+// Set 写入缓存
+func (c *PostgresCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	var expires *time.Time
+	if ttl > 0 {
+		at := expiresAt(ttl)
+		expires = &at
+	}
+
+	_, err := c.pool.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (key, value, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at, created_at = NOW()
+	`, c.table), key, value, expires)
+	if err != nil {
+		return fmt.Errorf("写入缓存失败: %w", err)
+	}
+	return nil
+}
+
+// Purge 删除已过期的缓存
+func (c *PostgresCache) Purge(ctx context.Context) (int64, error) {
+	tag, err := c.pool.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at <= NOW()", c.table))
+	if err != nil {
+		return 0, fmt.Errorf("清理缓存失败: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// postgresPools 按数据库地址共享的连接池，多个模型的缓存共用
+var postgresPools = struct {
+	sync.Mutex
+	pools map[string]*pgxpool.Pool
+}{pools: make(map[string]*pgxpool.Pool)}
+
+// sharedPostgresPool 返回数据库地址对应的连接池，不存在时创建
+func sharedPostgresPool(databaseURL string) (*pgxpool.Pool, error) {
+	postgresPools.Lock()
+	defer postgresPools.Unlock()
+
+	if pool, ok := postgresPools.pools[databaseURL]; ok {
+		return pool, nil
+	}
+
+	pool, err := pgxpool.New(context.Background(), databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("创建连接池失败: %w", err)
+	}
+	postgresPools.pools[databaseURL] = pool
+	return pool, nil
+}
@@ -0,0 +1,254 @@
+package model
+
+import (
+	"strings"
+)
+
+// 输入模态
+const (
+	ModalityText  = "text"
+	ModalityImage = "image"
+)
+
+// Pricing 每百万token的价格
+type Pricing struct {
+	Input    float64 `json:"input"`
+	Output   float64 `json:"output"`
+	Currency string  `json:"currency"` // USD或CNY
+}
+
+// Capabilities 模型能力描述
+type Capabilities struct {
+	ContextWindow   int      `json:"context_window"`    // 上下文窗口（输入和输出token之和），0表示未知
+	MaxOutputTokens int      `json:"max_output_tokens"` // 单次最大输出token数
+	Modalities      []string `json:"modalities"`        // 可通过消息发送的输入类型
+	Streaming       bool     `json:"streaming"`
+	ToolCalling     bool     `json:"tool_calling"`
+	JSONMode        bool     `json:"json_mode"` // 支持ChatOptions.JSONMode强制输出JSON
+	Pricing         *Pricing `json:"pricing,omitempty"`
+}
+
+// HasModality 是否接受该类型的输入
+func (c Capabilities) HasModality(modality string) bool {
+	for _, m := range c.Modalities {
+		if m == modality {
+			return true
+		}
+	}
+	return false
+}
+
+// Cost 按价格计算用量的费用，未知价格时返回0
+func (c Capabilities) Cost(usage Usage) float64 {
+	if c.Pricing == nil {
+		return 0
+	}
+	return (float64(usage.InputTokens)*c.Pricing.Input + float64(usage.OutputTokens)*c.Pricing.Output) / 1e6
+}
+
+// CapabilityOverrides 实例级的能力覆盖，未设置的字段沿用模型类型的描述；
+// 是否接受图片由ModelConfig.Vision控制
+type CapabilityOverrides struct {
+	ContextWindow   int      `json:"context_window,omitempty"`
+	MaxOutputTokens int      `json:"max_output_tokens,omitempty"`
+	ToolCalling     *bool    `json:"tool_calling,omitempty"`
+	JSONMode        *bool    `json:"json_mode,omitempty"`
+	Pricing         *Pricing `json:"pricing,omitempty"`
+}
+
+// apply 用覆盖项更新能力描述
+func (c Capabilities) apply(o *CapabilityOverrides) Capabilities {
+	if o == nil {
+		return c
+	}
+	if o.ContextWindow > 0 {
+		c.ContextWindow = o.ContextWindow
+	}
+	if o.MaxOutputTokens > 0 {
+		c.MaxOutputTokens = o.MaxOutputTokens
+	}
+	if o.ToolCalling != nil {
+		c.ToolCalling = *o.ToolCalling
+	}
+	if o.JSONMode != nil {
+		c.JSONMode = *o.JSONMode
+	}
+	if o.Pricing != nil {
+		c.Pricing = o.Pricing
+	}
+	return c
+}
+
+// 内置能力描述用到的模态组合
+var (
+	textOnly  = []string{ModalityText}
+	textImage = []string{ModalityText, ModalityImage}
+)
+
+// defaultCapabilities 未知模型的描述，上下文窗口未知时不裁剪历史
+var defaultCapabilities = Capabilities{Modalities: textOnly, Streaming: true}
+
+// builtinCapabilities 内置的能力描述，键为模型ID前缀，按最长前缀匹配。
+// 价格为发布时的公开标价，可通过RegisterCapabilities或配置覆盖。
+var builtinCapabilities = map[string]Capabilities{
+	// OpenAI
+	"gpt-3.5-turbo": {ContextWindow: 16385, MaxOutputTokens: 4096, Modalities: textOnly, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{0.5, 1.5, "USD"}},
+	"gpt-4":         {ContextWindow: 8192, MaxOutputTokens: 4096, Modalities: textOnly, Streaming: true, ToolCalling: true, Pricing: &Pricing{30, 60, "USD"}},
+	"gpt-4-turbo":   {ContextWindow: 128000, MaxOutputTokens: 4096, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{10, 30, "USD"}},
+	"gpt-4o":        {ContextWindow: 128000, MaxOutputTokens: 16384, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{2.5, 10, "USD"}},
+	"gpt-4o-mini":   {ContextWindow: 128000, MaxOutputTokens: 16384, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{0.15, 0.6, "USD"}},
+	"chatgpt-4o":    {ContextWindow: 128000, MaxOutputTokens: 16384, Modalities: textImage, Streaming: true, JSONMode: true, Pricing: &Pricing{5, 15, "USD"}},
+	"gpt-4.1":       {ContextWindow: 1047576, MaxOutputTokens: 32768, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{2, 8, "USD"}},
+	"gpt-4.1-mini":  {ContextWindow: 1047576, MaxOutputTokens: 32768, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{0.4, 1.6, "USD"}},
+	"gpt-5":         {ContextWindow: 400000, MaxOutputTokens: 128000, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{1.25, 10, "USD"}},
+	"o1":            {ContextWindow: 200000, MaxOutputTokens: 100000, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{15, 60, "USD"}},
+	"o1-mini":       {ContextWindow: 128000, MaxOutputTokens: 65536, Modalities: textOnly, Streaming: true, Pricing: &Pricing{1.1, 4.4, "USD"}},
+	"o3":            {ContextWindow: 200000, MaxOutputTokens: 100000, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{2, 8, "USD"}},
+	"o3-mini":       {ContextWindow: 200000, MaxOutputTokens: 100000, Modalities: textOnly, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{1.1, 4.4, "USD"}},
+	"o4-mini":       {ContextWindow: 200000, MaxOutputTokens: 100000, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{1.1, 4.4, "USD"}},
+
+	// Anthropic（图片需通过CreateMessage发送，消息接口只支持文本）
+	"claude":            {ContextWindow: 200000, MaxOutputTokens: 4096, Modalities: textOnly, Streaming: true, ToolCalling: true},
+	"claude-3-haiku":    {ContextWindow: 200000, MaxOutputTokens: 4096, Modalities: textOnly, Streaming: true, ToolCalling: true, Pricing: &Pricing{0.25, 1.25, "USD"}},
+	"claude-3-opus":     {ContextWindow: 200000, MaxOutputTokens: 4096, Modalities: textOnly, Streaming: true, ToolCalling: true, Pricing: &Pricing{15, 75, "USD"}},
+	"claude-3-5-haiku":  {ContextWindow: 200000, MaxOutputTokens: 8192, Modalities: textOnly, Streaming: true, ToolCalling: true, Pricing: &Pricing{0.8, 4, "USD"}},
+	"claude-3-5-sonnet": {ContextWindow: 200000, MaxOutputTokens: 8192, Modalities: textOnly, Streaming: true, ToolCalling: true, Pricing: &Pricing{3, 15, "USD"}},
+	"claude-3-7-sonnet": {ContextWindow: 200000, MaxOutputTokens: 64000, Modalities: textOnly, Streaming: true, ToolCalling: true, Pricing: &Pricing{3, 15, "USD"}},
+	"claude-sonnet-4":   {ContextWindow: 200000, MaxOutputTokens: 64000, Modalities: textOnly, Streaming: true, ToolCalling: true, Pricing: &Pricing{3, 15, "USD"}},
+	"claude-opus-4":     {ContextWindow: 200000, MaxOutputTokens: 32000, Modalities: textOnly, Streaming: true, ToolCalling: true, Pricing: &Pricing{15, 75, "USD"}},
+
+	// Google Gemini（消息中的图片作为inlineData/fileData部分发送）
+	"gemini":           {ContextWindow: 1048576, MaxOutputTokens: 8192, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true},
+	"gemini-1.5-pro":   {ContextWindow: 2097152, MaxOutputTokens: 8192, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{1.25, 5, "USD"}},
+	"gemini-1.5-flash": {ContextWindow: 1048576, MaxOutputTokens: 8192, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{0.075, 0.3, "USD"}},
+	"gemini-2.0-flash": {ContextWindow: 1048576, MaxOutputTokens: 8192, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{0.1, 0.4, "USD"}},
+	"gemini-2.5-pro":   {ContextWindow: 1048576, MaxOutputTokens: 65536, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{1.25, 10, "USD"}},
+	"gemini-2.5-flash": {ContextWindow: 1048576, MaxOutputTokens: 65536, Modalities: textImage, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{0.3, 2.5, "USD"}},
+
+	// 阿里云通义千问
+	"qwen":         {ContextWindow: 131072, MaxOutputTokens: 8192, Modalities: textOnly, Streaming: true, ToolCalling: true, JSONMode: true},
+	"qwen-turbo":   {ContextWindow: 131072, MaxOutputTokens: 8192, Modalities: textOnly, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{0.3, 0.6, "CNY"}},
+	"qwen-plus":    {ContextWindow: 131072, MaxOutputTokens: 8192, Modalities: textOnly, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{0.8, 2, "CNY"}},
+	"qwen-max":     {ContextWindow: 32768, MaxOutputTokens: 8192, Modalities: textOnly, Streaming: true, ToolCalling: true, JSONMode: true, Pricing: &Pricing{2.4, 9.6, "CNY"}},
+	"qwen-vl":      {ContextWindow: 131072, MaxOutputTokens: 8192, Modalities: textImage, Streaming: true},
+	"qwen-vl-plus": {ContextWindow: 131072, MaxOutputTokens: 8192, Modalities: textImage, Streaming: true, Pricing: &Pricing{1.5, 4.5, "CNY"}},
+	"qwen-vl-max":  {ContextWindow: 131072, MaxOutputTokens: 8192, Modalities: textImage, Streaming: true, Pricing: &Pricing{3, 9, "CNY"}},
+	"qwen2-vl":     {ContextWindow: 32768, MaxOutputTokens: 2048, Modalities: textImage, Streaming: true},
+	"qwen2.5-vl":   {ContextWindow: 131072, MaxOutputTokens: 8192, Modalities: textImage, Streaming: true},
+	"qvq":          {ContextWindow: 131072, MaxOutputTokens: 8192, Modalities: textImage, Streaming: true},
+
+	// 本地模型
+	"llama":  {ContextWindow: 4096, MaxOutputTokens: 2048, Modalities: textOnly, Streaming: true},
+	"llama3": {ContextWindow: 8192, MaxOutputTokens: 2048, Modalities: textOnly, Streaming: true},
+}
+
+// providerCapabilities 模型ID未匹配时按提供方使用的描述
+var providerCapabilities = map[string]Capabilities{
+	"openai":    builtinCapabilities["gpt-3.5-turbo"],
+	"anthropic": builtinCapabilities["claude-3-5-sonnet"],
+	"ollama":    {ContextWindow: 4096, Modalities: textOnly, Streaming: true, JSONMode: true},
+}
+
+// RegisterCapabilities 注册模型类型的能力描述，name为模型ID前缀，覆盖内置描述
+func (r *ModelRegistry) RegisterCapabilities(name string, caps Capabilities) {
+	r.capsMu.Lock()
+	defer r.capsMu.Unlock()
+	r.capabilities[strings.ToLower(name)] = caps
+}
+
+// TypeCapabilities 返回模型类型的能力描述：按模型ID最长前缀匹配，其次按提供方名称，都没有时返回保守的默认值
+func (r *ModelRegistry) TypeCapabilities(modelID, provider string) Capabilities {
+	r.capsMu.RLock()
+	defer r.capsMu.RUnlock()
+
+	// 兼容openai/gpt-4o这样带提供方前缀的写法
+	id := strings.ToLower(modelID[strings.LastIndex(modelID, "/")+1:])
+
+	best := ""
+	for prefix := range r.capabilities {
+		if len(prefix) > len(best) && strings.HasPrefix(id, prefix) {
+			best = prefix
+		}
+	}
+	if best != "" {
+		return r.capabilities[best]
+	}
+	if caps, ok := providerCapabilities[strings.ToLower(provider)]; ok {
+		return caps
+	}
+	return defaultCapabilities
+}
+
+// ModelCapabilities 返回模型实例的能力描述：类型描述叠加实例配置的覆盖项，
+// 流式和图片输入按实例实际支持的情况确定；回退链取所有成员都具备的能力
+func (r *ModelRegistry) ModelCapabilities(m Model) Capabilities {
+	if fallback, ok := m.(*FallbackModel); ok {
+		return r.fallbackCapabilities(fallback)
+	}
+
+	config := m.Config()
+	caps := r.TypeCapabilities(config.ModelID, config.Provider).apply(config.Capabilities)
+	caps.Streaming = supportsStreaming(m)
+	caps.Modalities = textOnly
+	if SupportsVision(m) {
+		caps.Modalities = textImage
+	}
+	return caps
+}
+
+// fallbackCapabilities 回退链的能力：窗口和输出取最小值，其他能力取交集，价格沿用首个成员
+func (r *ModelRegistry) fallbackCapabilities(fallback *FallbackModel) Capabilities {
+	var caps Capabilities
+	for i, member := range fallback.Models() {
+		memberCaps := r.ModelCapabilities(member)
+		if i == 0 {
+			caps = memberCaps
+			continue
+		}
+		caps.ContextWindow = minPositive(caps.ContextWindow, memberCaps.ContextWindow)
+		caps.MaxOutputTokens = minPositive(caps.MaxOutputTokens, memberCaps.MaxOutputTokens)
+		caps.Streaming = caps.Streaming && memberCaps.Streaming
+		caps.ToolCalling = caps.ToolCalling && memberCaps.ToolCalling
+		caps.JSONMode = caps.JSONMode && memberCaps.JSONMode
+	}
+	caps.Modalities = textOnly
+	if fallback.SupportsVision() {
+		caps.Modalities = textImage
+	}
+	return caps
+}
+
+// minPositive 返回两个值中较小的正数，0表示未知
+func minPositive(a, b int) int {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// supportsStreaming 模型是否原生支持流式生成，依次展开包装模型；池要求所有成员都支持
+func supportsStreaming(m Model) bool {
+	switch v := m.(type) {
+	case *PoolModel:
+		for _, member := range v.members {
+			if !supportsStreaming(member.model) {
+				return false
+			}
+		}
+		return true
+	case Unwrapper:
+		return supportsStreaming(v.Unwrap())
+	}
+	_, ok := m.(StreamingModel)
+	return ok
+}
+
+// ModelCapabilities 返回全局注册表中模型实例的能力描述
+func ModelCapabilities(m Model) Capabilities {
+	return GlobalRegistry.ModelCapabilities(m)
+}
+
+// RegisterCapabilities 向全局注册表注册模型类型的能力描述
+func RegisterCapabilities(name string, caps Capabilities) {
+	GlobalRegistry.RegisterCapabilities(name, caps)
+}
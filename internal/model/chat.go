@@ -0,0 +1,238 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// 消息角色
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// ChatOptions 单次调用的生成参数，零值表示沿用模型配置
+type ChatOptions struct {
+	Temperature *float64 // 为nil时使用模型配置的温度
+	MaxTokens   int
+	Stop        []string
+	Seed        *int
+	JSONMode    bool // 要求输出单个JSON对象，模型需支持JSON模式（见Capabilities.JSONMode），不支持时忽略
+}
+
+// isZero 是否没有设置任何调用参数
+func (o ChatOptions) isZero() bool {
+	return o.Temperature == nil && o.MaxTokens == 0 && len(o.Stop) == 0 && o.Seed == nil && !o.JSONMode
+}
+
+// temperature 返回本次调用的温度
+func (o ChatOptions) temperature(fallback float64) float64 {
+	if o.Temperature != nil {
+		return *o.Temperature
+	}
+	return fallback
+}
+
+// requestTemperature 返回请求中的温度：调用参数显式设置（包括0）或模型配置大于0时发送，否则为nil由服务端决定
+func (o ChatOptions) requestTemperature(fallback float64) *float64 {
+	if o.Temperature == nil && fallback <= 0 {
+		return nil
+	}
+	t := o.temperature(fallback)
+	return &t
+}
+
+// responseFormat 返回OpenAI/DashScope的response_format参数
+func (o ChatOptions) responseFormat() *ResponseFormat {
+	if !o.JSONMode {
+		return nil
+	}
+	return &ResponseFormat{Type: "json_object"}
+}
+
+// ResponseFormat OpenAI和DashScope的输出格式参数
+type ResponseFormat struct {
+	Type string `json:"type"` // text或json_object
+}
+
+// maxTokens 返回本次调用的最大token数
+func (o ChatOptions) maxTokens(fallback int) int {
+	if o.MaxTokens > 0 {
+		return o.MaxTokens
+	}
+	return fallback
+}
+
+// Usage token用量
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// add 累加用量
+func (u *Usage) add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+}
+
+// UsageReporter 能报告累计token用量的模型
+type UsageReporter interface {
+	// Usage 返回模型实例创建以来的累计用量
+	Usage() Usage
+}
+
+// usageCounter 线程安全的累计用量，嵌入到模型实现中提供UsageReporter
+type usageCounter struct {
+	mu    sync.Mutex
+	usage Usage
+}
+
+// Usage 返回累计token用量
+func (c *usageCounter) Usage() Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage
+}
+
+// recordUsage 累加一次调用的用量
+func (c *usageCounter) recordUsage(u Usage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.usage.add(u)
+}
+
+// ChatModel 支持多轮消息输入的模型
+type ChatModel interface {
+	Model
+
+	// Chat 以消息列表（system/user/assistant/tool）的形式生成响应
+	Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error)
+}
+
+// Chat 以消息列表生成响应；模型不支持消息输入时按通用模板拼接为提示词
+//
+// 消息带图片而模型未声明视觉能力时返回ErrVisionUnsupported。
+func Chat(ctx context.Context, m Model, messages []Message, opts ChatOptions) (string, error) {
+	if err := CheckImages(m, messages); err != nil {
+		return "", err
+	}
+	if cm, ok := m.(ChatModel); ok {
+		return cm.Chat(ctx, messages, opts)
+	}
+	if len(messages) == 1 && messages[0].Role == RoleUser {
+		return m.Generate(ctx, messages[0].Content)
+	}
+	return m.Generate(ctx, RenderChatTemplate(genericChatTemplate, messages))
+}
+
+// ChatTemplate 把消息列表渲染为单个提示词的对话模板
+type ChatTemplate struct {
+	Name   string
+	Render func(messages []Message) string
+	Stop   []string // 模板对应的结束标记
+}
+
+// 内置对话模板
+var (
+	genericChatTemplate = ChatTemplate{Name: "generic", Render: renderGeneric}
+	llama2ChatTemplate  = ChatTemplate{Name: "llama2", Render: renderLlama2}
+	llama3ChatTemplate  = ChatTemplate{Name: "llama3", Render: renderLlama3, Stop: []string{"<|eot_id|>"}}
+)
+
+// ChatTemplateFor 根据模型ID选择对话模板，未识别的模型使用通用模板
+func ChatTemplateFor(modelID string) ChatTemplate {
+	id := strings.ToLower(modelID)
+	switch {
+	case strings.Contains(id, "llama3") || strings.Contains(id, "llama-3"):
+		return llama3ChatTemplate
+	case strings.Contains(id, "llama"):
+		return llama2ChatTemplate
+	default:
+		return genericChatTemplate
+	}
+}
+
+// RenderChatTemplate 按模板把消息列表渲染为提示词
+func RenderChatTemplate(t ChatTemplate, messages []Message) string {
+	return t.Render(messages)
+}
+
+// renderGeneric 通用的"角色: 内容"模板
+func renderGeneric(messages []Message) string {
+	var sb strings.Builder
+	for _, msg := range messages {
+		sb.WriteString(roleLabel(msg) + ": " + msg.Content + "\n\n")
+	}
+	sb.WriteString(RoleAssistant + ": ")
+	return sb.String()
+}
+
+// renderLlama3 Llama 3的header token模板
+func renderLlama3(messages []Message) string {
+	var sb strings.Builder
+	sb.WriteString("<|begin_of_text|>")
+	for _, msg := range messages {
+		role := msg.Role
+		if role == RoleTool {
+			role = "ipython"
+		}
+		sb.WriteString("<|start_header_id|>" + role + "<|end_header_id|>\n\n" + msg.Content + "<|eot_id|>")
+	}
+	sb.WriteString("<|start_header_id|>assistant<|end_header_id|>\n\n")
+	return sb.String()
+}
+
+// renderLlama2 Llama 2的[INST]/<<SYS>>模板，system消息并入第一轮user消息
+func renderLlama2(messages []Message) string {
+	var sb strings.Builder
+	var system []string
+	open := false
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem:
+			system = append(system, msg.Content)
+		case RoleAssistant:
+			if open {
+				sb.WriteString(" [/INST] ")
+				open = false
+			}
+			sb.WriteString(msg.Content + " </s>")
+		default:
+			content := msg.Content
+			if msg.Role == RoleTool {
+				content = roleLabel(msg) + ": " + content
+			}
+			if open {
+				sb.WriteString("\n\n" + content)
+				continue
+			}
+			sb.WriteString("<s>[INST] ")
+			if len(system) > 0 {
+				sb.WriteString("<<SYS>>\n" + strings.Join(system, "\n") + "\n<</SYS>>\n\n")
+				system = nil
+			}
+			sb.WriteString(content)
+			open = true
+		}
+	}
+
+	if open {
+		sb.WriteString(" [/INST]")
+	}
+	return sb.String()
+}
+
+// roleLabel 消息的角色标签，tool消息附带调用ID
+func roleLabel(msg Message) string {
+	label := msg.Role
+	if msg.Name != "" {
+		label += "(" + msg.Name + ")"
+	} else if msg.ToolCallID != "" {
+		label += "(" + msg.ToolCallID + ")"
+	}
+	return label
+}
@@ -0,0 +1,83 @@
+package model
+
+import "sort"
+
+// InstanceInfo 已创建模型实例的描述，用于模型管理接口展示
+type InstanceInfo struct {
+	Name      string            `json:"name"`
+	ModelID   string            `json:"model_id,omitempty"`
+	Provider  string            `json:"provider,omitempty"`
+	Fallback  []string          `json:"fallback,omitempty"`
+	Pool      []PoolMemberStats `json:"pool,omitempty"`
+	RateLimit *RateLimitStats   `json:"rate_limit,omitempty"`
+	Breaker   *BreakerStats     `json:"breaker,omitempty"`
+	Cache     *CacheStats       `json:"cache,omitempty"`
+	Usage     *Usage            `json:"usage,omitempty"`
+
+	Capabilities Capabilities `json:"capabilities"`
+	Cost         *float64     `json:"cost,omitempty"` // 按价格估算的累计费用，币种见capabilities.pricing
+}
+
+// DescribeModel 描述模型实例，包括能力描述、回退链成员、池成员统计、限流、熔断和缓存统计以及累计用量
+//
+// 依次展开包装模型（Unwrapper），收集每一层的统计。
+func DescribeModel(m Model) InstanceInfo {
+	config := m.Config()
+	info := InstanceInfo{
+		Name:         m.Name(),
+		ModelID:      config.ModelID,
+		Provider:     config.Provider,
+		Fallback:     config.Fallback,
+		Capabilities: ModelCapabilities(m),
+	}
+
+	for current := m; current != nil; {
+		switch v := current.(type) {
+		case *PoolModel:
+			info.Pool = v.Stats()
+		case *RateLimitedModel:
+			stats := v.Stats()
+			info.RateLimit = &stats
+		case *CircuitBreakerModel:
+			stats := v.Stats()
+			info.Breaker = &stats
+		case *CachedModel:
+			stats := v.Stats()
+			info.Cache = &stats
+		}
+
+		if reporter, ok := current.(UsageReporter); ok && info.Usage == nil {
+			usage := reporter.Usage()
+			info.Usage = &usage
+		}
+
+		wrapper, ok := current.(Unwrapper)
+		if !ok {
+			break
+		}
+		current = wrapper.Unwrap()
+	}
+
+	if info.Usage != nil && info.Capabilities.Pricing != nil {
+		cost := info.Capabilities.Cost(*info.Usage)
+		info.Cost = &cost
+	}
+
+	return info
+}
+
+// Instances 返回所有已创建的模型实例，按名称排序
+func (r *ModelRegistry) Instances() []Model {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	instances := make([]Model, 0, len(r.models))
+	for _, m := range r.models {
+		instances = append(instances, m)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Name() < instances[j].Name()
+	})
+
+	return instances
+}
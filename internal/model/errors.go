@@ -0,0 +1,245 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 错误类别，用于决定是否回退到其他模型
+const (
+	ErrorClassTimeout       = "timeout"        // 请求超时
+	ErrorClassRateLimit     = "rate_limit"     // 429
+	ErrorClassServer        = "server"         // 5xx
+	ErrorClassContextLength = "context_length" // 提示词超出上下文长度
+)
+
+// 按错误性质分类的哨兵错误，可用errors.Is判断APIError
+var (
+	ErrAuthentication = errors.New("认证失败")  // 401/403
+	ErrRateLimited    = errors.New("请求被限流") // 429
+	ErrInvalidRequest = errors.New("请求无效")  // 其他4xx
+	ErrContextLength  = errors.New("提示词超出上下文长度")
+	ErrServer         = errors.New("服务端错误") // 5xx
+)
+
+// APIError 模型服务返回的非2xx响应
+//
+// Type、Code、Message从各服务商的错误响应体中解析：OpenAI/Azure/Gemini的
+// {"error": {...}}、Anthropic的{"type": "error", "error": {...}}、
+// DashScope的{"code", "message"}以及Ollama的{"error": "..."}。
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+
+	Type       string        // 错误类型，如invalid_request_error、overloaded_error、INVALID_ARGUMENT
+	Code       string        // 错误码，如context_length_exceeded、InvalidApiKey
+	Message    string        // 服务商返回的错误信息
+	RequestID  string        // 服务商的请求ID，便于排查
+	RetryAfter time.Duration // Retry-After响应头，未返回时为0
+}
+
+// Error 实现error接口
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API请求失败: %s - %s", e.Status, e.Body)
+	}
+
+	detail := e.Message
+	if kind := e.kind(); kind != "" {
+		detail = fmt.Sprintf("[%s] %s", kind, e.Message)
+	}
+	return fmt.Sprintf("API请求失败: %s - %s", e.Status, detail)
+}
+
+// Is 使errors.Is可以按哨兵错误判断错误性质
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrAuthentication:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrContextLength:
+		return e.contextLength()
+	case ErrInvalidRequest:
+		return e.StatusCode >= 400 && e.StatusCode < 500 && !errors.Is(e, ErrAuthentication) && !errors.Is(e, ErrRateLimited)
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// kind 返回错误类型和错误码的组合
+func (e *APIError) kind() string {
+	switch {
+	case e.Type != "" && e.Code != "" && e.Type != e.Code:
+		return e.Type + "/" + e.Code
+	case e.Code != "":
+		return e.Code
+	default:
+		return e.Type
+	}
+}
+
+// contextLength 400/413且错误信息表示上下文超长
+func (e *APIError) contextLength() bool {
+	if e.StatusCode != http.StatusBadRequest && e.StatusCode != http.StatusRequestEntityTooLarge {
+		return false
+	}
+	body := strings.ToLower(e.Body)
+	for _, marker := range contextLengthMarkers {
+		if strings.Contains(body, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// newAPIError 读取响应体并构造APIError
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+		RequestID:  firstHeader(resp.Header, "X-Request-Id", "Request-Id", "X-Dashscope-Request-Id", "Apim-Request-Id"),
+	}
+	if wait, ok := retryAfter(resp.Header); ok {
+		apiErr.RetryAfter = wait
+	}
+	parseErrorBody(apiErr, body)
+	return apiErr
+}
+
+// providerErrorBody 各服务商错误响应体的并集
+type providerErrorBody struct {
+	Error     json.RawMessage `json:"error"`
+	Type      string          `json:"type"`
+	Code      json.RawMessage `json:"code"`
+	Message   string          `json:"message"`
+	RequestID string          `json:"request_id"`
+}
+
+// providerErrorDetail 嵌套的error对象
+type providerErrorDetail struct {
+	Type    string          `json:"type"`
+	Code    json.RawMessage `json:"code"`
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+}
+
+// parseErrorBody 从错误响应体中解析类型、错误码和信息，无法解析时保持原样
+func parseErrorBody(apiErr *APIError, body []byte) {
+	var parsed providerErrorBody
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return
+	}
+
+	if parsed.RequestID != "" {
+		apiErr.RequestID = parsed.RequestID
+	}
+
+	if len(parsed.Error) > 0 {
+		// Ollama等返回字符串
+		var text string
+		if json.Unmarshal(parsed.Error, &text) == nil {
+			apiErr.Message = text
+			return
+		}
+
+		var detail providerErrorDetail
+		if json.Unmarshal(parsed.Error, &detail) == nil {
+			apiErr.Type = detail.Type
+			if apiErr.Type == "" {
+				apiErr.Type = detail.Status // Gemini
+			}
+			apiErr.Code = rawString(detail.Code)
+			apiErr.Message = detail.Message
+			return
+		}
+	}
+
+	// DashScope
+	apiErr.Code = rawString(parsed.Code)
+	apiErr.Message = parsed.Message
+}
+
+// rawString 把字符串或数字形式的JSON值转为字符串，null时返回空
+func rawString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	return string(raw)
+}
+
+// firstHeader 返回第一个非空的响应头
+func firstHeader(header http.Header, keys ...string) string {
+	for _, key := range keys {
+		if value := header.Get(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// contextLengthMarkers 各服务商表示上下文超长的错误信息片段
+var contextLengthMarkers = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context window",
+	"prompt is too long",
+	"too many tokens",
+	"input is too long",
+	"exceeds the maximum number of tokens",
+}
+
+// ClassifyError 返回错误所属的类别，无法归类时返回空字符串
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return ErrorClassRateLimit
+		case apiErr.StatusCode >= 500:
+			return ErrorClassServer
+		case apiErr.contextLength():
+			return ErrorClassContextLength
+		}
+		return ""
+	}
+
+	if errors.Is(err, ErrRateLimitWait) {
+		return ErrorClassRateLimit
+	}
+
+	// 熔断中等同于服务不可用
+	if errors.Is(err, ErrBreakerOpen) {
+		return ErrorClassServer
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+
+	return ""
+}
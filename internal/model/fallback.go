@@ -0,0 +1,182 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ProviderFallback 回退链虚拟模型的提供方名称
+const ProviderFallback = "fallback"
+
+// DefaultFallbackOn 默认触发回退的错误类别
+var DefaultFallbackOn = []string{
+	ErrorClassTimeout,
+	ErrorClassRateLimit,
+	ErrorClassServer,
+	ErrorClassContextLength,
+}
+
+// FallbackModel 按顺序尝试一组模型的组合模型
+//
+// 当前模型返回的错误属于配置的类别时尝试下一个模型，其他错误直接返回。
+// 调用方的ctx已取消或超时时不再回退。
+type FallbackModel struct {
+	config ModelConfig
+	models []Model
+	on     map[string]bool
+
+	mu       sync.Mutex
+	last     string
+	answered map[string]int
+}
+
+// NewFallbackModel 创建回退链模型，models按优先级排列
+func NewFallbackModel(config ModelConfig, models []Model) (*FallbackModel, error) {
+	if len(models) == 0 {
+		return nil, fmt.Errorf("回退链至少需要一个模型")
+	}
+
+	classes := config.FallbackOn
+	if len(classes) == 0 {
+		classes = DefaultFallbackOn
+	}
+
+	on := make(map[string]bool, len(classes))
+	for _, class := range classes {
+		switch class {
+		case ErrorClassTimeout, ErrorClassRateLimit, ErrorClassServer, ErrorClassContextLength:
+			on[class] = true
+		default:
+			return nil, fmt.Errorf("不支持的回退错误类别: %s", class)
+		}
+	}
+
+	return &FallbackModel{
+		config:   config,
+		models:   models,
+		on:       on,
+		answered: make(map[string]int),
+	}, nil
+}
+
+// Name 返回模型名称
+func (m *FallbackModel) Name() string {
+	return m.config.Name
+}
+
+// Config 返回模型配置
+func (m *FallbackModel) Config() ModelConfig {
+	return m.config
+}
+
+// Models 返回回退链中的模型，按优先级排列
+func (m *FallbackModel) Models() []Model {
+	return m.models
+}
+
+// LastAnswered 返回最近一次成功响应的模型名称
+func (m *FallbackModel) LastAnswered() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// Answered 返回各模型成功响应的次数
+func (m *FallbackModel) Answered() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	answered := make(map[string]int, len(m.answered))
+	for name, count := range m.answered {
+		answered[name] = count
+	}
+	return answered
+}
+
+// SupportsVision 所有成员都支持时才接受图片输入
+func (m *FallbackModel) SupportsVision() bool {
+	for _, member := range m.models {
+		if !SupportsVision(member) {
+			return false
+		}
+	}
+	return true
+}
+
+// Generate 生成文本响应
+func (m *FallbackModel) Generate(ctx context.Context, prompt string) (string, error) {
+	var text string
+	err := m.try(ctx, func(member Model) error {
+		var err error
+		text, err = member.Generate(ctx, prompt)
+		return err
+	})
+	return text, err
+}
+
+// Chat 以消息列表的形式生成响应
+func (m *FallbackModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	var text string
+	err := m.try(ctx, func(member Model) error {
+		var err error
+		text, err = Chat(ctx, member, messages, opts)
+		return err
+	})
+	return text, err
+}
+
+// GenerateStream 流式生成文本响应，只在建立流之前的错误上回退
+func (m *FallbackModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	var ch <-chan Chunk
+	err := m.try(ctx, func(member Model) error {
+		var err error
+		ch, err = Stream(ctx, member, prompt)
+		return err
+	})
+	return ch, err
+}
+
+// ChatStream 以消息列表的形式流式生成响应，只在建立流之前的错误上回退
+func (m *FallbackModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	var ch <-chan Chunk
+	err := m.try(ctx, func(member Model) error {
+		var err error
+		ch, err = StreamChat(ctx, member, messages, opts)
+		return err
+	})
+	return ch, err
+}
+
+// try 依次调用模型直到成功或遇到不可回退的错误
+func (m *FallbackModel) try(ctx context.Context, call func(member Model) error) error {
+	var failures []string
+
+	for i, member := range m.models {
+		err := call(member)
+		if err == nil {
+			m.record(member.Name())
+			return nil
+		}
+
+		failures = append(failures, fmt.Sprintf("%s: %v", member.Name(), err))
+
+		if ctx.Err() != nil || !m.on[ClassifyError(err)] || i == len(m.models)-1 {
+			if len(failures) == 1 {
+				return err
+			}
+			return fmt.Errorf("回退链 %s 调用失败 [%s]: %w", m.config.Name, strings.Join(failures, "; "), err)
+		}
+	}
+
+	return nil
+}
+
+// record 记录成功响应的模型
+func (m *FallbackModel) record(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = name
+	m.answered[name]++
+}
@@ -0,0 +1,427 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Gemini接口默认配置
+const (
+	defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	defaultGeminiModel   = "gemini-1.5-flash"
+)
+
+// GeminiModel Google Gemini generateContent模型实现
+//
+// ModelConfig.Options["safety_settings"]可配置安全设置，格式为
+// [{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_ONLY_HIGH"}]。
+type GeminiModel struct {
+	config ModelConfig
+	client *http.Client
+	usageCounter
+
+	safetySettings []GeminiSafetySetting
+}
+
+// NewGeminiModel 创建Gemini模型
+func NewGeminiModel(config ModelConfig) (Model, error) {
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("Gemini API key is required")
+	}
+
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = defaultGeminiBaseURL
+	}
+
+	if config.ModelID == "" || config.ModelID == "gemini" {
+		config.ModelID = defaultGeminiModel
+	}
+
+	var safetySettings []GeminiSafetySetting
+	if raw, ok := config.Options["safety_settings"]; ok {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("解析safety_settings失败: %w", err)
+		}
+		if err := json.Unmarshal(data, &safetySettings); err != nil {
+			return nil, fmt.Errorf("解析safety_settings失败: %w", err)
+		}
+	}
+
+	client := newHTTPClient(config)
+
+	return &GeminiModel{
+		config:         config,
+		client:         client,
+		safetySettings: safetySettings,
+	}, nil
+}
+
+// Name 返回模型名称
+func (m *GeminiModel) Name() string {
+	return m.config.Name
+}
+
+// Config 返回模型配置
+func (m *GeminiModel) Config() ModelConfig {
+	return m.config
+}
+
+// Generate 生成文本响应
+func (m *GeminiModel) Generate(ctx context.Context, prompt string) (string, error) {
+	return m.Chat(ctx, []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+}
+
+// Chat 以消息列表的形式生成响应
+//
+// 返回候选中所有text部分拼接的文本；只包含functionCall部分时返回这些调用的JSON数组。
+func (m *GeminiModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	response, err := m.GenerateContent(ctx, m.buildRequest(messages, opts))
+	if err != nil {
+		return "", err
+	}
+
+	if text := response.Text(); text != "" {
+		return text, nil
+	}
+
+	if calls := response.FunctionCalls(); len(calls) > 0 {
+		data, err := json.Marshal(calls)
+		if err != nil {
+			return "", fmt.Errorf("序列化函数调用失败: %w", err)
+		}
+		return string(data), nil
+	}
+
+	return "", fmt.Errorf("API返回空响应")
+}
+
+// GenerateContent 直接调用generateContent，调用方需要多模态部分或函数声明时使用
+func (m *GeminiModel) GenerateContent(ctx context.Context, request GeminiRequest) (*GeminiResponse, error) {
+	if request.SafetySettings == nil {
+		request.SafetySettings = m.safetySettings
+	}
+
+	req, err := newJSONRequest(ctx, m.endpoint("generateContent", nil), request, m.headers())
+	if err != nil {
+		return nil, err
+	}
+
+	var response GeminiResponse
+	if err := doJSON(m.client, req, &response); err != nil {
+		return nil, err
+	}
+
+	if err := response.blocked(); err != nil {
+		return nil, err
+	}
+
+	m.recordUsage(response.UsageMetadata.usage())
+	return &response, nil
+}
+
+// GenerateStream 流式生成文本响应（streamGenerateContent?alt=sse）
+func (m *GeminiModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	return m.ChatStream(ctx, []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+}
+
+// ChatStream 以消息列表的形式流式生成响应
+func (m *GeminiModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	request := m.buildRequest(messages, opts)
+
+	query := url.Values{"alt": {"sse"}}
+	req, err := newJSONRequest(ctx, m.endpoint("streamGenerateContent", query), request, m.headers())
+	if err != nil {
+		return nil, err
+	}
+
+	return streamSSE(m.client, req, m.parseStreamData)
+}
+
+// buildRequest 把通用消息转换为generateContent请求：system消息合并为systemInstruction，
+// assistant对应model角色，tool消息转换为functionResponse部分
+func (m *GeminiModel) buildRequest(messages []Message, opts ChatOptions) GeminiRequest {
+	request := GeminiRequest{
+		SafetySettings: m.safetySettings,
+		GenerationConfig: &GeminiGenerationConfig{
+			MaxOutputTokens: opts.maxTokens(m.config.MaxTokens),
+			StopSequences:   opts.Stop,
+			Seed:            opts.Seed,
+		},
+	}
+	request.GenerationConfig.Temperature = opts.requestTemperature(m.config.Temperature)
+	if opts.JSONMode {
+		request.GenerationConfig.ResponseMimeType = "application/json"
+	}
+
+	var system []GeminiPart
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem:
+			system = append(system, GeminiPart{Text: msg.Content})
+		case RoleAssistant:
+			request.Contents = append(request.Contents, GeminiContent{
+				Role:  "model",
+				Parts: []GeminiPart{{Text: msg.Content}},
+			})
+		case RoleTool:
+			request.Contents = append(request.Contents, GeminiContent{
+				Role: RoleUser,
+				Parts: []GeminiPart{{FunctionResponse: &GeminiFunctionResponse{
+					Name:     msg.Name,
+					Response: map[string]interface{}{"content": msg.Content},
+				}}},
+			})
+		default:
+			request.Contents = append(request.Contents, GeminiContent{
+				Role:  RoleUser,
+				Parts: geminiUserParts(msg),
+			})
+		}
+	}
+	if len(system) > 0 {
+		request.SystemInstruction = &GeminiContent{Parts: system}
+	}
+
+	return request
+}
+
+// SupportsVision 是否接受图片输入
+func (m *GeminiModel) SupportsVision() bool {
+	return visionEnabled(m.config)
+}
+
+// geminiUserParts 转换user消息：文本之后依次为图片，base64和data URL作为inlineData，http(s)地址作为fileData
+func geminiUserParts(msg Message) []GeminiPart {
+	parts := make([]GeminiPart, 0, len(msg.Images)+1)
+	if msg.Content != "" || len(msg.Images) == 0 {
+		parts = append(parts, GeminiPart{Text: msg.Content})
+	}
+	for _, image := range msg.Images {
+		parts = append(parts, geminiImagePart(image))
+	}
+	return parts
+}
+
+// geminiImagePart 转换一张图片；http(s)地址的MIME类型按扩展名推断，无法推断时使用默认类型
+func geminiImagePart(image ImagePart) GeminiPart {
+	if image.URL == "" {
+		mediaType := image.MediaType
+		if mediaType == "" {
+			mediaType = defaultImageMediaType
+		}
+		return GeminiPart{InlineData: &GeminiBlob{MimeType: mediaType, Data: image.Data}}
+	}
+
+	if rest, ok := strings.CutPrefix(image.URL, "data:"); ok {
+		if meta, data, ok := strings.Cut(rest, ","); ok {
+			mediaType := strings.TrimSuffix(meta, ";base64")
+			if mediaType == "" {
+				mediaType = defaultImageMediaType
+			}
+			return GeminiPart{InlineData: &GeminiBlob{MimeType: mediaType, Data: data}}
+		}
+	}
+
+	mediaType := defaultImageMediaType
+	if u, err := url.Parse(image.URL); err == nil {
+		if guessed := mime.TypeByExtension(path.Ext(u.Path)); strings.HasPrefix(guessed, "image/") {
+			mediaType = guessed
+		}
+	}
+	return GeminiPart{FileData: &GeminiFileData{MimeType: mediaType, FileURI: image.URL}}
+}
+
+// endpoint 返回models/{model}:{method}接口地址
+func (m *GeminiModel) endpoint(method string, query url.Values) string {
+	endpoint := joinURL(m.config.APIEndpoint, "/models/"+m.config.ModelID+":"+method)
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	return endpoint
+}
+
+// headers 返回认证及自定义请求头
+func (m *GeminiModel) headers() map[string]string {
+	headers := map[string]string{"x-goog-api-key": m.config.APIKey}
+	for key, value := range m.config.Headers {
+		headers[key] = value
+	}
+	return headers
+}
+
+// parseStreamData 解析一个流式响应片段，带finishReason的片段包含最终用量
+func (m *GeminiModel) parseStreamData(data string) (string, bool, error) {
+	var chunk GeminiResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return "", false, fmt.Errorf("解析流式响应失败: %w", err)
+	}
+
+	if chunk.Error != nil {
+		return "", false, fmt.Errorf("API流式错误: %s - %s", chunk.Error.Status, chunk.Error.Message)
+	}
+	if err := chunk.blocked(); err != nil {
+		return "", false, err
+	}
+
+	done := len(chunk.Candidates) > 0 && chunk.Candidates[0].FinishReason != ""
+	if done {
+		m.recordUsage(chunk.UsageMetadata.usage())
+	}
+
+	return chunk.Text(), done, nil
+}
+
+// GeminiRequest generateContent请求结构
+type GeminiRequest struct {
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	SafetySettings    []GeminiSafetySetting   `json:"safetySettings,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+}
+
+// GeminiContent 一轮内容，由多个部分组成
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+// GeminiPart 内容部分：文本、内联数据、文件引用、函数调用或函数结果
+type GeminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *GeminiBlob             `json:"inlineData,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// GeminiBlob 内联的二进制数据（base64编码），如图片
+type GeminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// GeminiFileData 已上传文件的引用
+type GeminiFileData struct {
+	MimeType string `json:"mimeType"`
+	FileURI  string `json:"fileUri"`
+}
+
+// GeminiFunctionCall 模型发起的函数调用
+type GeminiFunctionCall struct {
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// GeminiFunctionResponse 函数执行结果
+type GeminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+// GeminiGenerationConfig 生成参数
+type GeminiGenerationConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+}
+
+// GeminiSafetySetting 安全设置
+type GeminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+// GeminiTool 工具，包含函数声明
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// GeminiFunctionDeclaration 函数声明，Parameters为OpenAPI子集的Schema
+type GeminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// GeminiResponse generateContent响应结构
+type GeminiResponse struct {
+	Candidates     []GeminiCandidate `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback,omitempty"`
+	UsageMetadata GeminiUsageMetadata `json:"usageMetadata"`
+	Error         *struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"` // 流式响应中途出错时返回
+}
+
+// GeminiCandidate 候选结果
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+}
+
+// GeminiUsageMetadata 用量元数据
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// usage 转换为通用用量
+func (u GeminiUsageMetadata) usage() Usage {
+	return Usage{InputTokens: u.PromptTokenCount, OutputTokens: u.CandidatesTokenCount}
+}
+
+// Text 拼接第一个候选中的所有text部分
+func (r *GeminiResponse) Text() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		sb.WriteString(part.Text)
+	}
+	return sb.String()
+}
+
+// FunctionCalls 返回第一个候选中的所有函数调用
+func (r *GeminiResponse) FunctionCalls() []GeminiFunctionCall {
+	if len(r.Candidates) == 0 {
+		return nil
+	}
+	var calls []GeminiFunctionCall
+	for _, part := range r.Candidates[0].Content.Parts {
+		if part.FunctionCall != nil {
+			calls = append(calls, *part.FunctionCall)
+		}
+	}
+	return calls
+}
+
+// blocked 提示词或候选被安全策略拦截时返回错误
+func (r *GeminiResponse) blocked() error {
+	if r.PromptFeedback != nil && r.PromptFeedback.BlockReason != "" {
+		return fmt.Errorf("提示词被拦截: %s", r.PromptFeedback.BlockReason)
+	}
+	if len(r.Candidates) > 0 && r.Candidates[0].FinishReason == "SAFETY" {
+		return fmt.Errorf("响应被安全策略拦截")
+	}
+	return nil
+}
+
+// isGemini检查是否为Gemini模型
+func isGemini(modelType string) bool {
+	return strings.HasPrefix(modelType, "gemini-")
+}
@@ -1,21 +1,31 @@
 package model
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"time"
+	"strings"
 )
 
-// OpenAIModel OpenAI模型实现
+// OpenAI接口默认地址
+const (
+	defaultOpenAIBaseURL  = "https://api.openai.com/v1"
+	defaultOpenAIChatPath = "/chat/completions"
+)
+
+// OpenAIModel OpenAI模型实现，同时用于所有兼容OpenAI协议的服务
 type OpenAIModel struct {
 	config ModelConfig
 	client *http.Client
+	
+	url       string        // chat completions接口地址
+	authorize authorizeFunc // 设置认证请求头，为nil时不认证
 }
 
+// authorizeFunc 为请求设置认证请求头
+type authorizeFunc func(ctx context.Context, headers map[string]string) error
+
 // NewOpenAIModel 创建OpenAI模型
 func NewOpenAIModel(config ModelConfig) (Model, error) {
 	if config.APIKey == "" {
@@ -26,65 +36,192 @@ func NewOpenAIModel(config ModelConfig) (Model, error) {
 		config.ModelID = "gpt-3.5-turbo"
 	}
 	
-	client := &http.Client{
-		Timeout: time.Duration(config.Timeout) * time.Second,
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = defaultOpenAIBaseURL
+	}
+	
+	return newOpenAIModel(config), nil
+}
+
+// NewOpenAICompatibleModel 创建兼容OpenAI协议的模型（vLLM、llama.cpp server、LM Studio、内部网关等）
+//
+// APIEndpoint为服务的基础URL（如http://localhost:8000/v1），APIKey可为空。
+func NewOpenAICompatibleModel(config ModelConfig) (Model, error) {
+	if config.APIEndpoint == "" {
+		return nil, fmt.Errorf("OpenAI兼容服务需要配置api_endpoint")
+	}
+	
+	if config.ModelID == "" {
+		return nil, fmt.Errorf("OpenAI兼容服务需要配置模型ID")
+	}
+	
+	return newOpenAIModel(config), nil
+}
+
+// newOpenAIModel 创建OpenAI协议的模型实例
+func newOpenAIModel(config ModelConfig) *OpenAIModel {
+	client := newHTTPClient(config)
+	
+	path := config.Path
+	if path == "" {
+		path = defaultOpenAIChatPath
 	}
 	
-	return &OpenAIModel{
+	m := &OpenAIModel{
 		config: config,
 		client: client,
-	}, nil
+		url:    joinURL(config.APIEndpoint, path),
+	}
+	if config.APIKey != "" {
+		m.authorize = bearerAuth(config.APIKey)
+	}
+	return m
+}
+
+// bearerAuth 使用固定令牌的Bearer认证
+func bearerAuth(token string) authorizeFunc {
+	return func(ctx context.Context, headers map[string]string) error {
+		headers["Authorization"] = "Bearer " + token
+		return nil
+	}
 }
 
 // Generate 生成文本响应
 func (m *OpenAIModel) Generate(ctx context.Context, prompt string) (string, error) {
-	request := OpenAIRequest{
-		Model: m.config.ModelID,
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		MaxTokens:   m.config.MaxTokens,
-		Temperature: m.config.Temperature,
-	}
-	
-	jsonData, err := json.Marshal(request)
+	return m.Chat(ctx, []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+}
+
+// Chat 以消息列表的形式生成响应
+func (m *OpenAIModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	req, err := m.newRequest(ctx, m.buildRequest(messages, opts, false))
 	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %w", err)
+		return "", err
 	}
 	
-	req, err := http.NewRequestWithContext(ctx, "POST", 
-		"https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %w", err)
+	var response OpenAIResponse
+	if err := doJSON(m.client, req, &response); err != nil {
+		return "", err
 	}
 	
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+m.config.APIKey)
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("API返回空响应")
+	}
 	
-	resp, err := m.client.Do(req)
+	return response.Choices[0].Message.Content, nil
+}
+
+// GenerateStream 流式生成文本响应
+func (m *OpenAIModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	return m.ChatStream(ctx, []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+}
+
+// ChatStream 以消息列表的形式流式生成响应
+func (m *OpenAIModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	req, err := m.newRequest(ctx, m.buildRequest(messages, opts, true))
 	if err != nil {
-		return "", fmt.Errorf("发送请求失败: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 	
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API请求失败: %s - %s", resp.Status, string(body))
+	return streamSSE(m.client, req, parseOpenAIStreamData)
+}
+
+// buildRequest 构建请求，调用参数覆盖模型配置
+func (m *OpenAIModel) buildRequest(messages []Message, opts ChatOptions, stream bool) OpenAIRequest {
+	return OpenAIRequest{
+		Model:          m.config.ModelID,
+		Messages:       openAIMessages(messages),
+		MaxTokens:      opts.maxTokens(m.config.MaxTokens),
+		Temperature:    opts.requestTemperature(m.config.Temperature),
+		Stop:           opts.Stop,
+		Seed:           opts.Seed,
+		Stream:         stream,
+		ResponseFormat: opts.responseFormat(),
+	}
+}
+
+// newRequest 创建chat completions HTTP请求
+func (m *OpenAIModel) newRequest(ctx context.Context, request OpenAIRequest) (*http.Request, error) {
+	headers, err := m.headers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newJSONRequest(ctx, m.url, request, headers)
+}
+
+// headers 返回认证、组织/项目以及自定义请求头，自定义请求头优先
+func (m *OpenAIModel) headers(ctx context.Context) (map[string]string, error) {
+	headers := make(map[string]string, len(m.config.Headers)+3)
+	if m.authorize != nil {
+		if err := m.authorize(ctx, headers); err != nil {
+			return nil, fmt.Errorf("获取认证信息失败: %w", err)
+		}
+	}
+	if m.config.Organization != "" {
+		headers["OpenAI-Organization"] = m.config.Organization
+	}
+	if m.config.Project != "" {
+		headers["OpenAI-Project"] = m.config.Project
+	}
+	for key, value := range m.config.Headers {
+		headers[key] = value
+	}
+	return headers, nil
+}
+
+// parseOpenAIStreamData 解析OpenAI chat completions流式数据
+func parseOpenAIStreamData(data string) (string, bool, error) {
+	if data == "[DONE]" {
+		return "", true, nil
 	}
 	
-	var response OpenAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+	var chunk OpenAIStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return "", false, fmt.Errorf("解析流式响应失败: %w", err)
+	}
+	if chunk.Error != nil {
+		return "", false, chunk.Error
 	}
 	
-	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("API返回空响应")
+
+	if len(chunk.Choices) == 0 {
+		return "", false, nil
 	}
 	
-	return response.Choices[0].Message.Content, nil
+	return chunk.Choices[0].Delta.Content, false, nil
+}
+
+// SupportsVision 是否接受图片输入
+func (m *OpenAIModel) SupportsVision() bool {
+	return visionEnabled(m.config)
+}
+
+// openAIMessages 转换为OpenAI消息，带图片的消息使用text和image_url内容块数组
+func openAIMessages(messages []Message) []OpenAIMessage {
+	result := make([]OpenAIMessage, len(messages))
+	for i, msg := range messages {
+		result[i] = OpenAIMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCallID: msg.ToolCallID,
+		}
+		if len(msg.Images) == 0 {
+			continue
+		}
+
+		parts := make([]OpenAIContentPart, 0, len(msg.Images)+1)
+		if msg.Content != "" {
+			parts = append(parts, OpenAIContentPart{Type: "text", Text: msg.Content})
+		}
+		for _, image := range msg.Images {
+			parts = append(parts, OpenAIContentPart{
+				Type:     "image_url",
+				ImageURL: &OpenAIImageURL{URL: image.DataURL(), Detail: image.Detail},
+			})
+		}
+		result[i].Content = parts
+	}
+	return result
 }
 
 // Name 返回模型名称
@@ -99,16 +236,44 @@ func (m *OpenAIModel) Config() ModelConfig {
 
 // OpenAIRequest OpenAI API请求结构
 type OpenAIRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float64   `json:"temperature,omitempty"`
+	Model          string          `json:"model"`
+	Messages       []OpenAIMessage `json:"messages"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	Seed           *int            `json:"seed,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
 }
 
 // Message消息结构
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string      `json:"role"`
+	Content    string      `json:"content"`
+	Name       string      `json:"name,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"` // tool角色消息对应的工具调用ID
+	Images     []ImagePart `json:"images,omitempty"`       // user消息附带的图片，模型需支持视觉输入
+}
+
+// OpenAIMessage OpenAI请求消息，Content为字符串或内容块数组
+type OpenAIMessage struct {
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"`
+	Name       string      `json:"name,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+}
+
+// OpenAIContentPart 多模态内容块
+type OpenAIContentPart struct {
+	Type     string          `json:"type"` // text或image_url
+	Text     string          `json:"text,omitempty"`
+	ImageURL *OpenAIImageURL `json:"image_url,omitempty"`
+}
+
+// OpenAIImageURL 图片地址，支持http(s)和data URL
+type OpenAIImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
 }
 
 // OpenAIResponse OpenAI API响应结构
@@ -121,10 +286,39 @@ type Choice struct {
 	Message Message `json:"message"`
 }
 
+// OpenAIStreamResponse OpenAI流式响应片段
+type OpenAIStreamResponse struct {
+	Choices []StreamChoice `json:"choices"`
+	Error   *StreamError   `json:"error,omitempty"`
+}
+
+// StreamError OpenAI兼容服务在流式响应中途返回的错误
+type StreamError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Error 实现error接口
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("API流式错误: %s - %s", e.Type, e.Message)
+}
+
+// StreamChoice 流式选择项
+type StreamChoice struct {
+	Delta Message `json:"delta"`
+}
+
+// DashScope接口地址，VL/QVQ等视觉模型使用多模态接口
+const (
+	qwenTextGenerationURL       = "https://dashscope.aliyuncs.com/api/v1/services/aigc/text-generation/generation"
+	qwenMultimodalGenerationURL = "https://dashscope.aliyuncs.com/api/v1/services/aigc/multimodal-generation/generation"
+)
+
 // QwenModel 通义千问模型实现
 type QwenModel struct {
-	config ModelConfig
-	client *http.Client
+	config     ModelConfig
+	client     *http.Client
+	multimodal bool // 使用多模态接口，消息内容为image/text内容块数组
 }
 
 // NewQwenModel 创建通义千问模型
@@ -133,72 +327,160 @@ func NewQwenModel(config ModelConfig) (Model, error) {
 		return nil, fmt.Errorf("通义千问 API key is required")
 	}
 	
-	if config.APIEndpoint == "" {
-		config.APIEndpoint = "https://dashscope.aliyuncs.com/api/v1/services/aigc/text-generation/generation"
-	}
-	
 	if config.ModelID == "" {
 		config.ModelID = "qwen-turbo"
 	}
 	
-	client := &http.Client{
-		Timeout: time.Duration(config.Timeout) * time.Second,
+	multimodal := visionEnabled(config)
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = qwenTextGenerationURL
+		if multimodal {
+			config.APIEndpoint = qwenMultimodalGenerationURL
+		}
 	}
 	
+	client := newHTTPClient(config)
+	
 	return &QwenModel{
-		config: config,
-		client: client,
+		config:     config,
+		client:     client,
+		multimodal: multimodal,
 	}, nil
 }
 
 // Generate 生成文本响应
 func (m *QwenModel) Generate(ctx context.Context, prompt string) (string, error) {
+	return m.Chat(ctx, []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+}
+
+// Chat 以消息列表的形式生成响应（DashScope messages输入格式）
+func (m *QwenModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
 	request := QwenRequest{
 		Model: m.config.ModelID,
 		Input: QwenInput{
-			Prompt: prompt,
-		},
-		Parameters: QwenParameters{
-			MaxTokens:   m.config.MaxTokens,
-			Temperature: m.config.Temperature,
+			Messages: m.qwenMessages(messages),
 		},
+		Parameters: m.buildParameters(opts),
 	}
+	request.Parameters.ResultFormat = "message"
 	
-	jsonData, err := json.Marshal(request)
+	req, err := m.newRequest(ctx, request)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %w", err)
+		return "", err
 	}
 	
-	req, err := http.NewRequestWithContext(ctx, "POST", m.config.APIEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %w", err)
+	var response QwenResponse
+	if err := doJSON(m.client, req, &response); err != nil {
+		return "", err
 	}
 	
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+m.config.APIKey)
-	req.Header.Set("X-DashScope-SSE", "enable")
+	text := response.Output.Text
+	if len(response.Output.Choices) > 0 {
+		text = string(response.Output.Choices[0].Message.Content)
+	}
 	
-	resp, err := m.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("发送请求失败: %w", err)
+	if text == "" {
+		return "", fmt.Errorf("API返回空响应")
 	}
-	defer resp.Body.Close()
 	
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API请求失败: %s - %s", resp.Status, string(body))
+	return text, nil
+}
+
+// GenerateStream 流式生成文本响应（DashScope SSE）
+func (m *QwenModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	return m.ChatStream(ctx, []Message{{Role: RoleUser, Content: prompt}}, ChatOptions{})
+}
+
+// ChatStream 以消息列表的形式流式生成响应（DashScope SSE增量输出）
+func (m *QwenModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	request := QwenRequest{
+		Model: m.config.ModelID,
+		Input: QwenInput{
+			Messages: m.qwenMessages(messages),
+		},
+		Parameters: m.buildParameters(opts),
 	}
+	request.Parameters.ResultFormat = "message"
+	request.Parameters.IncrementalOutput = true
 	
-	var response QwenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+	req, err := m.newRequest(ctx, request)
+	if err != nil {
+		return nil, err
 	}
+	req.Header.Set("X-DashScope-SSE", "enable")
 	
-	if response.Output.Text == "" {
-		return "", fmt.Errorf("API返回空响应")
+	return streamSSE(m.client, req, parseQwenStreamData)
+}
+
+// buildParameters 构建生成参数，调用参数覆盖模型配置
+func (m *QwenModel) buildParameters(opts ChatOptions) QwenParameters {
+	return QwenParameters{
+		MaxTokens:      opts.maxTokens(m.config.MaxTokens),
+		Temperature:    opts.requestTemperature(m.config.Temperature),
+		Stop:           opts.Stop,
+		Seed:           opts.Seed,
+		ResponseFormat: opts.responseFormat(),
+	}
+}
+
+// newRequest 创建DashScope HTTP请求
+func (m *QwenModel) newRequest(ctx context.Context, request QwenRequest) (*http.Request, error) {
+	return newJSONRequest(ctx, m.config.APIEndpoint, request, map[string]string{
+		"Authorization": "Bearer " + m.config.APIKey,
+	})
+}
+
+// parseQwenStreamData 解析DashScope增量输出的流式数据
+func parseQwenStreamData(data string) (string, bool, error) {
+	var chunk QwenResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return "", false, fmt.Errorf("解析流式响应失败: %w", err)
+	}
+	if chunk.Code != "" {
+		return "", false, fmt.Errorf("API流式错误: %s - %s", chunk.Code, chunk.Message)
+	}
+	
+
+	text, finishReason := chunk.Output.Text, chunk.Output.FinishReason
+	if len(chunk.Output.Choices) > 0 {
+		// 多模态接口以choices返回增量
+		text = string(chunk.Output.Choices[0].Message.Content)
+		finishReason = chunk.Output.Choices[0].FinishReason
 	}
 	
-	return response.Output.Text, nil
+	done := finishReason != "" && finishReason != "null"
+	return text, done, nil
+}
+
+// SupportsVision 是否接受图片输入（VL/QVQ等视觉模型）
+func (m *QwenModel) SupportsVision() bool {
+	return m.multimodal
+}
+
+// qwenMessages 转换为DashScope消息；多模态接口的内容为[{"image": ...}, {"text": ...}]数组
+func (m *QwenModel) qwenMessages(messages []Message) []QwenMessage {
+	result := make([]QwenMessage, len(messages))
+	for i, msg := range messages {
+		result[i] = QwenMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCallID: msg.ToolCallID,
+		}
+		if !m.multimodal {
+			continue
+		}
+
+		parts := make([]QwenContentPart, 0, len(msg.Images)+1)
+		for _, image := range msg.Images {
+			parts = append(parts, QwenContentPart{Image: image.DataURL()})
+		}
+		if msg.Content != "" || len(parts) == 0 {
+			parts = append(parts, QwenContentPart{Text: msg.Content})
+		}
+		result[i].Content = parts
+	}
+	return result
 }
 
 // Name 返回模型名称
@@ -218,30 +500,87 @@ type QwenRequest struct {
 	Parameters QwenParameters  `json:"parameters"`
 }
 
-// QwenInput 输入参数
+// QwenInput 输入参数，Prompt和Messages二选一
 type QwenInput struct {
-	Prompt string `json:"prompt"`
+	Prompt   string        `json:"prompt,omitempty"`
+	Messages []QwenMessage `json:"messages,omitempty"`
+}
+
+// QwenMessage DashScope请求消息，Content为字符串或多模态内容块数组
+type QwenMessage struct {
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"`
+	Name       string      `json:"name,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+}
+
+// QwenContentPart 多模态内容块，Image和Text二选一
+type QwenContentPart struct {
+	Image string `json:"image,omitempty"` // http(s)地址或data URL
+	Text  string `json:"text,omitempty"`
 }
 
 // QwenParameters 参数配置
 type QwenParameters struct {
-	MaxTokens   int     `json:"max_tokens,omitempty"`
-	Temperature float64 `json:"temperature,omitempty"`
+	MaxTokens         int             `json:"max_tokens,omitempty"`
+	Temperature       *float64        `json:"temperature,omitempty"`
+	Stop              []string        `json:"stop,omitempty"`
+	Seed              *int            `json:"seed,omitempty"`
+	ResultFormat      string          `json:"result_format,omitempty"`      // message时以choices返回
+	IncrementalOutput bool            `json:"incremental_output,omitempty"` // 流式时只返回增量文本
+	ResponseFormat    *ResponseFormat `json:"response_format,omitempty"`    // json_object时输出JSON
 }
 
 // QwenResponse 通义千问API响应结构
 type QwenResponse struct {
-	Output QwenOutput `json:"output"`
+	Output  QwenOutput `json:"output"`
+	Code    string     `json:"code,omitempty"`    // 流式响应中途出错时返回
+	Message string     `json:"message,omitempty"`
 }
 
 // QwenOutput 输出结果
 type QwenOutput struct {
-	Text string `json:"text"`
+	Text         string       `json:"text"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+	Choices      []QwenChoice `json:"choices,omitempty"`
+}
+
+// QwenChoice result_format为message时的选择项
+type QwenChoice struct {
+	Message struct {
+		Role    string      `json:"role"`
+		Content qwenContent `json:"content"`
+	} `json:"message"`
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// qwenContent 响应消息内容：文本接口为字符串，多模态接口为[{"text": ...}]数组
+type qwenContent string
+
+// UnmarshalJSON 解析字符串或内容块数组，数组中的文本依次拼接
+func (c *qwenContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = qwenContent(text)
+		return nil
+	}
+
+	var parts []QwenContentPart
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("解析消息内容失败: %w", err)
+	}
+	var sb strings.Builder
+	for _, part := range parts {
+		sb.WriteString(part.Text)
+	}
+	*c = qwenContent(sb.String())
+	return nil
 }
 
 // LLaMAModel LLaMA模型实现（本地模型示例）
 type LLaMAModel struct {
 	config ModelConfig
+	client *http.Client
 }
 
 // NewLLaMAModel 创建LLaMA模型
@@ -256,57 +595,109 @@ func NewLLaMAModel(config ModelConfig) (Model, error) {
 	
 	return &LLaMAModel{
 		config: config,
+		client: newHTTPClient(config),
 	}, nil
 }
 
 // Generate 生成文本响应
 func (m *LLaMAModel) Generate(ctx context.Context, prompt string) (string, error) {
+	return m.complete(ctx, m.buildRequest(prompt, ChatOptions{}))
+}
+
+// Chat 以消息列表的形式生成响应，消息按模型的对话模板渲染为提示词
+func (m *LLaMAModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	return m.complete(ctx, m.buildChatRequest(messages, opts))
+}
+
+// ChatStream 以消息列表的形式流式生成响应，消息按模型的对话模板渲染为提示词
+func (m *LLaMAModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	return m.stream(ctx, m.buildChatRequest(messages, opts))
+}
+
+// buildChatRequest 按对话模板渲染消息并附加模板的停止词
+func (m *LLaMAModel) buildChatRequest(messages []Message, opts ChatOptions) LLaMARequest {
+	template := ChatTemplateFor(m.config.ModelID)
+	
+	request := m.buildRequest(RenderChatTemplate(template, messages), opts)
+	request.Stop = append(request.Stop, template.Stop...)
+	return request
+}
+
+// complete 调用completions接口
+func (m *LLaMAModel) complete(ctx context.Context, request LLaMARequest) (string, error) {
 	//这里是本地LLaMA模型的示例实现
 	// 实际使用时需要连接到本地运行的LLaMA服务
 	
-	request := LLaMARequest{
-		Prompt:      prompt,
-		MaxTokens:   m.config.MaxTokens,
-		Temperature: m.config.Temperature,
-	}
-	
-	jsonData, err := json.Marshal(request)
+	req, err := m.newRequest(ctx, request)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %w", err)
+		return "", err
 	}
 	
-	client := &http.Client{
-		Timeout: time.Duration(m.config.Timeout) * time.Second,
+	var response LLaMAResponse
+	if err := doJSON(m.client, req, &response); err != nil {
+		return "", err
 	}
 	
-	req, err := http.NewRequestWithContext(ctx, "POST", m.config.APIEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %w", err)
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("API返回空响应")
 	}
 	
-	req.Header.Set("Content-Type", "application/json")
+	return response.Choices[0].Text, nil
+}
+
+// GenerateStream 流式生成文本响应（OpenAI兼容的completions SSE）
+func (m *LLaMAModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	return m.stream(ctx, m.buildRequest(prompt, ChatOptions{}))
+}
+
+// stream 以流式调用completions接口
+func (m *LLaMAModel) stream(ctx context.Context, request LLaMARequest) (<-chan Chunk, error) {
+	request.Stream = true
 	
-	resp, err := client.Do(req)
+	req, err := m.newRequest(ctx, request)
 	if err != nil {
-		return "", fmt.Errorf("发送请求失败: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 	
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API请求失败: %s - %s", resp.Status, string(body))
+	return streamSSE(m.client, req, parseLLaMAStreamData)
+}
+
+// buildRequest 构建请求，调用参数覆盖模型配置
+func (m *LLaMAModel) buildRequest(prompt string, opts ChatOptions) LLaMARequest {
+	return LLaMARequest{
+		Prompt:      prompt,
+		MaxTokens:   opts.maxTokens(m.config.MaxTokens),
+		Temperature: opts.requestTemperature(m.config.Temperature),
+		Stop:        opts.Stop,
+		Seed:        opts.Seed,
+	}
+}
+
+// newRequest 创建completions HTTP请求
+func (m *LLaMAModel) newRequest(ctx context.Context, request LLaMARequest) (*http.Request, error) {
+	return newJSONRequest(ctx, m.config.APIEndpoint, request, nil)
+}
+
+// parseLLaMAStreamData 解析completions流式数据
+func parseLLaMAStreamData(data string) (string, bool, error) {
+	if data == "[DONE]" {
+		return "", true, nil
 	}
 	
-	var response LLaMAResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+	var chunk LLaMAResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return "", false, fmt.Errorf("解析流式响应失败: %w", err)
+	}
+	if chunk.Error != nil {
+		return "", false, chunk.Error
 	}
 	
-	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("API返回空响应")
+
+	if len(chunk.Choices) == 0 {
+		return "", false, nil
 	}
 	
-	return response.Choices[0].Text, nil
+	return chunk.Choices[0].Text, false, nil
 }
 
 // Name 返回模型名称
@@ -321,14 +712,18 @@ func (m *LLaMAModel) Config() ModelConfig {
 
 // LLaMARequest LLaMA API请求结构
 type LLaMARequest struct {
-	Prompt      string  `json:"prompt"`
-	MaxTokens   int     `json:"max_tokens,omitempty"`
-	Temperature float64 `json:"temperature,omitempty"`
+	Prompt      string   `json:"prompt"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	Stream      bool     `json:"stream,omitempty"`
 }
 
 // LLaMAResponse LLaMA API响应结构
 type LLaMAResponse struct {
 	Choices []LLaMAChoice `json:"choices"`
+	Error   *StreamError  `json:"error,omitempty"`
 }
 
 // LLaMAChoice 选择项
@@ -343,11 +738,30 @@ func init() {
 	RegisterModel("gpt-3.5-turbo", NewOpenAIModel)
 	RegisterModel("gpt-4", NewOpenAIModel)
 	RegisterModel("gpt-4-turbo", NewOpenAIModel)
+	RegisterModel("gpt-4o", NewOpenAIModel)
+	RegisterModel("gpt-4o-mini", NewOpenAIModel)
+	
+	// 注册OpenAI兼容服务
+	RegisterModel(ProviderOpenAICompatible, NewOpenAICompatibleModel)
+	
+	// 注册Azure OpenAI
+	RegisterModel(ProviderAzureOpenAI, NewAzureOpenAIModel)
+	
+	// 注册Anthropic模型
+	RegisterModel("anthropic", NewAnthropicModel)
+	
+	// 注册Gemini模型
+	RegisterModel("gemini", NewGeminiModel)
 	
 	// 注册通义千问模型
 	RegisterModel("qwen", NewQwenModel)
 	RegisterModel("qwen-turbo", NewQwenModel)
 	RegisterModel("qwen-plus", NewQwenModel)
+	RegisterModel("qwen-vl-plus", NewQwenModel)
+	RegisterModel("qwen-vl-max", NewQwenModel)
+	
+	// 注册Ollama模型
+	RegisterModel("ollama", NewOllamaModel)
 	
 	// 注册LLaMA模型
 	RegisterModel("llama", NewLLaMAModel)
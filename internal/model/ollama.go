@@ -0,0 +1,287 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Ollama默认地址
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+// ErrNotOllama 模型实例（展开包装后）不是Ollama模型
+var ErrNotOllama = errors.New("模型不是Ollama模型")
+
+// OllamaModel Ollama原生API模型实现（/api/chat、/api/generate）
+//
+// ModelConfig.Options中的keep_alive和format作为请求顶层字段发送，
+// 其余选项（如num_ctx、top_p）原样放入Ollama的options。
+type OllamaModel struct {
+	config ModelConfig
+	client *http.Client
+}
+
+// NewOllamaModel 创建Ollama模型
+func NewOllamaModel(config ModelConfig) (Model, error) {
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = defaultOllamaBaseURL
+	}
+
+	if config.ModelID == "" || config.ModelID == "ollama" {
+		return nil, fmt.Errorf("Ollama模型需要配置模型ID，如llama3.1:8b")
+	}
+
+	client := newHTTPClient(config)
+
+	return &OllamaModel{
+		config: config,
+		client: client,
+	}, nil
+}
+
+// Name 返回模型名称
+func (m *OllamaModel) Name() string {
+	return m.config.Name
+}
+
+// Config 返回模型配置
+func (m *OllamaModel) Config() ModelConfig {
+	return m.config
+}
+
+// Generate 生成文本响应（/api/generate）
+func (m *OllamaModel) Generate(ctx context.Context, prompt string) (string, error) {
+	req, err := m.newRequest(ctx, "/api/generate", m.buildGenerateRequest(prompt, false))
+	if err != nil {
+		return "", err
+	}
+
+	var response OllamaGenerateResponse
+	if err := doJSON(m.client, req, &response); err != nil {
+		return "", err
+	}
+
+	return response.Response, nil
+}
+
+// Chat 以消息列表的形式生成响应（/api/chat）
+func (m *OllamaModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	req, err := m.newRequest(ctx, "/api/chat", m.buildChatRequest(messages, opts, false))
+	if err != nil {
+		return "", err
+	}
+
+	var response OllamaChatResponse
+	if err := doJSON(m.client, req, &response); err != nil {
+		return "", err
+	}
+
+	return response.Message.Content, nil
+}
+
+// GenerateStream 流式生成文本响应（/api/generate的NDJSON流）
+func (m *OllamaModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	req, err := m.newRequest(ctx, "/api/generate", m.buildGenerateRequest(prompt, true))
+	if err != nil {
+		return nil, err
+	}
+
+	return streamNDJSON(m.client, req, parseOllamaStreamData)
+}
+
+// ChatStream 以消息列表的形式流式生成响应（/api/chat的NDJSON流）
+func (m *OllamaModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	req, err := m.newRequest(ctx, "/api/chat", m.buildChatRequest(messages, opts, true))
+	if err != nil {
+		return nil, err
+	}
+
+	return streamNDJSON(m.client, req, parseOllamaChatStreamData)
+}
+
+// ListModels 列出Ollama本地已有的模型（/api/tags）
+func (m *OllamaModel) ListModels(ctx context.Context) ([]OllamaModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", joinURL(m.config.APIEndpoint, "/api/tags"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	var response struct {
+		Models []OllamaModelInfo `json:"models"`
+	}
+	if err := doJSON(m.client, req, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Models, nil
+}
+
+// ListOllamaModels 列出已创建的Ollama模型实例所在服务的本地模型，展开限流、熔断和缓存等包装
+func (r *ModelRegistry) ListOllamaModels(ctx context.Context, name string) ([]OllamaModelInfo, error) {
+	m, exists := r.GetModel(name)
+	if !exists {
+		return nil, fmt.Errorf("模型 %s 不存在", name)
+	}
+
+	for {
+		switch v := m.(type) {
+		case *OllamaModel:
+			return v.ListModels(ctx)
+		case Unwrapper:
+			m = v.Unwrap()
+		default:
+			return nil, fmt.Errorf("%s: %w", name, ErrNotOllama)
+		}
+	}
+}
+
+// ListOllamaModels 列出全局注册表中Ollama模型实例所在服务的本地模型
+func ListOllamaModels(ctx context.Context, name string) ([]OllamaModelInfo, error) {
+	return GlobalRegistry.ListOllamaModels(ctx, name)
+}
+
+// buildGenerateRequest 构建/api/generate请求
+func (m *OllamaModel) buildGenerateRequest(prompt string, stream bool) OllamaGenerateRequest {
+	return OllamaGenerateRequest{
+		Model:     m.config.ModelID,
+		Prompt:    prompt,
+		Stream:    stream,
+		Format:    m.format(),
+		KeepAlive: m.config.Options["keep_alive"],
+		Options:   m.options(ChatOptions{}),
+	}
+}
+
+// buildChatRequest 构建/api/chat请求
+func (m *OllamaModel) buildChatRequest(messages []Message, opts ChatOptions, stream bool) OllamaChatRequest {
+	return OllamaChatRequest{
+		Model:     m.config.ModelID,
+		Messages:  messages,
+		Stream:    stream,
+		Format:    m.chatFormat(opts),
+		KeepAlive: m.config.Options["keep_alive"],
+		Options:   m.options(opts),
+	}
+}
+
+// chatFormat 返回本次调用的输出格式，调用参数要求JSON时覆盖配置
+func (m *OllamaModel) chatFormat(opts ChatOptions) string {
+	if opts.JSONMode {
+		return "json"
+	}
+	return m.format()
+}
+
+// format 返回输出格式，配置为json时启用JSON模式
+func (m *OllamaModel) format() string {
+	return m.config.OptionString("format")
+}
+
+// options 合并配置选项与调用参数为Ollama的options
+func (m *OllamaModel) options(opts ChatOptions) map[string]interface{} {
+	options := make(map[string]interface{}, len(m.config.Options)+4)
+	for key, value := range m.config.Options {
+		if key == "keep_alive" || key == "format" {
+			continue
+		}
+		options[key] = value
+	}
+
+	if opts.Temperature != nil || m.config.Temperature > 0 {
+		options["temperature"] = opts.temperature(m.config.Temperature)
+	}
+	if maxTokens := opts.maxTokens(m.config.MaxTokens); maxTokens > 0 {
+		options["num_predict"] = maxTokens
+	}
+	if len(opts.Stop) > 0 {
+		options["stop"] = opts.Stop
+	}
+	if opts.Seed != nil {
+		options["seed"] = *opts.Seed
+	}
+
+	return options
+}
+
+// newRequest 创建Ollama HTTP请求
+func (m *OllamaModel) newRequest(ctx context.Context, path string, request interface{}) (*http.Request, error) {
+	return newJSONRequest(ctx, joinURL(m.config.APIEndpoint, path), request, m.config.Headers)
+}
+
+// parseOllamaStreamData 解析Ollama NDJSON流的一行
+func parseOllamaStreamData(data string) (string, bool, error) {
+	var chunk OllamaGenerateResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return "", false, fmt.Errorf("解析流式响应失败: %w", err)
+	}
+
+	if chunk.Error != "" {
+		return "", false, fmt.Errorf("API流式错误: %s", chunk.Error)
+	}
+
+	return chunk.Response, chunk.Done, nil
+}
+
+// parseOllamaChatStreamData 解析Ollama /api/chat NDJSON流的一行
+func parseOllamaChatStreamData(data string) (string, bool, error) {
+	var chunk OllamaChatResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return "", false, fmt.Errorf("解析流式响应失败: %w", err)
+	}
+
+	if chunk.Error != "" {
+		return "", false, fmt.Errorf("API流式错误: %s", chunk.Error)
+	}
+
+	return chunk.Message.Content, chunk.Done, nil
+}
+
+// OllamaGenerateRequest /api/generate请求结构
+type OllamaGenerateRequest struct {
+	Model     string                 `json:"model"`
+	Prompt    string                 `json:"prompt"`
+	Stream    bool                   `json:"stream"` // Ollama默认流式，需要显式发送false
+	Format    string                 `json:"format,omitempty"`
+	KeepAlive interface{}            `json:"keep_alive,omitempty"` // 如"5m"或秒数
+	Options   map[string]interface{} `json:"options,omitempty"`
+}
+
+// OllamaGenerateResponse /api/generate响应结构（流式时为每一行）
+type OllamaGenerateResponse struct {
+	Model           string `json:"model"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count,omitempty"`
+	EvalCount       int    `json:"eval_count,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// OllamaChatRequest /api/chat请求结构
+type OllamaChatRequest struct {
+	Model     string                 `json:"model"`
+	Messages  []Message              `json:"messages"`
+	Stream    bool                   `json:"stream"`
+	Format    string                 `json:"format,omitempty"`
+	KeepAlive interface{}            `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+}
+
+// OllamaChatResponse /api/chat响应结构
+type OllamaChatResponse struct {
+	Model   string  `json:"model"`
+	Message Message `json:"message"`
+	Done    bool    `json:"done"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// OllamaModelInfo /api/tags返回的模型信息
+type OllamaModelInfo struct {
+	Name       string    `json:"name"`
+	Model      string    `json:"model"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+}
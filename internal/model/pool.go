@@ -0,0 +1,443 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 池化调度策略
+const (
+	PoolRoundRobin    = "round_robin"
+	PoolLeastInFlight = "least_in_flight"
+	PoolWeighted      = "weighted"
+)
+
+// 池化默认参数
+const (
+	defaultPoolCooldown         = 30 // 秒
+	defaultPoolFailureThreshold = 3
+)
+
+// PoolConfig 多密钥/多地址池配置
+type PoolConfig struct {
+	Strategy         string       `json:"strategy,omitempty"`          // round_robin（默认）/least_in_flight/weighted
+	Members          []PoolMember `json:"members"`                     // 成员，未填写的字段沿用模型配置
+	Cooldown         int          `json:"cooldown,omitempty"`          // 成员被移出轮换的时长（秒），默认30
+	FailureThreshold int          `json:"failure_threshold,omitempty"` // 连续失败多少次后移出轮换，默认3
+}
+
+// PoolMember 池成员：一组凭据和地址
+type PoolMember struct {
+	Name        string `json:"name,omitempty"` // 用于统计展示，默认为脱敏的密钥
+	APIKey      string `json:"api_key,omitempty"`
+	APIEndpoint string `json:"api_endpoint,omitempty"`
+	Weight      int    `json:"weight,omitempty"` // weighted策略的权重，默认1
+}
+
+// PoolMemberStats 池成员的使用统计
+type PoolMemberStats struct {
+	Name          string     `json:"name"`
+	Endpoint      string     `json:"endpoint"`
+	Weight        int        `json:"weight"`
+	Requests      int64      `json:"requests"`
+	Successes     int64      `json:"successes"`
+	Failures      int64      `json:"failures"`
+	InFlight      int        `json:"in_flight"`
+	Healthy       bool       `json:"healthy"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	Usage         *Usage     `json:"usage,omitempty"`
+}
+
+// poolMember 池成员的运行状态，受PoolModel.mu保护
+type poolMember struct {
+	model    Model
+	name     string
+	endpoint string
+	weight   int
+
+	requests      int64
+	successes     int64
+	failures      int64
+	inFlight      int
+	consecutive   int
+	cooldownUntil time.Time
+	lastError     string
+	current       int // 平滑加权轮询的当前权重
+}
+
+// PoolModel 把多组凭据/地址组合为一个模型的池
+//
+// 请求按策略分配到健康成员；成员返回限流、5xx、超时或认证错误时计为失败，
+// 连续失败达到阈值（限流和认证错误立即）后在冷却期内移出轮换，并换下一个成员重试。
+type PoolModel struct {
+	config    ModelConfig
+	strategy  string
+	cooldown  time.Duration
+	threshold int
+
+	mu      sync.Mutex
+	members []*poolMember
+	next    int
+}
+
+// newPoolModel 用工厂为每个成员创建模型实例
+func newPoolModel(config ModelConfig, factory ModelFactory) (*PoolModel, error) {
+	pool := config.Pool
+	if len(pool.Members) == 0 {
+		return nil, fmt.Errorf("模型池至少需要一个成员")
+	}
+
+	strategy := pool.Strategy
+	switch strategy {
+	case "":
+		strategy = PoolRoundRobin
+	case PoolRoundRobin, PoolLeastInFlight, PoolWeighted:
+	default:
+		return nil, fmt.Errorf("不支持的池化策略: %s", strategy)
+	}
+
+	cooldown := pool.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultPoolCooldown
+	}
+	threshold := pool.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultPoolFailureThreshold
+	}
+
+	p := &PoolModel{
+		config:    config,
+		strategy:  strategy,
+		cooldown:  time.Duration(cooldown) * time.Second,
+		threshold: threshold,
+	}
+
+	for i, member := range pool.Members {
+		memberConfig := config
+		memberConfig.Pool = nil
+		memberConfig.Name = fmt.Sprintf("%s#%d", config.Name, i+1)
+		// 未显式配置重试时成员不重试，由池换下一个成员
+		if memberConfig.Retry == nil {
+			memberConfig.Retry = noRetry
+		}
+		if member.APIKey != "" {
+			memberConfig.APIKey = member.APIKey
+		}
+		if member.APIEndpoint != "" {
+			memberConfig.APIEndpoint = member.APIEndpoint
+		}
+
+		m, err := factory(memberConfig)
+		if err != nil {
+			return nil, fmt.Errorf("创建池成员%d失败: %w", i+1, err)
+		}
+
+		name := member.Name
+		if name == "" {
+			name = maskKey(memberConfig.APIKey)
+		}
+		weight := member.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+
+		p.members = append(p.members, &poolMember{
+			model:    m,
+			name:     name,
+			endpoint: memberConfig.APIEndpoint,
+			weight:   weight,
+		})
+	}
+
+	return p, nil
+}
+
+// Name 返回模型名称
+func (p *PoolModel) Name() string {
+	return p.config.Name
+}
+
+// Config 返回模型配置
+func (p *PoolModel) Config() ModelConfig {
+	return p.config
+}
+
+// SupportsVision 所有成员都支持时才接受图片输入
+func (p *PoolModel) SupportsVision() bool {
+	for _, member := range p.members {
+		if !SupportsVision(member.model) {
+			return false
+		}
+	}
+	return true
+}
+
+// Generate 生成文本响应
+func (p *PoolModel) Generate(ctx context.Context, prompt string) (string, error) {
+	var text string
+	err := p.do(ctx, func(m Model) error {
+		var err error
+		text, err = m.Generate(ctx, prompt)
+		return err
+	})
+	return text, err
+}
+
+// Chat 以消息列表的形式生成响应
+func (p *PoolModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	var text string
+	err := p.do(ctx, func(m Model) error {
+		var err error
+		text, err = Chat(ctx, m, messages, opts)
+		return err
+	})
+	return text, err
+}
+
+// GenerateStream 流式生成文本响应，成员的在途计数在流结束时释放
+func (p *PoolModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	return p.stream(ctx, func(m Model) (<-chan Chunk, error) {
+		return Stream(ctx, m, prompt)
+	})
+}
+
+// ChatStream 以消息列表的形式流式生成响应，成员的在途计数在流结束时释放
+func (p *PoolModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	return p.stream(ctx, func(m Model) (<-chan Chunk, error) {
+		return StreamChat(ctx, m, messages, opts)
+	})
+}
+
+// stream 选择成员建立流，建立失败且可重试时换下一个成员
+func (p *PoolModel) stream(ctx context.Context, open func(m Model) (<-chan Chunk, error)) (<-chan Chunk, error) {
+	tried := make(map[*poolMember]bool)
+	for {
+		member := p.acquire(tried)
+		if member == nil {
+			return nil, fmt.Errorf("模型池 %s 没有可用成员", p.config.Name)
+		}
+
+		ch, err := open(member.model)
+		if err != nil {
+			p.release(member, err)
+			if p.retryable(ctx, err) && len(tried) < len(p.members) {
+				continue
+			}
+			return nil, err
+		}
+
+		out := make(chan Chunk, cap(ch))
+		go func() {
+			defer close(out)
+			var streamErr error
+			for chunk := range ch {
+				if chunk.Err != nil {
+					streamErr = chunk.Err
+				}
+				select {
+				case out <- chunk:
+				case <-ctx.Done():
+					streamErr = ctx.Err()
+				}
+			}
+			p.release(member, streamErr)
+		}()
+		return out, nil
+	}
+}
+
+// Stats 返回各成员的使用统计
+func (p *PoolModel) Stats() []PoolMemberStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]PoolMemberStats, 0, len(p.members))
+	for _, member := range p.members {
+		s := PoolMemberStats{
+			Name:      member.name,
+			Endpoint:  member.endpoint,
+			Weight:    member.weight,
+			Requests:  member.requests,
+			Successes: member.successes,
+			Failures:  member.failures,
+			InFlight:  member.inFlight,
+			Healthy:   !now.Before(member.cooldownUntil),
+			LastError: member.lastError,
+		}
+		if !s.Healthy {
+			until := member.cooldownUntil
+			s.CooldownUntil = &until
+		}
+		if reporter, ok := member.model.(UsageReporter); ok {
+			usage := reporter.Usage()
+			s.Usage = &usage
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// Usage 返回所有成员的累计用量
+func (p *PoolModel) Usage() Usage {
+	var total Usage
+	for _, member := range p.members {
+		if reporter, ok := member.model.(UsageReporter); ok {
+			total.add(reporter.Usage())
+		}
+	}
+	return total
+}
+
+// do 选择成员执行调用，可重试的错误换下一个未尝试的成员
+func (p *PoolModel) do(ctx context.Context, call func(m Model) error) error {
+	tried := make(map[*poolMember]bool)
+	for {
+		member := p.acquire(tried)
+		if member == nil {
+			return fmt.Errorf("模型池 %s 没有可用成员", p.config.Name)
+		}
+
+		err := call(member.model)
+		p.release(member, err)
+		if err == nil || !p.retryable(ctx, err) || len(tried) == len(p.members) {
+			return err
+		}
+	}
+}
+
+// retryable 判断错误是否应换成员重试
+func (p *PoolModel) retryable(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && memberFault(err)
+}
+
+// acquire 按策略选择一个未尝试过的成员并增加在途计数
+//
+// 首次选择时所有成员都在冷却中，则选择最早恢复的成员，避免整个池不可用；
+// 重试时不会选择冷却中的成员。
+func (p *PoolModel) acquire(tried map[*poolMember]bool) *poolMember {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var candidates []*poolMember
+	var earliest *poolMember
+	for _, member := range p.members {
+		if tried[member] {
+			continue
+		}
+		if now.Before(member.cooldownUntil) {
+			if earliest == nil || member.cooldownUntil.Before(earliest.cooldownUntil) {
+				earliest = member
+			}
+			continue
+		}
+		candidates = append(candidates, member)
+	}
+
+	var chosen *poolMember
+	switch {
+	case len(candidates) > 0:
+		chosen = p.pick(candidates)
+	case earliest != nil && len(tried) == 0:
+		chosen = earliest
+	default:
+		return nil
+	}
+
+	tried[chosen] = true
+	chosen.requests++
+	chosen.inFlight++
+	return chosen
+}
+
+// pick 按策略从健康成员中选择，调用方持有锁
+func (p *PoolModel) pick(candidates []*poolMember) *poolMember {
+	switch p.strategy {
+	case PoolLeastInFlight:
+		p.next++
+		best := candidates[p.next%len(candidates)]
+		for _, member := range candidates {
+			if member.inFlight < best.inFlight {
+				best = member
+			}
+		}
+		return best
+	case PoolWeighted:
+		// 平滑加权轮询
+		total := 0
+		var best *poolMember
+		for _, member := range candidates {
+			member.current += member.weight
+			total += member.weight
+			if best == nil || member.current > best.current {
+				best = member
+			}
+		}
+		best.current -= total
+		return best
+	default:
+		member := candidates[p.next%len(candidates)]
+		p.next++
+		return member
+	}
+}
+
+// release 释放在途计数并更新被动健康状态
+func (p *PoolModel) release(member *poolMember, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	member.inFlight--
+	if err == nil {
+		member.successes++
+		member.consecutive = 0
+		return
+	}
+
+	member.failures++
+	member.lastError = err.Error()
+	if !memberFault(err) {
+		return
+	}
+
+	member.consecutive++
+	if member.consecutive >= p.threshold || immediateCooldown(err) {
+		member.cooldownUntil = time.Now().Add(p.cooldown)
+		member.consecutive = 0
+	}
+}
+
+// memberFault 错误是否由成员自身（密钥、地址）引起：限流、5xx、超时或认证失败
+func memberFault(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorClassRateLimit, ErrorClassServer, ErrorClassTimeout:
+		return true
+	}
+	return authError(err)
+}
+
+// immediateCooldown 限流和认证错误立即移出轮换
+func immediateCooldown(err error) bool {
+	return ClassifyError(err) == ErrorClassRateLimit || authError(err)
+}
+
+// authError 是否为401/403
+func authError(err error) bool {
+	return errors.Is(err, ErrAuthentication)
+}
+
+// maskKey 脱敏密钥，只保留末4位
+func maskKey(key string) string {
+	if key == "" {
+		return "(no key)"
+	}
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
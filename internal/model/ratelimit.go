@@ -0,0 +1,313 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// 限流默认参数
+const (
+	defaultRateLimitMaxWait = 30 // 秒
+)
+
+// ErrRateLimitWait 排队等待超过最大时长或队列已满
+var ErrRateLimitWait = errors.New("等待限流配额超时")
+
+// RateLimitConfig 客户端限流配置
+type RateLimitConfig struct {
+	RPM      int `json:"rpm,omitempty"`       // 每分钟请求数，0表示不限
+	TPM      int `json:"tpm,omitempty"`       // 每分钟token数（输入估算+max_tokens），0表示不限
+	MaxWait  int `json:"max_wait,omitempty"`  // 排队最长等待（秒），默认30
+	MaxQueue int `json:"max_queue,omitempty"` // 最大排队数，0表示不限
+}
+
+// RateLimitStats 限流统计
+type RateLimitStats struct {
+	RPM            int     `json:"rpm,omitempty"`
+	TPM            int     `json:"tpm,omitempty"`
+	QueueDepth     int     `json:"queue_depth"`      // 当前排队数
+	MaxQueueDepth  int     `json:"max_queue_depth"`  // 历史最大排队数
+	Admitted       int64   `json:"admitted"`         // 已放行请求数
+	Queued         int64   `json:"queued"`           // 曾排队的请求数
+	Rejected       int64   `json:"rejected"`         // 等待超时或队列已满被拒绝的请求数
+	AvgWaitSeconds float64 `json:"avg_wait_seconds"` // 排队请求的平均等待时长
+}
+
+// Unwrapper 包装其他模型的装饰器模型
+type Unwrapper interface {
+	// Unwrap 返回被包装的模型
+	Unwrap() Model
+}
+
+// tokenBucket 按分钟配额匀速补充的令牌桶，调用方持有锁
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	rate     float64 // 每秒补充量
+	last     time.Time
+}
+
+// newTokenBucket 创建满额的令牌桶，perMinute为0时返回nil表示不限
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		last:     now,
+	}
+}
+
+// refill 按流逝时间补充令牌
+func (b *tokenBucket) refill(now time.Time) {
+	if b == nil {
+		return
+	}
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait 返回凑够n个令牌还需等待的时长，n超过容量时按容量计算
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	n = math.Min(n, b.capacity)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take 扣除令牌
+func (b *tokenBucket) take(n float64) {
+	if b == nil {
+		return
+	}
+	b.tokens -= math.Min(n, b.capacity)
+}
+
+// rateWaiter 排队中的请求
+type rateWaiter struct {
+	tokens  float64
+	ready   chan struct{}
+	granted bool
+}
+
+// RateLimitedModel 按RPM/TPM令牌桶限流的模型包装
+//
+// 配额不足时请求按到达顺序排队（先到先得，后到的小请求不会插队），
+// 超过最长等待或队列已满时返回ErrRateLimitWait。
+type RateLimitedModel struct {
+	Model
+	config    RateLimitConfig
+	maxWait   time.Duration
+	maxTokens int
+
+	mu          sync.Mutex
+	requests    *tokenBucket
+	tokens      *tokenBucket
+	queue       []*rateWaiter
+	dispatching bool
+	stats       RateLimitStats
+	totalWait   time.Duration
+}
+
+// NewRateLimitedModel 创建限流包装
+func NewRateLimitedModel(m Model, config RateLimitConfig) *RateLimitedModel {
+	maxWait := config.MaxWait
+	if maxWait <= 0 {
+		maxWait = defaultRateLimitMaxWait
+	}
+
+	now := time.Now()
+	return &RateLimitedModel{
+		Model:     m,
+		config:    config,
+		maxWait:   time.Duration(maxWait) * time.Second,
+		maxTokens: m.Config().MaxTokens,
+		requests:  newTokenBucket(config.RPM, now),
+		tokens:    newTokenBucket(config.TPM, now),
+	}
+}
+
+// Unwrap 返回被包装的模型
+func (m *RateLimitedModel) Unwrap() Model {
+	return m.Model
+}
+
+// Generate 生成文本响应
+func (m *RateLimitedModel) Generate(ctx context.Context, prompt string) (string, error) {
+	if err := m.acquire(ctx, m.estimate(prompt, 0)); err != nil {
+		return "", err
+	}
+	return m.Model.Generate(ctx, prompt)
+}
+
+// Chat 以消息列表的形式生成响应
+func (m *RateLimitedModel) Chat(ctx context.Context, messages []Message, opts ChatOptions) (string, error) {
+	if err := m.acquire(ctx, m.reserve(CountMessageTokens(m.Config().ModelID, messages), opts.MaxTokens)); err != nil {
+		return "", err
+	}
+	return Chat(ctx, m.Model, messages, opts)
+}
+
+// GenerateStream 流式生成文本响应
+func (m *RateLimitedModel) GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error) {
+	if err := m.acquire(ctx, m.estimate(prompt, 0)); err != nil {
+		return nil, err
+	}
+	return Stream(ctx, m.Model, prompt)
+}
+
+// ChatStream 以消息列表的形式流式生成响应
+func (m *RateLimitedModel) ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	if err := m.acquire(ctx, m.reserve(CountMessageTokens(m.Config().ModelID, messages), opts.MaxTokens)); err != nil {
+		return nil, err
+	}
+	return StreamChat(ctx, m.Model, messages, opts)
+}
+
+// Stats 返回限流统计
+func (m *RateLimitedModel) Stats() RateLimitStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.RPM = m.config.RPM
+	stats.TPM = m.config.TPM
+	stats.QueueDepth = len(m.queue)
+	if stats.Queued > 0 {
+		stats.AvgWaitSeconds = m.totalWait.Seconds() / float64(stats.Queued)
+	}
+	return stats
+}
+
+// estimate 估算请求占用的token：输入token数加上最大输出token
+func (m *RateLimitedModel) estimate(text string, maxTokens int) float64 {
+	return m.reserve(CountTokens(m.Config().ModelID, text), maxTokens)
+}
+
+// reserve 返回输入token数加上最大输出token
+func (m *RateLimitedModel) reserve(inputTokens, maxTokens int) float64 {
+	if maxTokens <= 0 {
+		maxTokens = m.maxTokens
+	}
+	return float64(inputTokens + maxTokens)
+}
+
+// acquire 获取一次请求和n个token的配额，必要时排队等待
+func (m *RateLimitedModel) acquire(ctx context.Context, n float64) error {
+	m.mu.Lock()
+	now := time.Now()
+	m.requests.refill(now)
+	m.tokens.refill(now)
+
+	// 无人排队且配额充足时直接放行
+	if len(m.queue) == 0 && m.requests.wait(1) == 0 && m.tokens.wait(n) == 0 {
+		m.requests.take(1)
+		m.tokens.take(n)
+		m.stats.Admitted++
+		m.mu.Unlock()
+		return nil
+	}
+
+	if m.config.MaxQueue > 0 && len(m.queue) >= m.config.MaxQueue {
+		m.stats.Rejected++
+		m.mu.Unlock()
+		return fmt.Errorf("模型 %s 排队已满: %w", m.Name(), ErrRateLimitWait)
+	}
+
+	w := &rateWaiter{tokens: n, ready: make(chan struct{})}
+	m.queue = append(m.queue, w)
+	m.stats.Queued++
+	if len(m.queue) > m.stats.MaxQueueDepth {
+		m.stats.MaxQueueDepth = len(m.queue)
+	}
+	if !m.dispatching {
+		m.dispatching = true
+		go m.dispatch()
+	}
+	m.mu.Unlock()
+
+	timer := time.NewTimer(m.maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-w.ready:
+		m.recordWait(now)
+		return nil
+	case <-timer.C:
+		return m.abandon(w, now, fmt.Errorf("模型 %s 等待超过%v: %w", m.Name(), m.maxWait, ErrRateLimitWait))
+	case <-ctx.Done():
+		return m.abandon(w, now, ctx.Err())
+	}
+}
+
+// abandon 等待者放弃排队；若已被放行则继续执行
+func (m *RateLimitedModel) abandon(w *rateWaiter, since time.Time, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w.granted {
+		m.totalWait += time.Since(since)
+		return nil
+	}
+
+	for i, queued := range m.queue {
+		if queued == w {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			break
+		}
+	}
+	m.stats.Rejected++
+	return err
+}
+
+// recordWait 记录排队时长
+func (m *RateLimitedModel) recordWait(since time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totalWait += time.Since(since)
+}
+
+// dispatch 按顺序放行队首请求，队列为空时退出
+func (m *RateLimitedModel) dispatch() {
+	for {
+		m.mu.Lock()
+		if len(m.queue) == 0 {
+			m.dispatching = false
+			m.mu.Unlock()
+			return
+		}
+
+		now := time.Now()
+		m.requests.refill(now)
+		m.tokens.refill(now)
+
+		head := m.queue[0]
+		wait := m.requests.wait(1)
+		if tokenWait := m.tokens.wait(head.tokens); tokenWait > wait {
+			wait = tokenWait
+		}
+		if wait == 0 {
+			m.requests.take(1)
+			m.tokens.take(head.tokens)
+			m.queue = m.queue[1:]
+			head.granted = true
+			m.stats.Admitted++
+			close(head.ready)
+			m.mu.Unlock()
+			continue
+		}
+		m.mu.Unlock()
+
+		time.Sleep(wait)
+	}
+}
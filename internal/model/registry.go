@@ -22,14 +22,77 @@ type Model interface {
 // ModelConfig ModelConfig模型配置
 type ModelConfig struct {
 	Name        string  `json:"name"`
+	Provider    string  `json:"provider,omitempty"` // 工厂名称，为空时按ModelID查找
 	APIKey      string  `json:"api_key"`
 	APIEndpoint string  `json:"api_endpoint"`
 	ModelID     string  `json:"model_id"`
 	Timeout     int     `json:"timeout"` //秒
 	MaxTokens   int     `json:"max_tokens"`
 	Temperature float64 `json:"temperature"`
+	Vision      *bool   `json:"vision,omitempty"` // 是否接受图片输入，为空时按模型类型的能力描述
+
+	// HTTP选项（OpenAI兼容服务）
+	Headers      map[string]string `json:"headers,omitempty"`      // 附加请求头
+	Organization string            `json:"organization,omitempty"` // OpenAI-Organization请求头
+	Project      string            `json:"project,omitempty"`      // OpenAI-Project请求头
+	Path         string            `json:"path,omitempty"`         // 覆盖接口路径，默认/chat/completions
+
+	// Retry 429、5xx和连接重置的自动重试，为空时使用默认值（重试2次）
+	Retry *RetryConfig `json:"retry,omitempty"`
+
+	// Pool 多密钥/多地址池，配置后按成员分别创建实例并负载均衡
+	Pool *PoolConfig `json:"pool,omitempty"`
+
+	// RateLimit 客户端RPM/TPM限流，超出配额的请求排队等待
+	RateLimit *RateLimitConfig `json:"rate_limit,omitempty"`
+
+	// Breaker 熔断器，服务连续失败后快速失败而不再等待超时
+	Breaker *BreakerConfig `json:"breaker,omitempty"`
+
+	// Cache 响应缓存，相同的提示词和参数直接返回缓存的结果
+	Cache *CacheConfig `json:"cache,omitempty"`
+
+	// 回退链（Provider为fallback时）：按顺序尝试的已创建模型名称，以及触发回退的错误类别
+	Fallback   []string `json:"fallback,omitempty"`
+	FallbackOn []string `json:"fallback_on,omitempty"`
+
+	// Capabilities 覆盖模型类型的能力描述（上下文窗口、最大输出、工具调用、JSON模式、价格）
+	Capabilities *CapabilityOverrides `json:"capabilities,omitempty"`
+
+	// Options 提供方特有的选项，如Ollama的keep_alive、num_ctx、format
+	Options map[string]interface{} `json:"options,omitempty"`
 }
 
+// OptionString 读取字符串类型的提供方选项，不存在或类型不符时返回空字符串
+func (c ModelConfig) OptionString(key string) string {
+	value, _ := c.Options[key].(string)
+	return value
+}
+
+// OptionStringMap 读取字符串映射类型的提供方选项，忽略非字符串的值
+func (c ModelConfig) OptionStringMap(key string) map[string]string {
+	result := make(map[string]string)
+	switch values := c.Options[key].(type) {
+	case map[string]string:
+		for k, v := range values {
+			result[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range values {
+			if s, ok := v.(string); ok {
+				result[k] = s
+			}
+		}
+	}
+	return result
+}
+
+// 通用提供方名称
+const (
+	ProviderOpenAICompatible = "openai-compatible"
+	ProviderAzureOpenAI      = "azure-openai"
+)
+
 // ModelFactory ModelFactory模型工厂函数
 type ModelFactory func(config ModelConfig) (Model, error)
 
@@ -38,13 +101,25 @@ type ModelRegistry struct {
 	factories map[string]ModelFactory
 	models    map[string]Model
 	mu        sync.RWMutex
+
+	breakerListeners []func(BreakerEvent)
+	listenersMu      sync.RWMutex
+
+	capabilities map[string]Capabilities // 按模型ID前缀的能力描述
+	capsMu       sync.RWMutex
 }
 
 // NewModelRegistry 创建新的模型注册表
 func NewModelRegistry() *ModelRegistry {
+	capabilities := make(map[string]Capabilities, len(builtinCapabilities))
+	for prefix, caps := range builtinCapabilities {
+		capabilities[prefix] = caps
+	}
+
 	return &ModelRegistry{
-		factories: make(map[string]ModelFactory),
-		models:    make(map[string]Model),
+		factories:    make(map[string]ModelFactory),
+		models:       make(map[string]Model),
+		capabilities: capabilities,
 	}
 }
 
@@ -71,28 +146,105 @@ func (r *ModelRegistry) CreateModel(config ModelConfig) (Model, error) {
 		return model, nil
 	}
 
-	// 获取工厂函数
-	factory, exists := r.factories[config.ModelID]
-	if !exists {
-		// 如果没有找到特定模型的工厂，使用默认工厂
-		factory = r.getDefaultFactory(config.ModelID)
-		if factory == nil {
-			return nil, fmt.Errorf("不支持的模型类型: %s", config.ModelID)
-		}
+	if config.Provider == ProviderFallback {
+		return r.createFallback(config)
+	}
+
+	factory, err := r.factoryFor(config)
+	if err != nil {
+		return nil, err
 	}
 
-	// 创建模型实例
-	model, err := factory(config)
+	// 创建模型实例，配置了池时为每个成员分别创建
+	var model Model
+	if config.Pool != nil {
+		model, err = newPoolModel(config, factory)
+	} else {
+		model, err = factory(config)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("创建模型失败: %w", err)
 	}
 
+	// 限流作用于整个模型（池的所有成员共享配额）
+	if config.RateLimit != nil {
+		model = NewRateLimitedModel(model, *config.RateLimit)
+	}
+	if config.Breaker != nil {
+		model = NewCircuitBreakerModel(model, *config.Breaker, r.notifyBreaker)
+	}
+	if config.Cache != nil {
+		store, err := newCacheStore(*config.Cache)
+		if err != nil {
+			return nil, fmt.Errorf("创建响应缓存失败: %w", err)
+		}
+		model = NewCachedModel(model, store, *config.Cache)
+	}
+
 	//缓模型模型实例
 	r.models[config.Name] = model
 
 	return model, nil
 }
 
+// OnBreakerStateChange 订阅注册表创建的模型的熔断器状态变化
+func (r *ModelRegistry) OnBreakerStateChange(listener func(BreakerEvent)) {
+	r.listenersMu.Lock()
+	defer r.listenersMu.Unlock()
+	r.breakerListeners = append(r.breakerListeners, listener)
+}
+
+// notifyBreaker 把熔断器状态变化分发给订阅者
+func (r *ModelRegistry) notifyBreaker(event BreakerEvent) {
+	r.listenersMu.RLock()
+	defer r.listenersMu.RUnlock()
+	for _, listener := range r.breakerListeners {
+		listener(event)
+	}
+}
+
+// createFallback 用已创建的模型组成回退链，并以虚拟名称缓存
+func (r *ModelRegistry) createFallback(config ModelConfig) (Model, error) {
+	members := make([]Model, 0, len(config.Fallback))
+	for _, name := range config.Fallback {
+		member, exists := r.models[name]
+		if !exists {
+			return nil, fmt.Errorf("回退链 %s 引用的模型 %s 不存在", config.Name, name)
+		}
+		members = append(members, member)
+	}
+
+	model, err := NewFallbackModel(config, members)
+	if err != nil {
+		return nil, fmt.Errorf("创建回退链失败: %w", err)
+	}
+
+	r.models[config.Name] = model
+	return model, nil
+}
+
+// factoryFor 查找模型工厂，显式指定的提供方优先，其次按ModelID查找
+func (r *ModelRegistry) factoryFor(config ModelConfig) (ModelFactory, error) {
+	if config.Provider != "" {
+		factory, exists := r.factories[config.Provider]
+		if !exists {
+			return nil, fmt.Errorf("不支持的模型提供方: %s", config.Provider)
+		}
+		return factory, nil
+	}
+
+	factory, exists := r.factories[config.ModelID]
+	if !exists {
+		// 如果没有找到特定模型的工厂，使用默认工厂
+		factory = r.getDefaultFactory(config.ModelID)
+		if factory == nil {
+			return nil, fmt.Errorf("不支持的模型类型: %s", config.ModelID)
+		}
+	}
+
+	return factory, nil
+}
+
 // GetModel 获取已创建的模型
 func (r *ModelRegistry) GetModel(name string) (Model, bool) {
 	r.mu.RLock()
@@ -124,6 +276,10 @@ func (r *ModelRegistry) getDefaultFactory(modelType string) ModelFactory {
 		return NewQwenModel
 	case isOpenAI(modelType):
 		return NewOpenAIModel
+	case isAnthropic(modelType):
+		return NewAnthropicModel
+	case isGemini(modelType):
+		return NewGeminiModel
 	default:
 		return nil
 	}
@@ -156,3 +312,8 @@ func RegisterModel(name string, factory ModelFactory) error {
 func CreateModel(config ModelConfig) (Model, error) {
 	return GlobalRegistry.CreateModel(config)
 }
+
+// OnBreakerStateChange 订阅全局注册表中模型的熔断器状态变化
+func OnBreakerStateChange(listener func(BreakerEvent)) {
+	GlobalRegistry.OnBreakerStateChange(listener)
+}
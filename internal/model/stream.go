@@ -0,0 +1,222 @@
+package model
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// errStreamTruncated 流式响应在结束标记（如[DONE]、finish_reason、done）之前中断
+var errStreamTruncated = fmt.Errorf("流式响应在结束前中断: %w", io.ErrUnexpectedEOF)
+
+// Chunk 流式生成的一个片段
+type Chunk struct {
+	Content string // 增量文本
+	Done    bool   // 生成结束
+	Err     error  // 流式过程中的错误，出现后通道随即关闭
+}
+
+// StreamingModel 支持流式生成的模型
+type StreamingModel interface {
+	Model
+
+	// GenerateStream 流式生成文本，通道在生成结束或出错后关闭
+	GenerateStream(ctx context.Context, prompt string) (<-chan Chunk, error)
+}
+
+// ChatStreamingModel 支持以消息列表流式生成的模型
+type ChatStreamingModel interface {
+	Model
+
+	// ChatStream 以消息列表流式生成文本，通道在生成结束或出错后关闭
+	ChatStream(ctx context.Context, messages []Message, opts ChatOptions) (<-chan Chunk, error)
+}
+
+// Stream 流式生成文本；模型不支持流式时退化为一次性返回完整结果
+func Stream(ctx context.Context, m Model, prompt string) (<-chan Chunk, error) {
+	if sm, ok := m.(StreamingModel); ok {
+		return sm.GenerateStream(ctx, prompt)
+	}
+
+	text, err := m.Generate(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return completeStream(text), nil
+}
+
+// StreamChat 以消息列表流式生成文本
+//
+// 模型不支持消息流式时，只有一条不带图片的user消息且没有调用参数则退化为Stream，
+// 否则通过Chat一次性返回完整结果，保证system提示词、对话历史和图片不会丢失。
+func StreamChat(ctx context.Context, m Model, messages []Message, opts ChatOptions) (<-chan Chunk, error) {
+	if err := CheckImages(m, messages); err != nil {
+		return nil, err
+	}
+	if cm, ok := m.(ChatStreamingModel); ok {
+		return cm.ChatStream(ctx, messages, opts)
+	}
+	if len(messages) == 1 && messages[0].Role == RoleUser && len(messages[0].Images) == 0 && opts.isZero() {
+		return Stream(ctx, m, messages[0].Content)
+	}
+
+	text, err := Chat(ctx, m, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	return completeStream(text), nil
+}
+
+// completeStream 把完整文本包装为只有一个片段的流
+func completeStream(text string) <-chan Chunk {
+	ch := make(chan Chunk, 2)
+	ch <- Chunk{Content: text}
+	ch <- Chunk{Done: true}
+	close(ch)
+	return ch
+}
+
+// Collect 读取完整的流并拼接文本，onDelta不为nil时对每个片段回调
+func Collect(ch <-chan Chunk, onDelta func(delta string)) (string, error) {
+	var sb strings.Builder
+	for chunk := range ch {
+		if chunk.Err != nil {
+			return sb.String(), chunk.Err
+		}
+		if chunk.Content != "" {
+			sb.WriteString(chunk.Content)
+			if onDelta != nil {
+				onDelta(chunk.Content)
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+// sseDeltaParser 解析一条SSE data（或NDJSON的一行），返回增量文本以及流是否结束
+type sseDeltaParser func(data string) (delta string, done bool, err error)
+
+// streamReader 逐条读取流式响应中的消息，handle返回true时停止读取
+type streamReader func(r io.Reader, handle func(data string) (bool, error)) error
+
+// streamSSE 发送请求并把SSE响应转换为Chunk通道
+func streamSSE(client *http.Client, req *http.Request, parse sseDeltaParser) (<-chan Chunk, error) {
+	req.Header.Set("Accept", "text/event-stream")
+	return streamResponse(client, req, readSSE, parse)
+}
+
+// streamNDJSON 发送请求并把NDJSON（每行一个JSON对象）响应转换为Chunk通道
+func streamNDJSON(client *http.Client, req *http.Request, parse sseDeltaParser) (<-chan Chunk, error) {
+	req.Header.Set("Accept", "application/x-ndjson")
+	return streamResponse(client, req, readNDJSON, parse)
+}
+
+// streamResponse 发送请求并在后台读取流式响应
+func streamResponse(client *http.Client, req *http.Request, read streamReader, parse sseDeltaParser) (<-chan Chunk, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
+	}
+
+	ch := make(chan Chunk, 16)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+
+		finished := false
+		err := read(resp.Body, func(data string) (bool, error) {
+			delta, done, err := parse(data)
+			if err != nil {
+				return false, err
+			}
+			if delta != "" {
+				select {
+				case ch <- Chunk{Content: delta}:
+				case <-req.Context().Done():
+					return false, req.Context().Err()
+				}
+			}
+			finished = done
+			return done, nil
+		})
+		if err == nil && !finished {
+			err = errStreamTruncated
+		}
+		final := Chunk{Done: true}
+		if err != nil {
+			final = Chunk{Err: err}
+		}
+		select {
+		case ch <- final:
+		case <-req.Context().Done():
+		}
+	}()
+
+	return ch, nil
+}
+
+// readSSE 逐条读取SSE事件的data字段，handle返回true时停止读取
+func readSSE(r io.Reader, handle func(data string) (bool, error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var data []string
+	flush := func() (bool, error) {
+		if len(data) == 0 {
+			return false, nil
+		}
+		payload := strings.Join(data, "\n")
+		data = data[:0]
+		return handle(payload)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// 空行表示一个事件结束
+			if done, err := flush(); done || err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取流式响应失败: %w", err)
+	}
+
+	_, err := flush()
+	return err
+}
+
+// readNDJSON 逐行读取NDJSON，忽略空行
+func readNDJSON(r io.Reader, handle func(data string) (bool, error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if done, err := handle(line); done || err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取流式响应失败: %w", err)
+	}
+	return nil
+}
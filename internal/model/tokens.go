@@ -0,0 +1,26 @@
+package model
+
+import "aigent/internal/tokenizer"
+
+// 每条消息的格式开销（角色标记和分隔符），以及回复开头的引导token，与OpenAI的计数方式一致
+const (
+	messageOverheadTokens = 3
+	replyPrimingTokens    = 3
+)
+
+// CountTokens 按模型计算文本的token数
+//
+// OpenAI模型使用cl100k_base/o200k_base精确计数，其他模型使用启发式估算。
+func CountTokens(modelID, text string) int {
+	return tokenizer.Count(modelID, text)
+}
+
+// CountMessageTokens 估算消息列表作为输入时占用的token数，包含每条消息的格式开销
+func CountMessageTokens(modelID string, messages []Message) int {
+	counter := tokenizer.ForModel(modelID)
+	total := replyPrimingTokens
+	for _, msg := range messages {
+		total += messageOverheadTokens + counter.Count(msg.Role) + counter.Count(msg.Content)
+	}
+	return total
+}
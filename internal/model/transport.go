@@ -0,0 +1,184 @@
+package model
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// 重试默认参数
+const (
+	defaultMaxRetries = 2
+	defaultBaseDelay  = 500 // 毫秒
+	defaultMaxDelay   = 30  // 秒
+)
+
+// RetryConfig HTTP请求重试配置
+type RetryConfig struct {
+	MaxRetries int `json:"max_retries,omitempty"` // 最大重试次数，默认2，-1表示不重试
+	BaseDelay  int `json:"base_delay,omitempty"`  // 首次重试前的等待（毫秒），默认500，之后按指数增长
+	MaxDelay   int `json:"max_delay,omitempty"`   // 单次等待上限（秒），默认30；Retry-After超过上限时不再重试
+}
+
+// noRetry 不重试的配置
+var noRetry = &RetryConfig{MaxRetries: -1}
+
+// newHTTPClient 创建模型专用的HTTP客户端：连接复用调优，并对429、5xx和连接重置自动重试
+//
+// 每个模型实例创建一次并在所有调用间复用。Timeout为整个调用（含重试）的时限。
+func newHTTPClient(config ModelConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 32
+	transport.IdleConnTimeout = 90 * time.Second
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ExpectContinueTimeout = time.Second
+	transport.DialContext = (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+
+	return &http.Client{
+		Timeout:   time.Duration(config.Timeout) * time.Second,
+		Transport: newRetryTransport(transport, config.Retry),
+	}
+}
+
+// retryTransport 带指数退避重试的RoundTripper
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// newRetryTransport 按配置包装base，config为nil时使用默认值
+func newRetryTransport(base http.RoundTripper, config *RetryConfig) *retryTransport {
+	t := &retryTransport{
+		base:       base,
+		maxRetries: defaultMaxRetries,
+		baseDelay:  defaultBaseDelay * time.Millisecond,
+		maxDelay:   defaultMaxDelay * time.Second,
+	}
+	if config == nil {
+		return t
+	}
+
+	if config.MaxRetries < 0 {
+		t.maxRetries = 0
+	} else if config.MaxRetries > 0 {
+		t.maxRetries = config.MaxRetries
+	}
+	if config.BaseDelay > 0 {
+		t.baseDelay = time.Duration(config.BaseDelay) * time.Millisecond
+	}
+	if config.MaxDelay > 0 {
+		t.maxDelay = time.Duration(config.MaxDelay) * time.Second
+	}
+	return t
+}
+
+// RoundTrip 发送请求，可重试的失败按退避时间等待后重发
+//
+// 等待时间优先使用响应的Retry-After；剩余的ctx时限不足以等待时直接返回最后一次的结果。
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			attemptReq = req.Clone(ctx)
+			if req.Body != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if attempt >= t.maxRetries || !retryableResponse(resp, err) || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		wait, ok := t.backoff(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Until(deadline) < wait {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// backoff 返回第attempt次失败后的等待时间；Retry-After超过上限时返回false
+func (t *retryTransport) backoff(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header); ok {
+			return wait, wait <= t.maxDelay
+		}
+	}
+
+	// 指数退避，乘以0.5~1的随机因子避免并发请求同时重试
+	wait := t.baseDelay << uint(attempt)
+	if wait <= 0 || wait > t.maxDelay {
+		wait = t.maxDelay
+	}
+	return time.Duration(float64(wait) * (0.5 + rand.Float64()/2)), true
+}
+
+// retryableResponse 429、5xx（501除外）和连接重置可以重试
+func retryableResponse(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF)
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// retryAfter 解析Retry-After（秒数或HTTP日期）和OpenAI的retry-after-ms响应头
+func retryAfter(header http.Header) (time.Duration, bool) {
+	if ms := header.Get("Retry-After-Ms"); ms != "" {
+		if value, err := strconv.ParseFloat(ms, 64); err == nil && value >= 0 {
+			return time.Duration(value * float64(time.Millisecond)), true
+		}
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
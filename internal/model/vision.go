@@ -0,0 +1,135 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// defaultImageMediaType 未指定时base64图片的MIME类型
+const defaultImageMediaType = "image/png"
+
+// ErrVisionUnsupported 向不支持视觉输入的模型发送了图片
+var ErrVisionUnsupported = errors.New("模型不支持图片输入")
+
+// ImagePart 消息附带的图片，URL和Data二选一
+type ImagePart struct {
+	URL       string `json:"url,omitempty"`        // http(s)地址或data URL
+	Data      string `json:"data,omitempty"`       // base64编码的图片内容
+	MediaType string `json:"media_type,omitempty"` // Data的MIME类型，默认image/png
+	Detail    string `json:"detail,omitempty"`     // 解析精度low/high/auto，仅OpenAI使用
+}
+
+// Validate 检查图片来源是否有效
+func (p ImagePart) Validate() error {
+	switch {
+	case p.URL != "" && p.Data != "":
+		return fmt.Errorf("图片的url和data只能指定一个")
+	case p.URL != "":
+		u, err := url.Parse(p.URL)
+		if err != nil {
+			return fmt.Errorf("图片地址无效: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "data" {
+			return fmt.Errorf("图片地址只支持http、https和data: %s", u.Scheme)
+		}
+	case p.Data != "":
+		if p.MediaType != "" && !strings.HasPrefix(p.MediaType, "image/") {
+			return fmt.Errorf("不支持的图片类型: %s", p.MediaType)
+		}
+		if _, err := base64.StdEncoding.DecodeString(p.Data); err != nil {
+			return fmt.Errorf("图片base64解码失败: %w", err)
+		}
+	default:
+		return fmt.Errorf("图片需要指定url或data")
+	}
+
+	switch p.Detail {
+	case "", "low", "high", "auto":
+		return nil
+	default:
+		return fmt.Errorf("不支持的图片精度: %s", p.Detail)
+	}
+}
+
+// DataURL 返回图片的地址，base64内容转换为data URL
+func (p ImagePart) DataURL() string {
+	if p.URL != "" {
+		return p.URL
+	}
+	mediaType := p.MediaType
+	if mediaType == "" {
+		mediaType = defaultImageMediaType
+	}
+	return "data:" + mediaType + ";base64," + p.Data
+}
+
+// HasImages 消息列表中是否包含图片
+func HasImages(messages []Message) bool {
+	for _, msg := range messages {
+		if len(msg.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// VisionModel 能声明是否支持图片输入的模型
+type VisionModel interface {
+	// SupportsVision 是否接受消息中的图片
+	SupportsVision() bool
+}
+
+// SupportsVision 判断模型是否支持图片输入，依次展开包装模型，未声明的模型视为不支持
+func SupportsVision(m Model) bool {
+	switch v := m.(type) {
+	case VisionModel:
+		return v.SupportsVision()
+	case Unwrapper:
+		return SupportsVision(v.Unwrap())
+	default:
+		return false
+	}
+}
+
+// visionEnabled 按配置判断是否支持图片输入：显式配置优先，否则按模型类型的能力描述
+func visionEnabled(config ModelConfig) bool {
+	if config.Vision != nil {
+		return *config.Vision
+	}
+	return GlobalRegistry.TypeCapabilities(config.ModelID, "").HasModality(ModalityImage)
+}
+
+// CheckImages 校验消息中的图片，并确认模型支持图片输入
+func CheckImages(m Model, messages []Message) error {
+	if !HasImages(messages) {
+		return nil
+	}
+	if !SupportsVision(m) {
+		return fmt.Errorf("%s: %w", m.Name(), ErrVisionUnsupported)
+	}
+	for _, msg := range messages {
+		for i, image := range msg.Images {
+			if err := image.Validate(); err != nil {
+				return fmt.Errorf("第%d张图片无效: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateImages 校验发送给已创建模型的图片，模型未声明视觉能力时拒绝
+func (r *ModelRegistry) ValidateImages(name string, images []ImagePart) error {
+	m, exists := r.GetModel(name)
+	if !exists {
+		return fmt.Errorf("模型 %s 不存在", name)
+	}
+	return CheckImages(m, []Message{{Role: RoleUser, Images: images}})
+}
+
+// ValidateImages 校验发送给全局注册表中模型的图片
+func ValidateImages(name string, images []ImagePart) error {
+	return GlobalRegistry.ValidateImages(name, images)
+}
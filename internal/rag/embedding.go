@@ -0,0 +1,126 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 嵌入模型默认配置
+const (
+	defaultEmbeddingEndpoint = "https://api.openai.com/v1"
+	defaultEmbeddingTimeout  = 30 // 秒
+)
+
+// EmbeddingConfig 嵌入模型配置，使用兼容OpenAI的/embeddings接口
+type EmbeddingConfig struct {
+	Model       string            `json:"model"`                  // 如text-embedding-3-small
+	APIKey      string            `json:"api_key,omitempty"`      // 本地服务可以为空
+	APIEndpoint string            `json:"api_endpoint,omitempty"` // 基础URL，默认https://api.openai.com/v1
+	Dimensions  int               `json:"dimensions,omitempty"`   // 输出维度，为0时使用模型默认值
+	Headers     map[string]string `json:"headers,omitempty"`
+	Timeout     int               `json:"timeout,omitempty"` // 秒，默认30
+}
+
+// Configured 是否配置了嵌入模型
+func (c EmbeddingConfig) Configured() bool {
+	return c.Model != ""
+}
+
+// OpenAIEmbeddingModel 兼容OpenAI /embeddings接口的嵌入模型（OpenAI、Azure网关、vLLM、Ollama等）
+type OpenAIEmbeddingModel struct {
+	config EmbeddingConfig
+	url    string
+	client *http.Client
+}
+
+// NewEmbeddingModel 按配置创建嵌入模型
+func NewEmbeddingModel(config EmbeddingConfig) (*OpenAIEmbeddingModel, error) {
+	if !config.Configured() {
+		return nil, fmt.Errorf("未配置嵌入模型")
+	}
+
+	endpoint := config.APIEndpoint
+	if endpoint == "" {
+		endpoint = defaultEmbeddingEndpoint
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultEmbeddingTimeout
+	}
+
+	return &OpenAIEmbeddingModel{
+		config: config,
+		url:    strings.TrimSuffix(strings.TrimRight(endpoint, "/"), "/embeddings") + "/embeddings",
+		client: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+	}, nil
+}
+
+// embeddingRequest /embeddings请求结构
+type embeddingRequest struct {
+	Model      string `json:"model"`
+	Input      string `json:"input"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+// embeddingResponse /embeddings响应结构
+type embeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed生成文本嵌入向量
+func (m *OpenAIEmbeddingModel) Embed(ctx context.Context, text string) ([]float32, error) {
+	body, err := json.Marshal(embeddingRequest{
+		Model:      m.config.Model,
+		Input:      text,
+		Dimensions: m.config.Dimensions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化嵌入请求失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建嵌入请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.config.APIKey)
+	}
+	for key, value := range m.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("嵌入请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("嵌入请求失败: %s - %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var response embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("解析嵌入响应失败: %w", err)
+	}
+	if len(response.Data) == 0 || len(response.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("嵌入响应为空")
+	}
+
+	return response.Data[0].Embedding, nil
+}
+
+// Name模型名称
+func (m *OpenAIEmbeddingModel) Name() string {
+	return m.config.Model
+}
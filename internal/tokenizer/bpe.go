@@ -0,0 +1,188 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// vocabFS 内嵌的词表文件，来自OpenAI tiktoken发布的cl100k_base/o200k_base（MIT许可），
+// 每行为“base64编码的字节序列 排名”
+//
+//go:embed vocab/*.tiktoken
+var vocabFS embed.FS
+
+// 编码名称
+const (
+	Cl100kBase = "cl100k_base"
+	O200kBase  = "o200k_base"
+)
+
+// Encoding 基于字节级BPE的编码，词表在首次使用时加载
+type Encoding struct {
+	name  string
+	split splitFunc
+
+	once    sync.Once
+	ranks   map[string]int
+	loadErr error
+}
+
+// 内置编码
+var (
+	cl100k = &Encoding{name: Cl100kBase, split: splitCl100k}
+	o200k  = &Encoding{name: O200kBase, split: splitO200k}
+)
+
+// GetEncoding 按名称返回内置编码
+func GetEncoding(name string) (*Encoding, error) {
+	switch name {
+	case Cl100kBase:
+		return cl100k, nil
+	case O200kBase:
+		return o200k, nil
+	default:
+		return nil, fmt.Errorf("不支持的编码: %s", name)
+	}
+}
+
+// Name 返回编码名称
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Encode 把文本编码为token ID
+func (e *Encoding) Encode(text string) ([]int, error) {
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+
+	var tokens []int
+	for _, piece := range e.split(text) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, e.bytePairEncode([]byte(piece))...)
+	}
+	return tokens, nil
+}
+
+// Count 返回文本的token数
+func (e *Encoding) Count(text string) int {
+	if err := e.load(); err != nil {
+		return Heuristic.Count(text)
+	}
+
+	count := 0
+	for _, piece := range e.split(text) {
+		if _, ok := e.ranks[piece]; ok {
+			count++
+			continue
+		}
+		count += len(e.bytePairMerge([]byte(piece))) - 1
+	}
+	return count
+}
+
+// load 解析内嵌的词表
+func (e *Encoding) load() error {
+	e.once.Do(func() {
+		data, err := vocabFS.ReadFile("vocab/" + e.name + ".tiktoken")
+		if err != nil {
+			e.loadErr = fmt.Errorf("读取词表失败: %w", err)
+			return
+		}
+
+		ranks := make(map[string]int, bytes.Count(data, []byte("\n"))+1)
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			fields := bytes.Fields(scanner.Bytes())
+			if len(fields) == 0 {
+				continue
+			}
+			if len(fields) != 2 {
+				e.loadErr = fmt.Errorf("词表%s第%d行格式错误", e.name, line)
+				return
+			}
+			token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+			if err != nil {
+				e.loadErr = fmt.Errorf("词表%s第%d行解码失败: %w", e.name, line, err)
+				return
+			}
+			rank, err := strconv.Atoi(string(fields[1]))
+			if err != nil {
+				e.loadErr = fmt.Errorf("词表%s第%d行排名无效: %w", e.name, line, err)
+				return
+			}
+			ranks[string(token)] = rank
+		}
+		if err := scanner.Err(); err != nil {
+			e.loadErr = fmt.Errorf("读取词表失败: %w", err)
+			return
+		}
+
+		e.ranks = ranks
+	})
+	return e.loadErr
+}
+
+// bytePairEncode 对不在词表中的片段做BPE，返回token ID
+func (e *Encoding) bytePairEncode(piece []byte) []int {
+	bounds := e.bytePairMerge(piece)
+	tokens := make([]int, 0, len(bounds)-1)
+	for i := 0; i+1 < len(bounds); i++ {
+		tokens = append(tokens, e.ranks[string(piece[bounds[i]:bounds[i+1]])])
+	}
+	return tokens
+}
+
+// bytePairMerge 从单字节开始，反复合并排名最低（最常见）的相邻对，返回各token的边界
+func (e *Encoding) bytePairMerge(piece []byte) []int {
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+
+	// rank 返回bounds[i]到bounds[i+2]合并后的排名，不在词表中时为MaxInt
+	rank := func(i int) int {
+		if i+2 >= len(bounds) {
+			return math.MaxInt
+		}
+		if r, ok := e.ranks[string(piece[bounds[i]:bounds[i+2]])]; ok {
+			return r
+		}
+		return math.MaxInt
+	}
+
+	ranks := make([]int, len(bounds))
+	for i := range ranks {
+		ranks[i] = rank(i)
+	}
+
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if ranks[i] < bestRank {
+				best, bestRank = i, ranks[i]
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+		ranks = append(ranks[:best+1], ranks[best+2:]...)
+		ranks[best] = rank(best)
+		if best > 0 {
+			ranks[best-1] = rank(best - 1)
+		}
+	}
+
+	return bounds
+}
@@ -0,0 +1,223 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// splitFunc 把文本切分为BPE之前的片段
+//
+// cl100k和o200k的预切分正则使用了Go regexp不支持的否定前瞻(?!\S)，
+// 这里按正则各分支的优先级手工实现，结果与原正则一致。
+type splitFunc func(text string) []string
+
+// splitText 依次在每个位置用match取出一个片段
+func splitText(text string, match func(s string) int) []string {
+	var pieces []string
+	for len(text) > 0 {
+		n := match(text)
+		if n <= 0 {
+			// 正则最后的\s+和其他分支覆盖了所有字符，这里只是防御
+			_, n = utf8.DecodeRuneInString(text)
+		}
+		pieces = append(pieces, text[:n])
+		text = text[n:]
+	}
+	return pieces
+}
+
+// splitCl100k 按cl100k_base的预切分规则切分：
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitCl100k(text string) []string {
+	return splitText(text, func(s string) int {
+		if n := matchContraction(s); n > 0 {
+			return n
+		}
+		if n := matchPrefixed(s, func(s string) int { return runLength(s, unicode.IsLetter) }); n > 0 {
+			return n
+		}
+		if n := matchNumbers(s); n > 0 {
+			return n
+		}
+		if n := matchPunctuation(s, isNewline); n > 0 {
+			return n
+		}
+		return matchWhitespace(s)
+	})
+}
+
+// splitO200k 按o200k_base的预切分规则切分：
+//
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?
+//	|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?
+//	|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitO200k(text string) []string {
+	return splitText(text, func(s string) int {
+		if n := matchPrefixed(s, matchCasedWord); n > 0 {
+			return n
+		}
+		if n := matchPrefixed(s, matchUpperWord); n > 0 {
+			return n
+		}
+		if n := matchNumbers(s); n > 0 {
+			return n
+		}
+		if n := matchPunctuation(s, func(r rune) bool { return isNewline(r) || r == '/' }); n > 0 {
+			return n
+		}
+		return matchWhitespace(s)
+	})
+}
+
+// matchContraction 匹配(?i:'s|'t|'re|'ve|'m|'ll|'d)
+func matchContraction(s string) int {
+	if len(s) < 2 || s[0] != '\'' {
+		return 0
+	}
+	lower := func(b byte) byte {
+		if b >= 'A' && b <= 'Z' {
+			return b + 'a' - 'A'
+		}
+		return b
+	}
+	switch lower(s[1]) {
+	case 's', 't', 'm', 'd':
+		return 2
+	}
+	if len(s) >= 3 {
+		switch string([]byte{lower(s[1]), lower(s[2])}) {
+		case "re", "ve", "ll":
+			return 3
+		}
+	}
+	return 0
+}
+
+// matchPrefixed 匹配[^\r\n\p{L}\p{N}]?后接body；带前缀不匹配时不带前缀重试
+func matchPrefixed(s string, body func(s string) int) int {
+	r, size := utf8.DecodeRuneInString(s)
+	if !isNewline(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+		if n := body(s[size:]); n > 0 {
+			return size + n
+		}
+	}
+	return body(s)
+}
+
+// matchNumbers 匹配\p{N}{1,3}
+func matchNumbers(s string) int {
+	n := 0
+	for i := 0; i < 3; i++ {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if size == 0 || !unicode.IsNumber(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// matchPunctuation 匹配 ?[^\s\p{L}\p{N}]+后接trailing字符
+func matchPunctuation(s string, trailing func(r rune) bool) int {
+	start := 0
+	if len(s) > 0 && s[0] == ' ' {
+		start = 1
+	}
+	n := runLength(s[start:], func(r rune) bool {
+		return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if n == 0 {
+		return 0
+	}
+	n += start
+	return n + runLength(s[n:], trailing)
+}
+
+// matchWhitespace 匹配\s*[\r\n]+|\s+(?!\S)|\s+
+func matchWhitespace(s string) int {
+	n := runLength(s, unicode.IsSpace)
+	if n == 0 {
+		return 0
+	}
+
+	// \s*[\r\n]+：回溯到空白中最后一个换行符之后
+	lastNewline := -1
+	for i, r := range s[:n] {
+		if isNewline(r) {
+			lastNewline = i + utf8.RuneLen(r)
+		}
+	}
+	if lastNewline > 0 {
+		return lastNewline
+	}
+
+	// \s+(?!\S)：空白后还有非空白字符时，留下最后一个空白字符
+	if n == len(s) {
+		return n
+	}
+	_, last := utf8.DecodeLastRuneInString(s[:n])
+	if n-last > 0 {
+		return n - last
+	}
+	return n
+}
+
+// matchCasedWord 匹配[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+及可选的缩写后缀
+func matchCasedWord(s string) int {
+	// 贪婪匹配大写部分，失败时逐字符回溯
+	var upper []int // 大写部分每个字符的结束位置
+	for i, r := range s {
+		if !isUpperClass(r) {
+			break
+		}
+		upper = append(upper, i+utf8.RuneLen(r))
+	}
+
+	for j := len(upper); j >= 0; j-- {
+		start := 0
+		if j > 0 {
+			start = upper[j-1]
+		}
+		if n := runLength(s[start:], isLowerClass); n > 0 {
+			end := start + n
+			return end + matchContraction(s[end:])
+		}
+	}
+	return 0
+}
+
+// matchUpperWord 匹配[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*及可选的缩写后缀
+func matchUpperWord(s string) int {
+	n := runLength(s, isUpperClass)
+	if n == 0 {
+		return 0
+	}
+	n += runLength(s[n:], isLowerClass)
+	return n + matchContraction(s[n:])
+}
+
+// runLength 返回满足条件的前缀字节长度
+func runLength(s string, pred func(r rune) bool) int {
+	for i, r := range s {
+		if !pred(r) {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// isNewline 是否为\r或\n
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+// isUpperClass 是否属于[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]
+func isUpperClass(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// isLowerClass 是否属于[\p{Ll}\p{Lm}\p{Lo}\p{M}]
+func isLowerClass(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
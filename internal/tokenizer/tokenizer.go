@@ -0,0 +1,107 @@
+// Package tokenizer 提供发送前的token计数，用于提示词预算、上下文裁剪和成本估算
+//
+// OpenAI模型使用与tiktoken一致的cl100k_base/o200k_base字节级BPE精确计数，
+// 其他模型（Claude、Qwen、LLaMA、Gemini等）的词表未公开或不在本地，使用启发式估算。
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Counter token计数器
+type Counter interface {
+	// Count 返回文本的token数
+	Count(text string) int
+
+	// Name 返回计数器名称
+	Name() string
+}
+
+// heuristicCounter 启发式计数器
+type heuristicCounter struct{}
+
+// Heuristic 启发式计数器：中日韩字符每字按1个token计，字母数字串约每4个字符1个token，
+// 其他符号每个1个token。对中文为主的文本比按字节估算准确得多，通常略高于实际值，适合做预算。
+var Heuristic Counter = heuristicCounter{}
+
+// Name 返回计数器名称
+func (heuristicCounter) Name() string {
+	return "heuristic"
+}
+
+// Count 估算文本的token数
+func (heuristicCounter) Count(text string) int {
+	count := 0
+	word := 0 // 当前字母数字串的长度
+
+	flush := func() {
+		if word > 0 {
+			count += (word + 3) / 4
+			word = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flush()
+			count++
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word++
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			// 其他文字（西里尔、阿拉伯等）在BPE词表中切分更细，按每2个字符1个token计
+			word += 2
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			count++
+		}
+	}
+	flush()
+
+	return count
+}
+
+// isCJK 是否为中日韩文字
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// o200kPrefixes 使用o200k_base的模型ID前缀
+var o200kPrefixes = []string{"gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4"}
+
+// cl100kPrefixes 使用cl100k_base的模型ID前缀（Azure的部署名常写作gpt-35-turbo）
+var cl100kPrefixes = []string{"gpt-4", "gpt-3.5", "gpt-35", "text-embedding-3", "text-embedding-ada-002"}
+
+// EncodingForModel 返回模型使用的BPE编码名称，未知模型返回空字符串
+func EncodingForModel(modelID string) string {
+	// 兼容openai/gpt-4o这样带提供方前缀的写法
+	id := strings.ToLower(modelID[strings.LastIndex(modelID, "/")+1:])
+
+	for _, prefix := range o200kPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return O200kBase
+		}
+	}
+	for _, prefix := range cl100kPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return Cl100kBase
+		}
+	}
+	return ""
+}
+
+// ForModel 返回模型对应的计数器，未知模型使用启发式计数器
+func ForModel(modelID string) Counter {
+	if encoding, err := GetEncoding(EncodingForModel(modelID)); err == nil {
+		return encoding
+	}
+	return Heuristic
+}
+
+// Count 按模型计算文本的token数
+func Count(modelID, text string) int {
+	return ForModel(modelID).Count(text)
+}
@@ -0,0 +1,50 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+)
+
+// MockTool 模拟工具，保留真实工具的名称和参数定义，但不产生任何副作用
+type MockTool struct {
+	info ToolInfo
+}
+
+// NewMockTool 根据工具信息创建模拟工具
+func NewMockTool(info ToolInfo) *MockTool {
+	return &MockTool{info: info}
+}
+
+// Name工具名称
+func (t *MockTool) Name() string {
+	return t.info.Name
+}
+
+// Description工具描述
+func (t *MockTool) Description() string {
+	return t.info.Description
+}
+
+// Parameters工具参数定义
+func (t *MockTool) Parameters() map[string]interface{} {
+	return t.info.Parameters
+}
+
+// Execute返回模拟结果
+func (t *MockTool) Execute(ctx context.Context, input string) (string, error) {
+	return fmt.Sprintf("[模拟] 工具 %s 的执行结果，输入: %s", t.info.Name, input), nil
+}
+
+// NewMockManager 创建与source具有相同工具的模拟工具管理器
+func NewMockManager(source *Manager) *Manager {
+	m := NewManager()
+	if source == nil {
+		return m
+	}
+
+	for _, info := range source.ListTools() {
+		m.Register(NewMockTool(info))
+	}
+
+	return m
+}
@@ -82,6 +82,9 @@ func NewApp(configPath string) (*App, error) {
 		logger:    logger,
 	}
 
+	// 熔断器状态变化写入日志并推送SSE事件
+	model.OnBreakerStateChange(app.onBreakerStateChange)
+
 	// 初始化模型
 	if err := app.initModels(); err != nil {
 		return nil, fmt.Errorf("初始化模型失败: %w", err)
@@ -129,17 +132,48 @@ func (a *App) initModels() error {
 		modelConfigs = append(modelConfigs, defaultConfig)
 	}
 
-	// 初始化所有配置的模型
+	// 初始化所有配置的模型，回退链引用其他模型，最后创建
+	var fallbacks []model.ModelConfig
 	for _, modelConfig := range modelConfigs {
-		a.logger.Infof("初始化模型: %s (%s)", modelConfig.Name, modelConfig.ModelID)
-
-		//这里可以创建模型实例并测试连接
-		// 实际应用中可能需要根据模型类型进行不同的初始化
+		if modelConfig.Provider == model.ProviderFallback {
+			fallbacks = append(fallbacks, modelConfig)
+			continue
+		}
+		a.createModel(modelConfig)
+	}
+	for _, modelConfig := range fallbacks {
+		a.createModel(modelConfig)
 	}
 
 	return nil
 }
 
+// createModel 创建并缓存模型实例，失败时只记录警告，请求时会再次尝试创建
+func (a *App) createModel(modelConfig model.ModelConfig) {
+	a.logger.Infof("初始化模型: %s (%s)", modelConfig.Name, modelConfig.ModelID)
+
+	if _, err := model.CreateModel(modelConfig); err != nil {
+		a.logger.WithError(err).Warnf("创建模型 %s 失败", modelConfig.Name)
+	}
+}
+
+// onBreakerStateChange 记录模型熔断器的状态变化并推送给SSE客户端
+func (a *App) onBreakerStateChange(event model.BreakerEvent) {
+	entry := a.logger.WithFields(logrus.Fields{
+		"model":    event.Model,
+		"from":     event.From,
+		"to":       event.To,
+		"failures": event.Failures,
+	})
+	if event.To == model.BreakerOpen {
+		entry.WithField("last_error", event.LastError).Warn("模型熔断器打开")
+	} else {
+		entry.Info("模型熔断器状态变化")
+	}
+
+	a.sseBroker.Broadcast("model_breaker", event)
+}
+
 // initTools 初始化工具
 func (a *App) initTools() error {
 	if !a.config.Features.EnableTools {
@@ -176,14 +210,26 @@ func (a *App) initRAG() error {
 
 	a.logger.Info("初始化RAG引擎...")
 
-	// 创建嵌入模型（这里使用模拟模型）
-	embeddingModel := rag.NewMockEmbeddingModel()
+	// 创建嵌入模型（未配置时使用模拟模型）
+	var embeddingModel rag.EmbeddingModel = rag.NewMockEmbeddingModel()
+	if a.config.Embedding.Configured() {
+		configured, err := rag.NewEmbeddingModel(a.config.Embedding)
+		if err != nil {
+			return fmt.Errorf("创建嵌入模型失败: %w", err)
+		}
+		embeddingModel = configured
+	}
+
+	dimensions := 1536
+	if a.config.Embedding.Dimensions > 0 {
+		dimensions = a.config.Embedding.Dimensions
+	}
 
 	// 创建RAG配置
 	ragConfig := rag.Config{
 		DatabaseURL:    a.config.GetDatabaseURL(),
 		EmbeddingModel: embeddingModel,
-		Dimensions:     1536,
+		Dimensions:     dimensions,
 		TableName:      "documents",
 	}
 
@@ -225,6 +271,16 @@ func (a *App) initServer() error {
 	serverConfig.Agent = a.agent
 	serverConfig.SSEBroker = a.sseBroker
 
+	// 语义答案缓存
+	if a.config.Agent.AnswerCache.Enabled {
+		cache, err := newAnswerCache(a.config)
+		if err != nil {
+			return err
+		}
+		serverConfig.AnswerCache = cache
+		a.logger.Infof("已启用语义答案缓存，嵌入模型: %s", a.config.Embedding.Model)
+	}
+
 	// 创建HTTP服务器
 	a.server = http.NewServer(serverConfig)
 
@@ -232,6 +288,15 @@ func (a *App) initServer() error {
 	return nil
 }
 
+// newAnswerCache 使用配置的嵌入模型创建语义答案缓存，未配置时拒绝启用
+func newAnswerCache(cfg *config.Config) (*core.AnswerCache, error) {
+	embeddingModel, err := rag.NewEmbeddingModel(cfg.Embedding)
+	if err != nil {
+		return nil, fmt.Errorf("语义答案缓存需要嵌入模型: %w", err)
+	}
+	return core.NewAnswerCache(embeddingModel, cfg.Agent.AnswerCache), nil
+}
+
 // Run运行应用
 func (a *App) Run() error {
 	// 创建上下文用于优雅关闭
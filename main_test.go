@@ -2,13 +2,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"aigent/internal/config"
 	"aigent/internal/core"
 	"aigent/internal/model"
+	"aigent/internal/rag"
 	"aigent/internal/tool"
 	"aigent/internal/sse"
+	"aigent/internal/tokenizer"
 )
 
 func TestAgentInitialization(t *testing.T) {
@@ -158,4 +172,2018 @@ func (m *TestModel) Name() string {
 
 func (m *TestModel) Config() model.ModelConfig {
 	return m.config
-}
\ No newline at end of file
+}
+func TestAgentHooks(t *testing.T) {
+	//测试生命周期钩子可以修改提示词、否决步骤并修改结果
+	plan := `{"thought": "计算 2+2", "steps": [
+		{"action": "search_tool", "parameters": {"tool_name": "test_tool", "input": "x"}, "should_continue": true},
+		{"action": "reason", "parameters": {"prompt": "总结"}, "should_continue": false}
+	]}`
+	llm := &ScriptedModel{responses: []string{plan, "推理结果"}}
+
+	manager := tool.NewManager()
+	manager.Register(&TestTool{})
+
+	hooks := &RecordingHooks{}
+	agent := core.NewAgent(core.AgentConfig{MaxIterations: 2, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithToolManager(manager).
+		WithHooks(hooks)
+
+	result, err := agent.Execute(context.Background(), "计算 2+2")
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+
+	if result != "推理结果 [已审计]" {
+		t.Errorf("期望结果被OnComplete修改，实际为'%s'", result)
+	}
+	if !strings.Contains(llm.prompts[0], "[审计]") {
+		t.Error("BeforeThink未能修改提示词")
+	}
+	if hooks.executed != 1 {
+		t.Errorf("期望执行1个步骤，实际为%d", hooks.executed)
+	}
+
+	//钩子把步骤置空时返回错误而不是panic
+	llm = &ScriptedModel{responses: []string{plan, "推理结果"}}
+	agent = core.NewAgent(core.AgentConfig{MaxIterations: 1, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithToolManager(manager).
+		WithHooks(&NilStepHooks{})
+	if _, err := agent.Execute(context.Background(), "计算 2+2"); err == nil || !strings.Contains(err.Error(), "空步骤") {
+		t.Errorf("钩子返回空步骤时应失败，实际错误为%v", err)
+	}
+}
+
+// NilStepHooks测试钩子：把步骤置空
+type NilStepHooks struct {
+	core.BaseHooks
+}
+
+func (h *NilStepHooks) BeforeStep(ctx context.Context, in *core.StepInput) error {
+	in.Step = nil
+	return nil
+}
+
+// RecordingHooks测试钩子：否决工具步骤并标记结果
+type RecordingHooks struct {
+	core.BaseHooks
+	executed int
+}
+
+func (h *RecordingHooks) BeforeThink(ctx context.Context, in *core.ThinkInput) error {
+	in.Prompt += "\n[审计]"
+	return nil
+}
+
+func (h *RecordingHooks) BeforeStep(ctx context.Context, in *core.StepInput) error {
+	if in.Step.Action == "search_tool" {
+		return core.ErrSkipStep
+	}
+	return nil
+}
+
+func (h *RecordingHooks) AfterStep(ctx context.Context, out *core.StepOutput) error {
+	h.executed++
+	return nil
+}
+
+func (h *RecordingHooks) OnComplete(ctx context.Context, result *string) {
+	*result += " [已审计]"
+}
+
+// ScriptedModel按顺序返回预设响应的测试模型
+type ScriptedModel struct {
+	mu        sync.Mutex
+	responses []string
+	prompts   []string
+}
+
+func (m *ScriptedModel) Generate(ctx context.Context, prompt string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prompts = append(m.prompts, prompt)
+	if len(m.responses) == 0 {
+		return "", fmt.Errorf("没有更多预设响应")
+	}
+	response := m.responses[0]
+	m.responses = m.responses[1:]
+	return response, nil
+}
+
+func (m *ScriptedModel) Name() string {
+	return "scripted"
+}
+
+func (m *ScriptedModel) Config() model.ModelConfig {
+	return model.ModelConfig{Name: "scripted"}
+}
+
+// PromptModel按提示词内容决定响应的测试模型
+type PromptModel struct {
+	mu      sync.Mutex
+	respond func(prompt string) string
+	prompts []string
+}
+
+func (m *PromptModel) Generate(ctx context.Context, prompt string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prompts = append(m.prompts, prompt)
+	return m.respond(prompt), nil
+}
+
+func (m *PromptModel) Name() string {
+	return "prompt"
+}
+
+func (m *PromptModel) Config() model.ModelConfig {
+	return model.ModelConfig{Name: "prompt"}
+}
+
+func TestSelfConsistencyPlanner(t *testing.T) {
+	//测试自洽规划按动作序列投票、由模型评判，以及全部候选无效时失败
+	planA := `{"thought": "比较方案", "steps": [
+		{"action": "reason", "parameters": {"prompt": "方案A第一步"}, "should_continue": false},
+		{"action": "reason", "parameters": {"prompt": "方案A第二步"}, "should_continue": false}]}`
+	planB := `{"thought": "比较方案", "steps": [
+		{"action": "reason", "parameters": {"prompt": "方案B"}, "should_continue": false}]}`
+
+	run := func(selection string, plans []string, judge func(prompt string) string) (*core.Agent, string, error) {
+		next := 0
+		llm := &PromptModel{respond: func(prompt string) string {
+			switch {
+			case strings.Contains(prompt, "严格的评审"):
+				return judge(prompt)
+			case strings.Contains(prompt, "制定执行计划"):
+				plan := plans[next%len(plans)]
+				next++
+				return plan
+			case strings.Contains(prompt, "方案A") || strings.Contains(prompt, "选中A"):
+				return "选中A"
+			case strings.Contains(prompt, "方案B") || strings.Contains(prompt, "选中B"):
+				return "选中B"
+			}
+			return ""
+		}}
+		agent := core.NewAgent(core.AgentConfig{
+			MaxIterations: 1,
+			Timeout:       5 * time.Second,
+			Planner:       core.PlannerConfig{Mode: core.PlannerSelfConsistency, Samples: len(plans), Selection: selection},
+		}).WithModel(llm)
+		answer, err := agent.Execute(context.Background(), "比较方案")
+		return agent, answer, err
+	}
+	chosen := func(agent *core.Agent) string {
+		for _, entry := range agent.Trace().Entries() {
+			if entry.Kind == "plan_candidates_rejected" {
+				return entry.Message
+			}
+		}
+		return ""
+	}
+
+	//多数票胜出，无效候选不参与投票
+	if _, answer, err := run(core.SelectionVote, []string{planA, planB, planB, "不是JSON"}, nil); err != nil || !strings.Contains(answer, "选中B") {
+		t.Errorf("投票应选中多数的方案B: %q, %v", answer, err)
+	}
+
+	//票数相同时选最早的候选
+	agent, _, err := run(core.SelectionVote, []string{planA, planB}, nil)
+	if err != nil || !strings.HasPrefix(chosen(agent), "选中候选计划 1，") {
+		t.Errorf("平票时应选中第1个候选: %q, %v", chosen(agent), err)
+	}
+
+	//评判选中少数的方案A
+	pickA := func(prompt string) string {
+		for i := 1; ; i++ {
+			start := strings.Index(prompt, fmt.Sprintf("候选 %d:", i))
+			if start < 0 {
+				return "0"
+			}
+			end := strings.Index(prompt[start:], "\n\n")
+			if strings.Contains(prompt[start:start+end], "方案A") {
+				return fmt.Sprintf("候选 %d", i)
+			}
+		}
+	}
+	if _, answer, err := run(core.SelectionJudge, []string{planA, planB, planB}, pickA); err != nil || !strings.Contains(answer, "选中A") {
+		t.Errorf("评判应选中方案A: %q, %v", answer, err)
+	}
+
+	//评判结果无效时改为投票
+	if _, answer, err := run(core.SelectionJudge, []string{planA, planB, planB}, func(string) string { return "都不错" }); err != nil || !strings.Contains(answer, "选中B") {
+		t.Errorf("评判无效时应改为投票: %q, %v", answer, err)
+	}
+
+	//全部候选无效
+	if _, _, err := run(core.SelectionVote, []string{"不是JSON", `{"thought": "无关", "steps": []}`}, nil); err == nil || !strings.Contains(err.Error(), "均无效") {
+		t.Errorf("全部候选无效时应失败: %v", err)
+	}
+
+	//配置中的规划模式和选择方式需要有效
+	cfg := config.GetDefaultConfig()
+	cfg.Agent.Planner = config.PlannerConfig{Mode: core.PlannerSelfConsistency, Samples: 3, Selection: core.SelectionJudge}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("有效的规划配置验证失败: %v", err)
+	}
+	cfg.Agent.Planner.Mode = "self-consistency"
+	if err := cfg.Validate(); err == nil {
+		t.Error("无效的规划模式应验证失败")
+	}
+	cfg.Agent.Planner = config.PlannerConfig{Selection: "votes"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("无效的选择方式应验证失败")
+	}
+}
+
+func TestReActStrategy(t *testing.T) {
+	//测试ReAct策略逐步执行动作并在最终答案处停止
+	llm := &ScriptedModel{responses: []string{
+		"Thought: 需要调用工具\nAction: search_tool\nAction Input: {\"tool_name\": \"test_tool\", \"input\": \"x\"}",
+		"Thought: 已获得结果\nFinal Answer: 答案是 test result",
+	}}
+
+	manager := tool.NewManager()
+	manager.Register(&TestTool{})
+
+	strategy, err := core.NewStrategy(core.StrategyReAct)
+	if err != nil {
+		t.Fatalf("创建策略失败: %v", err)
+	}
+
+	agent := core.NewAgent(core.AgentConfig{MaxIterations: 3, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithToolManager(manager).
+		WithStrategy(strategy)
+
+	result, err := agent.Execute(context.Background(), "测试问题")
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+
+	if result != "答案是 test result" {
+		t.Errorf("期望最终答案，实际为'%s'", result)
+	}
+	if !strings.Contains(llm.prompts[1], "Observation: test result") {
+		t.Error("第二轮提示词缺少上一轮的观察结果")
+	}
+
+	//非字符串的Action Input参数作为错误观察结果反馈给模型，而不是panic
+	llm = &ScriptedModel{responses: []string{
+		"Thought: 需要调用工具\nAction: search_tool\nAction Input: {\"tool_name\": \"test_tool\", \"input\": {\"x\": 1}}",
+		"Thought: 改用字符串\nFinal Answer: 已纠正",
+	}}
+	agent = core.NewAgent(core.AgentConfig{MaxIterations: 3, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithToolManager(manager).
+		WithStrategy(strategy)
+
+	result, err = agent.Execute(context.Background(), "测试问题")
+	if err != nil || result != "已纠正" {
+		t.Fatalf("执行失败: %q, %v", result, err)
+	}
+	if !strings.Contains(llm.prompts[1], "Observation: 错误: ") || !strings.Contains(llm.prompts[1], "input参数必须是字符串") {
+		t.Errorf("第二轮提示词应包含参数类型错误的观察结果: %s", llm.prompts[1])
+	}
+}
+
+func TestPlanConditionsAndLoops(t *testing.T) {
+	//测试条件表达式和循环在解析时验证
+	invalid := map[string]string{
+		"语法错误": `{"thought": "t", "steps": [
+			{"id": "a", "action": "reason", "parameters": {"prompt": "p"}},
+			{"action": "reason", "parameters": {"prompt": "p"}, "if": "steps.a.output contains"}]}`,
+		"引用之后的步骤": `{"thought": "t", "steps": [
+			{"action": "reason", "parameters": {"prompt": "p"}, "if": "steps.b.output == \"x\""},
+			{"id": "b", "action": "reason", "parameters": {"prompt": "p"}}]}`,
+		"循环子步骤参数不是字符串": `{"thought": "t", "steps": [
+			{"id": "a", "action": "reason", "parameters": {"prompt": "p"}},
+			{"action": "foreach", "parameters": {}, "foreach": {"items": "steps.a.json",
+				"step": {"action": "search_tool", "parameters": {"tool_name": "t", "input": ["{{item}}"]}}}}]}`,
+		"超过循环上限": `{"thought": "t", "steps": [
+			{"id": "a", "action": "reason", "parameters": {"prompt": "p"}},
+			{"action": "foreach", "parameters": {}, "foreach": {"items": "steps.a.json", "max_items": 1000,
+				"step": {"action": "reason", "parameters": {"prompt": "{{item}}"}}}}]}`,
+	}
+	for name, plan := range invalid {
+		if _, err := core.ParseExecutionPlan(plan); err == nil {
+			t.Errorf("%s: 期望解析失败", name)
+		}
+	}
+
+	//测试条件跳过和循环执行
+	plan := `{"thought": "城市 天气", "steps": [
+		{"id": "cities", "action": "reason", "parameters": {"prompt": "列出城市"}, "should_continue": true},
+		{"action": "reason", "parameters": {"prompt": "不应执行"}, "if": "steps.cities.json contains \"上海\"", "should_continue": true},
+		{"id": "each", "action": "foreach", "parameters": {}, "should_continue": true,
+			"foreach": {"items": "steps.cities.json", "concurrency": 2,
+				"step": {"action": "search_tool", "parameters": {"tool_name": "test_tool", "input": "{{item}}"}}}},
+		{"action": "reason", "parameters": {"prompt": "总结"}, "if": "steps.each.json.1 == \"test result\""}
+	]}`
+	llm := &ScriptedModel{responses: []string{plan, `["北京", "广州"]`, "总结完成"}}
+
+	manager := tool.NewManager()
+	manager.Register(&TestTool{})
+
+	agent := core.NewAgent(core.AgentConfig{MaxIterations: 2, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithToolManager(manager)
+
+	result, err := agent.Run(context.Background(), "城市 天气")
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if result.Answer != "总结完成" {
+		t.Errorf("期望结果为'总结完成'，实际为'%s'", result.Answer)
+	}
+
+	//循环子步骤的ID以循环步骤ID为前缀，不同循环的观察结果不会冲突
+	var itemIDs []string
+	for _, obs := range result.Observations {
+		if obs.Action == "search_tool" {
+			itemIDs = append(itemIDs, obs.StepID)
+		}
+	}
+	sort.Strings(itemIDs)
+	if !reflect.DeepEqual(itemIDs, []string{"each_0", "each_1"}) {
+		t.Errorf("循环子步骤ID错误: %v", itemIDs)
+	}
+}
+
+func TestAskUser(t *testing.T) {
+	//测试ask_user挂起运行直到收到回答，超时后在运行截止前使用默认值继续
+	plan := `{"thought": "询问城市", "steps": [
+		{"action": "ask_user", "parameters": {"question": "哪个城市？", "default": "上海"}, "should_continue": false}]}`
+	newAgent := func(timeout time.Duration, broker *core.InputBroker) *core.Agent {
+		llm := &PromptModel{respond: func(prompt string) string {
+			switch {
+			case strings.Contains(prompt, "制定执行计划"):
+				return plan
+			case strings.Contains(prompt, "用户回答: 北京"):
+				return "城市是北京"
+			case strings.Contains(prompt, "使用默认值: 上海"):
+				return "城市是上海"
+			}
+			return ""
+		}}
+		return core.NewAgent(core.AgentConfig{MaxIterations: 1, Timeout: timeout}).
+			WithModel(llm).
+			WithRunID(fmt.Sprintf("ask_user_%d", timeout)).
+			WithInputBroker(broker)
+	}
+
+	//收到回答后恢复运行
+	broker := core.NewInputBroker()
+	agent := newAgent(5*time.Second, broker)
+	go func() {
+		for len(broker.Pending()) == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		broker.Submit(agent.RunID(), "北京")
+	}()
+	if answer, err := agent.Execute(context.Background(), "询问城市"); err != nil || answer != "城市是北京" {
+		t.Errorf("期望使用用户回答，实际为%q, %v", answer, err)
+	}
+
+	//步骤默认等待5分钟，运行超时更短时应在截止前使用默认值，而不是整个运行超时失败
+	start := time.Now()
+	if answer, err := newAgent(time.Second, core.NewInputBroker()).Execute(context.Background(), "询问城市"); err != nil || answer != "城市是上海" {
+		t.Errorf("期望超时后使用默认值，实际为%q, %v", answer, err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("等待时间应限制在运行截止时间之前，实际为%v", elapsed)
+	}
+}
+
+func TestSynthesisCitations(t *testing.T) {
+	//测试最终答案由合成阶段生成并携带引用
+	plan := `{"thought": "调用工具 回答", "steps": [
+		{"action": "search_tool", "parameters": {"tool_name": "test_tool", "input": "x"}, "should_continue": false}
+	]}`
+	synthesis := `{"answer": "结果是test result[1]", "citations": [{"claim": "结果是test result", "sources": [1, 9]}]}`
+	llm := &ScriptedModel{responses: []string{plan, synthesis}}
+
+	manager := tool.NewManager()
+	manager.Register(&TestTool{})
+
+	agent := core.NewAgent(core.AgentConfig{MaxIterations: 2, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithToolManager(manager)
+
+	result, err := agent.Run(context.Background(), "调用工具 回答")
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+
+	if result.Answer != "结果是test result[1]" {
+		t.Errorf("期望合成后的答案，实际为'%s'", result.Answer)
+	}
+	if len(result.Citations) != 1 || len(result.Citations[0].Sources) != 1 {
+		t.Fatalf("期望1条引用且丢弃无效编号，实际为%+v", result.Citations)
+	}
+	if source := result.Citations[0].Sources[0]; source.Tool != "test_tool" || source.StepID != "step_1" {
+		t.Errorf("引用来源不正确: %+v", source)
+	}
+
+	//失败后恢复的步骤结果同样作为观察结果参与合成
+	plan = `{"thought": "调用工具 回答", "steps": [
+		{"action": "search_tool", "parameters": {"tool_name": "flaky_tool", "input": "x"}, "should_continue": false}
+	]}`
+	llm = &ScriptedModel{responses: []string{plan, "恢复后的结果是flaky result[1]"}}
+	manager.Register(&FlakyTool{})
+
+	agent = core.NewAgent(core.AgentConfig{MaxIterations: 2, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithToolManager(manager)
+	result, err = agent.Run(context.Background(), "调用工具 回答")
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if len(result.Observations) != 1 || !result.Observations[0].Recovered || result.Observations[0].Content != "flaky result" {
+		t.Fatalf("恢复的步骤应记录为观察结果: %+v", result.Observations)
+	}
+	if len(result.Citations) != 1 || !result.Citations[0].Sources[0].Recovered {
+		t.Errorf("引用应指向恢复的观察结果: %+v", result.Citations)
+	}
+	if !strings.Contains(llm.prompts[1], "步骤失败后恢复的结果") {
+		t.Error("合成提示词应标注恢复的观察结果")
+	}
+}
+
+// FlakyTool第一次调用失败的测试工具
+type FlakyTool struct {
+	TestTool
+	calls int
+}
+
+func (t *FlakyTool) Name() string {
+	return "flaky_tool"
+}
+
+func (t *FlakyTool) Execute(ctx context.Context, input string) (string, error) {
+	t.calls++
+	if t.calls == 1 {
+		return "", fmt.Errorf("暂时不可用")
+	}
+	return "flaky result", nil
+}
+
+func TestStallDetection(t *testing.T) {
+	//测试重复计划被检测到，先警告，再停止循环并基于已有观察结果合成最终答案
+	plan := `{"thought": "test result", "steps": [
+		{"action": "search_tool", "parameters": {"tool_name": "test_tool", "input": "x"}, "should_continue": true}
+	]}`
+	llm := &ScriptedModel{responses: []string{plan, plan, plan, "合成的答案是test result[1]"}}
+
+	manager := tool.NewManager()
+	manager.Register(&TestTool{})
+
+	agent := core.NewAgent(core.AgentConfig{MaxIterations: 10, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithToolManager(manager)
+
+	result, err := agent.Run(context.Background(), "test result")
+	if err != nil {
+		t.Fatalf("停滞时应合成最终答案而不是失败: %v", err)
+	}
+	if result.Answer != "合成的答案是test result[1]" || len(result.Observations) != 3 {
+		t.Errorf("期望基于3轮观察结果合成的答案，实际为%+v", result)
+	}
+	if len(llm.prompts) != 4 || !strings.Contains(llm.prompts[2], "警告") || !strings.Contains(llm.prompts[3], "观察结果") {
+		t.Errorf("期望警告后在第3轮停止并合成，实际调用模型%d次", len(llm.prompts))
+	}
+}
+
+func TestDryRunSimulate(t *testing.T) {
+	//测试模拟执行使用模拟工具、检索和模型，只在制定计划时调用真实模型
+	plan := `{"thought": "查询天气", "steps": [
+		{"action": "search_tool", "parameters": {"tool_name": "test_tool", "input": "北京"}, "should_continue": true},
+		{"action": "rag_search", "parameters": {"query": "天气"}, "should_continue": true},
+		{"action": "reason", "parameters": {"prompt": "总结天气"}, "should_continue": false}
+	]}`
+	llm := &PromptModel{respond: func(prompt string) string { return plan }}
+
+	manager := tool.NewManager()
+	manager.Register(&TestTool{})
+
+	hooks := &StepCountingHooks{}
+	agent := core.NewAgent(core.AgentConfig{MaxIterations: 2, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithToolManager(manager).
+		WithHooks(hooks)
+
+	result, err := agent.DryRun(context.Background(), "查询天气", true)
+	if err != nil {
+		t.Fatalf("试运行失败: %v", err)
+	}
+	if len(llm.prompts) != 1 {
+		t.Errorf("模拟执行不应调用真实模型，实际调用%d次", len(llm.prompts))
+	}
+	if len(result.Tools) != 1 || result.Tools[0].Name != "test_tool" || result.Tools[0].Schema == nil {
+		t.Errorf("工具解析错误: %+v", result.Tools)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "RAG引擎未配置") {
+		t.Errorf("期望RAG引擎未配置的警告，实际为%v", result.Warnings)
+	}
+
+	sim := result.Simulation
+	if sim == nil || len(sim.Observations) != 3 {
+		t.Fatalf("期望3个模拟观察结果，实际为%+v", sim)
+	}
+	if !strings.HasPrefix(sim.Observations[0].Content, "[模拟] 工具 test_tool") ||
+		sim.Observations[1].DocumentIDs[0] != "simulated" ||
+		!strings.HasPrefix(sim.Result, "[模拟]") || !strings.Contains(sim.Result, "总结天气") {
+		t.Errorf("模拟结果不正确: %+v", sim)
+	}
+	if hooks.before != 0 || hooks.after != 0 {
+		t.Errorf("模拟执行不应触发步骤钩子，实际BeforeStep %d次、AfterStep %d次", hooks.before, hooks.after)
+	}
+}
+
+// StepCountingHooks统计步骤钩子调用次数的测试钩子
+type StepCountingHooks struct {
+	core.BaseHooks
+	before, after int
+}
+
+func (h *StepCountingHooks) BeforeStep(ctx context.Context, in *core.StepInput) error {
+	h.before++
+	return nil
+}
+
+func (h *StepCountingHooks) AfterStep(ctx context.Context, out *core.StepOutput) error {
+	h.after++
+	return nil
+}
+
+func TestStreamParsing(t *testing.T) {
+	//测试SSE/NDJSON流跨写入拆分的行、结束标记之后的数据、中途的错误事件和提前中断的流
+	var chunks []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range chunks {
+			w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	config := model.ModelConfig{APIKey: "k", APIEndpoint: server.URL, Retry: &model.RetryConfig{MaxRetries: -1}}
+	openai, _ := model.NewOpenAIModel(config)
+	qwen, _ := model.NewQwenModel(config)
+	llama, _ := model.NewLLaMAModel(config)
+	config.ModelID = "llama3.1:8b"
+	ollama, _ := model.NewOllamaModel(config)
+
+	openAIDelta := func(text string) string {
+		return fmt.Sprintf("data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", text)
+	}
+	qwenDelta := func(text, finish string) string {
+		return fmt.Sprintf("id:1\nevent:result\ndata:{\"output\":{\"text\":%q,\"finish_reason\":%q}}\n\n", text, finish)
+	}
+	llamaDelta := func(text string) string {
+		return fmt.Sprintf("data: {\"choices\":[{\"text\":%q}]}\n\n", text)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		llm     model.Model
+		chunks  []string
+		want    string
+		wantErr string
+	}{
+		{"openai拆分的行", openai, []string{openAIDelta("你"), `data: {"choices":[{"del`, `ta":{"content":"好"}}]}` + "\n\n", "data: [DONE]\n\n", openAIDelta("忽略")}, "你好", ""},
+		{"openai错误事件", openai, []string{openAIDelta("你"), `data: {"error":{"type":"server_error","message":"overloaded"}}` + "\n\n"}, "你", "overloaded"},
+		{"openai提前中断", openai, []string{openAIDelta("你")}, "你", "结束前中断"},
+		{"qwen拆分的行", qwen, []string{qwenDelta("你", "null"), "id:2\nevent:result\nda", "ta:{\"output\":{\"text\":\"好\",\"finish_reason\":\"stop\"}}\n\n"}, "你好", ""},
+		{"qwen错误事件", qwen, []string{qwenDelta("你", "null"), "event:error\ndata:{\"code\":\"InvalidParameter\",\"message\":\"bad input\"}\n\n"}, "你", "InvalidParameter"},
+		{"qwen提前中断", qwen, []string{qwenDelta("你", "null")}, "你", "结束前中断"},
+		{"llama结束标记", llama, []string{llamaDelta("你"), llamaDelta("好"), "data: [DONE]\n\n"}, "你好", ""},
+		{"llama提前中断", llama, []string{llamaDelta("你")}, "你", "结束前中断"},
+		{"ollama拆分的行", ollama, []string{`{"response":"你","done":false}` + "\n" + `{"respon`, `se":"好","done":true}` + "\n"}, "你好", ""},
+		{"ollama错误", ollama, []string{`{"response":"你","done":false}` + "\n" + `{"error":"model not found"}` + "\n"}, "你", "model not found"},
+		{"ollama提前中断", ollama, []string{`{"response":"你","done":false}` + "\n"}, "你", "结束前中断"},
+	} {
+		chunks = tc.chunks
+		ch, err := model.Stream(context.Background(), tc.llm, "你好")
+		if err != nil {
+			t.Errorf("%s: 流式生成失败: %v", tc.name, err)
+			continue
+		}
+		text, err := model.Collect(ch, nil)
+		if text != tc.want {
+			t.Errorf("%s: 期望文本%q，实际为%q", tc.name, tc.want, text)
+		}
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: 不应出错: %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: 期望错误包含%q，实际为%v", tc.name, tc.wantErr, err)
+		case tc.wantErr == "结束前中断" && !errors.Is(err, io.ErrUnexpectedEOF):
+			t.Errorf("%s: 中断的流应返回io.ErrUnexpectedEOF: %v", tc.name, err)
+		}
+	}
+}
+
+func TestChatMessages(t *testing.T) {
+	//测试通义千问以messages格式发送对话，并应用单次调用参数
+	var received model.QwenRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"output": {"choices": [{"message": {"role": "assistant", "content": "你好"}}]}}`))
+	}))
+	defer server.Close()
+
+	qwen, err := model.NewQwenModel(model.ModelConfig{APIKey: "k", APIEndpoint: server.URL, Temperature: 0.7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	temperature := 0.1
+	text, err := model.Chat(context.Background(), qwen, []model.Message{
+		{Role: model.RoleSystem, Content: "你是助手"},
+		{Role: model.RoleUser, Content: "你好"},
+	}, model.ChatOptions{Temperature: &temperature, Stop: []string{"END"}})
+	if err != nil || text != "你好" {
+		t.Fatalf("Chat失败: %q, %v", text, err)
+	}
+	if len(received.Input.Messages) != 2 || received.Input.Messages[0].Role != model.RoleSystem {
+		t.Errorf("消息未按messages格式发送: %+v", received.Input)
+	}
+	if received.Parameters.Temperature == nil || *received.Parameters.Temperature != 0.1 || received.Parameters.ResultFormat != "message" {
+		t.Errorf("单次调用参数未生效: %+v", received.Parameters)
+	}
+
+	//显式设置的0温度同样发送，不被omitempty省略
+	zero := 0.0
+	received = model.QwenRequest{}
+	model.Chat(context.Background(), qwen, []model.Message{{Role: model.RoleUser, Content: "你好"}}, model.ChatOptions{Temperature: &zero})
+	if received.Parameters.Temperature == nil || *received.Parameters.Temperature != 0 {
+		t.Errorf("显式的0温度未发送: %+v", received.Parameters)
+	}
+
+	//测试LLaMA对话模板
+	prompt := model.RenderChatTemplate(model.ChatTemplateFor("llama-2-7b-chat"), []model.Message{
+		{Role: model.RoleSystem, Content: "S"},
+		{Role: model.RoleUser, Content: "U"},
+	})
+	if prompt != "<s>[INST] <<SYS>>\nS\n<</SYS>>\n\nU [/INST]" {
+		t.Errorf("Llama 2模板渲染错误: %q", prompt)
+	}
+
+	//测试Agent附带system提示词和对话历史
+	llm := &ChatRecordingModel{}
+	agent := core.NewAgent(core.AgentConfig{MaxIterations: 1, Timeout: 5 * time.Second, SystemPrompt: "系统指令"}).
+		WithModel(llm).
+		WithStrategy(&core.ReActStrategy{}).
+		WithHistory([]model.Message{{Role: model.RoleUser, Content: "上一问"}, {Role: model.RoleAssistant, Content: "上一答"}})
+	llm.responses = []string{"Final Answer: 完成", "完成"}
+
+	if _, err := agent.Execute(context.Background(), "本次问题"); err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	first := llm.messages[0]
+	if len(first) != 4 || first[0].Content != "系统指令" || first[2].Content != "上一答" || first[3].Role != model.RoleUser {
+		t.Errorf("发送的消息不正确: %+v", first)
+	}
+
+	//测试plan_execute的流式推理步骤和答案合成同样附带system提示词和对话历史
+	plan := `{"thought": "推理 本次问题", "steps": [
+		{"action": "reason", "parameters": {"prompt": "推理提示"}, "should_continue": false}
+	]}`
+	llm = &ChatRecordingModel{}
+	llm.responses = []string{plan, "推理结果", "合成的答案"}
+	agent = core.NewAgent(core.AgentConfig{MaxIterations: 1, Timeout: 5 * time.Second, SystemPrompt: "系统指令"}).
+		WithModel(llm).
+		WithHistory([]model.Message{{Role: model.RoleUser, Content: "上一问"}, {Role: model.RoleAssistant, Content: "上一答"}})
+
+	if _, err := agent.Run(context.Background(), "推理 本次问题"); err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if len(llm.messages) != 3 {
+		t.Fatalf("期望规划、推理和合成3次消息调用，实际为%d", len(llm.messages))
+	}
+	for i, messages := range llm.messages {
+		if len(messages) != 4 || messages[0].Content != "系统指令" || messages[2].Content != "上一答" {
+			t.Errorf("第%d次调用的消息不正确: %+v", i+1, messages)
+		}
+	}
+	if llm.messages[1][3].Content != "推理提示" {
+		t.Errorf("推理步骤应发送步骤的提示词: %+v", llm.messages[1][3])
+	}
+}
+
+// ChatRecordingModel记录消息列表的测试模型
+type ChatRecordingModel struct {
+	ScriptedModel
+	messages [][]model.Message
+}
+
+func (m *ChatRecordingModel) Chat(ctx context.Context, messages []model.Message, opts model.ChatOptions) (string, error) {
+	m.messages = append(m.messages, messages)
+	return m.Generate(ctx, messages[len(messages)-1].Content)
+}
+
+func TestOpenAICompatibleProvider(t *testing.T) {
+	//测试OpenAI兼容服务使用配置的基础URL、路径和请求头
+	var gotPath string
+	var gotHeader http.Header
+	var received model.OpenAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotHeader = r.Header
+		received = model.OpenAIRequest{}
+		json.NewDecoder(r.Body).Decode(&received)
+		if received.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\": [{\"delta\": {\"content\": \"流\"}}]}\n\n"))
+			w.Write([]byte("data: {\"choices\": [{\"delta\": {\"content\": \"式\"}}]}\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "来自vLLM"}}]}`))
+	}))
+	defer server.Close()
+
+	llm, err := model.CreateModel(model.ModelConfig{
+		Name:         "test-vllm",
+		Provider:     model.ProviderOpenAICompatible,
+		ModelID:      "meta-llama/Llama-3-8B-Instruct",
+		APIEndpoint:  server.URL + "/v1/",
+		Organization: "org-1",
+		Project:      "proj-1",
+		Headers:      map[string]string{"X-Gateway-Tenant": "team-a"},
+		Timeout:      5,
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+
+	text, err := llm.Generate(context.Background(), "你好")
+	if err != nil || text != "来自vLLM" {
+		t.Fatalf("生成失败: %q, %v", text, err)
+	}
+	if gotPath != "/v1/chat/completions" {
+		t.Errorf("请求路径错误: %s", gotPath)
+	}
+	if received.Model != "meta-llama/Llama-3-8B-Instruct" {
+		t.Errorf("模型ID错误: %s", received.Model)
+	}
+	if gotHeader.Get("Authorization") != "" {
+		t.Error("未配置API key时不应发送Authorization")
+	}
+	if gotHeader.Get("OpenAI-Organization") != "org-1" || gotHeader.Get("OpenAI-Project") != "proj-1" || gotHeader.Get("X-Gateway-Tenant") != "team-a" {
+		t.Errorf("请求头错误: %v", gotHeader)
+	}
+
+	ch, err := model.Stream(context.Background(), llm, "你好")
+	if err != nil {
+		t.Fatalf("流式生成失败: %v", err)
+	}
+	if text, err := model.Collect(ch, nil); err != nil || text != "流式" {
+		t.Errorf("流式结果错误: %q, %v", text, err)
+	}
+
+	//测试路径覆盖以及OpenAI模型使用配置的api_endpoint
+	llm, err = model.CreateModel(model.ModelConfig{
+		Name:        "test-openai-endpoint",
+		ModelID:     "gpt-4",
+		APIKey:      "sk-test",
+		APIEndpoint: server.URL + "/gateway",
+		Path:        "/openai/chat",
+		Timeout:     5,
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	if _, err := llm.Generate(context.Background(), "你好"); err != nil {
+		t.Fatalf("生成失败: %v", err)
+	}
+	if gotPath != "/gateway/openai/chat" || gotHeader.Get("Authorization") != "Bearer sk-test" {
+		t.Errorf("路径或认证错误: %s %s", gotPath, gotHeader.Get("Authorization"))
+	}
+
+	if _, err := model.CreateModel(model.ModelConfig{Name: "test-no-endpoint", Provider: model.ProviderOpenAICompatible, ModelID: "x"}); err == nil {
+		t.Error("缺少api_endpoint时应当报错")
+	}
+}
+
+func TestAnthropicProvider(t *testing.T) {
+	//测试Anthropic Messages API的请求格式、内容块解析、流式事件和用量统计
+	var received model.AnthropicRequest
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		received = model.AnthropicRequest{}
+		json.NewDecoder(r.Body).Decode(&received)
+		if r.URL.Path != "/v1/messages" {
+			http.NotFound(w, r)
+			return
+		}
+		if received.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("event: message_start\ndata: {\"type\": \"message_start\", \"message\": {\"usage\": {\"input_tokens\": 7, \"output_tokens\": 1}}}\n\n"))
+			w.Write([]byte("event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"index\": 0, \"delta\": {\"type\": \"text_delta\", \"text\": \"你\"}}\n\n"))
+			w.Write([]byte("event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"index\": 0, \"delta\": {\"type\": \"text_delta\", \"text\": \"好\"}}\n\n"))
+			w.Write([]byte("event: message_delta\ndata: {\"type\": \"message_delta\", \"delta\": {\"stop_reason\": \"end_turn\"}, \"usage\": {\"output_tokens\": 2}}\n\n"))
+			w.Write([]byte("event: message_stop\ndata: {\"type\": \"message_stop\"}\n\n"))
+			return
+		}
+		if len(received.Tools) > 0 {
+			w.Write([]byte(`{"content": [{"type": "tool_use", "id": "toolu_1", "name": "weather", "input": {"city": "北京"}}], "stop_reason": "tool_use", "usage": {"input_tokens": 20, "output_tokens": 5}}`))
+			return
+		}
+		w.Write([]byte(`{"content": [{"type": "text", "text": "你好，"}, {"type": "text", "text": "我是Claude"}], "stop_reason": "end_turn", "usage": {"input_tokens": 10, "output_tokens": 4}}`))
+	}))
+	defer server.Close()
+
+	llm, err := model.CreateModel(model.ModelConfig{
+		Name:        "test-claude",
+		ModelID:     "claude-3-5-haiku-latest",
+		APIKey:      "sk-ant-test",
+		APIEndpoint: server.URL + "/v1",
+		Timeout:     5,
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	claude, ok := llm.(*model.AnthropicModel)
+	if !ok {
+		t.Fatalf("claude-*应路由到Anthropic模型，实际为%T", llm)
+	}
+
+	text, err := model.Chat(context.Background(), claude, []model.Message{
+		{Role: model.RoleSystem, Content: "你是助手"},
+		{Role: model.RoleUser, Content: "你好"},
+	}, model.ChatOptions{MaxTokens: 64})
+	if err != nil || text != "你好，我是Claude" {
+		t.Fatalf("Chat失败: %q, %v", text, err)
+	}
+	if received.System != "你是助手" || len(received.Messages) != 1 || received.MaxTokens != 64 {
+		t.Errorf("请求格式错误: %+v", received)
+	}
+	if gotHeader.Get("x-api-key") != "sk-ant-test" || gotHeader.Get("anthropic-version") == "" {
+		t.Errorf("请求头错误: %v", gotHeader)
+	}
+
+	response, err := claude.CreateMessage(context.Background(), model.AnthropicRequest{
+		Messages: []model.AnthropicMessage{{Role: model.RoleUser, Content: []model.ContentBlock{{Type: "text", Text: "北京天气"}}}},
+		Tools:    []model.AnthropicTool{{Name: "weather", InputSchema: map[string]interface{}{"type": "object"}}},
+	})
+	if err != nil {
+		t.Fatalf("CreateMessage失败: %v", err)
+	}
+	if uses := response.ToolUses(); len(uses) != 1 || uses[0].Name != "weather" || !strings.Contains(string(uses[0].Input), "北京") {
+		t.Errorf("tool_use块解析错误: %+v", response.Content)
+	}
+
+	ch, err := model.Stream(context.Background(), claude, "你好")
+	if err != nil {
+		t.Fatalf("流式生成失败: %v", err)
+	}
+	if text, err := model.Collect(ch, nil); err != nil || text != "你好" {
+		t.Errorf("流式结果错误: %q, %v", text, err)
+	}
+
+	usage := claude.Usage()
+	if usage.InputTokens != 37 || usage.OutputTokens != 11 {
+		t.Errorf("用量统计错误: %+v", usage)
+	}
+}
+
+func TestOllamaProvider(t *testing.T) {
+	//测试Ollama的/api/chat、/api/generate、NDJSON流式以及/api/tags
+	var chatRequest model.OllamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			json.NewDecoder(r.Body).Decode(&chatRequest)
+			w.Write([]byte(`{"model": "llama3.1:8b", "message": {"role": "assistant", "content": "{\"ok\": true}"}, "done": true}`))
+		case "/api/generate":
+			var request model.OllamaGenerateRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			if !request.Stream {
+				w.Write([]byte(`{"response": "完整响应", "done": true}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Write([]byte("{\"response\": \"逐\", \"done\": false}\n{\"response\": \"行\", \"done\": false}\n{\"response\": \"\", \"done\": true}\n"))
+		case "/api/tags":
+			w.Write([]byte(`{"models": [{"name": "llama3.1:8b", "size": 4661224676}, {"name": "qwen2.5:7b"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	llm, err := model.CreateModel(model.ModelConfig{
+		Name:        "test-ollama",
+		Provider:    "ollama",
+		ModelID:     "llama3.1:8b",
+		APIEndpoint: server.URL,
+		Temperature: 0.2,
+		Timeout:     5,
+		Options:     map[string]interface{}{"keep_alive": "10m", "num_ctx": 8192, "format": "json"},
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+
+	text, err := model.Chat(context.Background(), llm, []model.Message{
+		{Role: model.RoleSystem, Content: "只输出JSON"},
+		{Role: model.RoleUser, Content: "状态"},
+	}, model.ChatOptions{})
+	if err != nil || text != `{"ok": true}` {
+		t.Fatalf("Chat失败: %q, %v", text, err)
+	}
+	if chatRequest.Stream || chatRequest.Format != "json" || chatRequest.KeepAlive != "10m" {
+		t.Errorf("请求字段错误: %+v", chatRequest)
+	}
+	if chatRequest.Options["num_ctx"] != float64(8192) || chatRequest.Options["temperature"] != 0.2 {
+		t.Errorf("options错误: %v", chatRequest.Options)
+	}
+	if _, exists := chatRequest.Options["keep_alive"]; exists {
+		t.Error("keep_alive不应放入options")
+	}
+
+	if text, err := llm.Generate(context.Background(), "你好"); err != nil || text != "完整响应" {
+		t.Errorf("Generate失败: %q, %v", text, err)
+	}
+
+	ch, err := model.Stream(context.Background(), llm, "你好")
+	if err != nil {
+		t.Fatalf("流式生成失败: %v", err)
+	}
+	if text, err := model.Collect(ch, nil); err != nil || text != "逐行" {
+		t.Errorf("流式结果错误: %q, %v", text, err)
+	}
+
+	models, err := llm.(*model.OllamaModel).ListModels(context.Background())
+	if err != nil || len(models) != 2 || models[0].Name != "llama3.1:8b" {
+		t.Errorf("模型列表错误: %+v, %v", models, err)
+	}
+
+	//按实例名列出本地模型时展开包装，非Ollama模型返回ErrNotOllama
+	if _, err := model.CreateModel(model.ModelConfig{
+		Name:        "test-ollama-limited",
+		Provider:    "ollama",
+		ModelID:     "llama3.1:8b",
+		APIEndpoint: server.URL,
+		Timeout:     5,
+		RateLimit:   &model.RateLimitConfig{RPM: 60},
+	}); err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	models, err = model.ListOllamaModels(context.Background(), "test-ollama-limited")
+	if err != nil || len(models) != 2 {
+		t.Errorf("按实例名列出本地模型失败: %+v, %v", models, err)
+	}
+	if _, err := model.CreateModel(model.ModelConfig{
+		Name:        "test-not-ollama",
+		Provider:    "openai-compatible",
+		ModelID:     "gpt-4o",
+		APIEndpoint: server.URL,
+		Timeout:     5,
+	}); err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	if _, err := model.ListOllamaModels(context.Background(), "test-not-ollama"); !errors.Is(err, model.ErrNotOllama) {
+		t.Errorf("期望ErrNotOllama，实际为%v", err)
+	}
+}
+
+func TestGeminiProvider(t *testing.T) {
+	//测试Gemini的请求格式、函数调用、多模态部分、流式响应和用量元数据
+	var received model.GeminiRequest
+	var gotPath, gotQuery, gotKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotKey = r.URL.Path, r.URL.RawQuery, r.Header.Get("x-goog-api-key")
+		received = model.GeminiRequest{}
+		json.NewDecoder(r.Body).Decode(&received)
+		switch {
+		case strings.HasSuffix(r.URL.Path, ":streamGenerateContent"):
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"candidates\": [{\"content\": {\"role\": \"model\", \"parts\": [{\"text\": \"流\"}]}}]}\n\n"))
+			w.Write([]byte("data: {\"candidates\": [{\"content\": {\"role\": \"model\", \"parts\": [{\"text\": \"式\"}]}, \"finishReason\": \"STOP\"}], \"usageMetadata\": {\"promptTokenCount\": 3, \"candidatesTokenCount\": 2}}\n\n"))
+		case len(received.Tools) > 0:
+			w.Write([]byte(`{"candidates": [{"content": {"role": "model", "parts": [{"functionCall": {"name": "weather", "args": {"city": "北京"}}}]}, "finishReason": "STOP"}], "usageMetadata": {"promptTokenCount": 20, "candidatesTokenCount": 5}}`))
+		default:
+			w.Write([]byte(`{"candidates": [{"content": {"role": "model", "parts": [{"text": "你好，"}, {"text": "我是Gemini"}]}, "finishReason": "STOP"}], "usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 4}}`))
+		}
+	}))
+	defer server.Close()
+
+	llm, err := model.CreateModel(model.ModelConfig{
+		Name:        "test-gemini",
+		ModelID:     "gemini-1.5-pro",
+		APIKey:      "g-test",
+		APIEndpoint: server.URL + "/v1beta",
+		Timeout:     5,
+		Options: map[string]interface{}{"safety_settings": []interface{}{
+			map[string]interface{}{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_ONLY_HIGH"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	gemini, ok := llm.(*model.GeminiModel)
+	if !ok {
+		t.Fatalf("gemini-*应路由到Gemini模型，实际为%T", llm)
+	}
+
+	text, err := model.Chat(context.Background(), gemini, []model.Message{
+		{Role: model.RoleSystem, Content: "你是助手"},
+		{Role: model.RoleUser, Content: "你好"},
+		{Role: model.RoleAssistant, Content: "请问有什么可以帮你"},
+		{Role: model.RoleUser, Content: "介绍一下你自己"},
+	}, model.ChatOptions{})
+	if err != nil || text != "你好，我是Gemini" {
+		t.Fatalf("Chat失败: %q, %v", text, err)
+	}
+	if gotPath != "/v1beta/models/gemini-1.5-pro:generateContent" || gotKey != "g-test" {
+		t.Errorf("请求地址或认证错误: %s %s", gotPath, gotKey)
+	}
+	if received.SystemInstruction == nil || received.SystemInstruction.Parts[0].Text != "你是助手" {
+		t.Errorf("systemInstruction错误: %+v", received.SystemInstruction)
+	}
+	if len(received.Contents) != 3 || received.Contents[1].Role != "model" {
+		t.Errorf("contents错误: %+v", received.Contents)
+	}
+	if len(received.SafetySettings) != 1 || received.SafetySettings[0].Threshold != "BLOCK_ONLY_HIGH" {
+		t.Errorf("safetySettings错误: %+v", received.SafetySettings)
+	}
+
+	response, err := gemini.GenerateContent(context.Background(), model.GeminiRequest{
+		Contents: []model.GeminiContent{{Role: "user", Parts: []model.GeminiPart{
+			{Text: "这张图里是哪个城市？查一下天气"},
+			{InlineData: &model.GeminiBlob{MimeType: "image/png", Data: "iVBORw0KGgo="}},
+		}}},
+		Tools: []model.GeminiTool{{FunctionDeclarations: []model.GeminiFunctionDeclaration{{Name: "weather"}}}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateContent失败: %v", err)
+	}
+	if received.Contents[0].Parts[1].InlineData == nil {
+		t.Error("多模态部分未发送")
+	}
+	if calls := response.FunctionCalls(); len(calls) != 1 || calls[0].Args["city"] != "北京" {
+		t.Errorf("functionCall解析错误: %+v", response.Candidates)
+	}
+
+	ch, err := model.Stream(context.Background(), gemini, "你好")
+	if err != nil {
+		t.Fatalf("流式生成失败: %v", err)
+	}
+	if text, err := model.Collect(ch, nil); err != nil || text != "流式" {
+		t.Errorf("流式结果错误: %q, %v", text, err)
+	}
+	if gotQuery != "alt=sse" {
+		t.Errorf("流式请求缺少alt=sse: %s", gotQuery)
+	}
+
+	usage := gemini.Usage()
+	if usage.InputTokens != 33 || usage.OutputTokens != 11 {
+		t.Errorf("用量统计错误: %+v", usage)
+	}
+
+	//消息中的图片映射为inlineData和fileData部分
+	if _, err := model.Chat(context.Background(), gemini, []model.Message{{
+		Role:    model.RoleUser,
+		Content: "描述图片",
+		Images: []model.ImagePart{
+			{Data: "iVBORw0KGgo="},
+			{URL: "data:image/jpeg;base64,/9j/4AAQ"},
+			{URL: "https://example.com/chart.webp"},
+		},
+	}}, model.ChatOptions{}); err != nil {
+		t.Fatalf("带图片的Chat失败: %v", err)
+	}
+	if parts := received.Contents[0].Parts; len(parts) != 4 || parts[0].Text != "描述图片" ||
+		parts[1].InlineData == nil || parts[1].InlineData.MimeType != "image/png" ||
+		parts[2].InlineData == nil || parts[2].InlineData.MimeType != "image/jpeg" || parts[2].InlineData.Data != "/9j/4AAQ" ||
+		parts[3].FileData == nil || parts[3].FileData.MimeType != "image/webp" || parts[3].FileData.FileURI != "https://example.com/chart.webp" {
+		t.Errorf("图片部分错误: %+v", received.Contents[0].Parts)
+	}
+}
+
+func TestAzureOpenAIProvider(t *testing.T) {
+	//测试Azure OpenAI的部署地址、api-version以及api-key/Entra两种认证方式
+	var gotURL string
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL, gotHeader = r.URL.String(), r.Header
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "来自Azure"}}]}`))
+	}))
+	defer server.Close()
+
+	options := map[string]interface{}{
+		"api_version": "2024-10-21",
+		"deployments": map[string]interface{}{"gpt-4o": "prod-gpt4o", "gpt-4o-mini": "mini-eastus"},
+	}
+	llm, err := model.CreateModel(model.ModelConfig{
+		Name:        "test-azure-4o",
+		Provider:    model.ProviderAzureOpenAI,
+		ModelID:     "gpt-4o",
+		APIKey:      "azure-key",
+		APIEndpoint: server.URL,
+		Timeout:     5,
+		Options:     options,
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	if text, err := llm.Generate(context.Background(), "你好"); err != nil || text != "来自Azure" {
+		t.Fatalf("生成失败: %q, %v", text, err)
+	}
+	if gotURL != "/openai/deployments/prod-gpt4o/chat/completions?api-version=2024-10-21" {
+		t.Errorf("部署地址错误: %s", gotURL)
+	}
+	if gotHeader.Get("api-key") != "azure-key" || gotHeader.Get("Authorization") != "" {
+		t.Errorf("api-key认证错误: %v", gotHeader)
+	}
+
+	//同一组映射下的另一个模型名使用不同的部署，并使用Entra令牌
+	entraOptions := map[string]interface{}{"auth": model.AzureAuthEntra}
+	for k, v := range options {
+		entraOptions[k] = v
+	}
+	llm, err = model.CreateModel(model.ModelConfig{
+		Name:        "test-azure-mini",
+		Provider:    model.ProviderAzureOpenAI,
+		ModelID:     "gpt-4o-mini",
+		APIKey:      "entra-token",
+		APIEndpoint: server.URL,
+		Timeout:     5,
+		Options:     entraOptions,
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	if _, err := llm.Generate(context.Background(), "你好"); err != nil {
+		t.Fatalf("生成失败: %v", err)
+	}
+	if !strings.HasPrefix(gotURL, "/openai/deployments/mini-eastus/") || gotHeader.Get("Authorization") != "Bearer entra-token" || gotHeader.Get("api-key") != "" {
+		t.Errorf("Entra认证或部署映射错误: %s %v", gotURL, gotHeader)
+	}
+
+	//令牌提供者在每次请求时获取令牌
+	calls := 0
+	llm, err = model.NewAzureOpenAIModelWithTokenProvider(model.ModelConfig{
+		Name: "test-azure-provider", ModelID: "gpt-4o", APIEndpoint: server.URL, Timeout: 5,
+	}, func(ctx context.Context) (string, error) {
+		calls++
+		return fmt.Sprintf("token-%d", calls), nil
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	llm.Generate(context.Background(), "a")
+	llm.Generate(context.Background(), "b")
+	if gotHeader.Get("Authorization") != "Bearer token-2" || !strings.Contains(gotURL, "/deployments/gpt-4o/") {
+		t.Errorf("令牌提供者未生效: %s %s", gotURL, gotHeader.Get("Authorization"))
+	}
+
+	//配置托管标识认证时从元数据服务获取令牌并缓存到过期前
+	identityCalls := 0
+	var identityQuery url.Values
+	identity := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identityCalls++
+		identityQuery = r.URL.Query()
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": "mi-token", "expires_on": "%d"}`, time.Now().Add(time.Hour).Unix())
+	}))
+	defer identity.Close()
+
+	llm, err = model.CreateModel(model.ModelConfig{
+		Name: "test-azure-mi", Provider: model.ProviderAzureOpenAI, ModelID: "gpt-4o", APIEndpoint: server.URL, Timeout: 5,
+		Options: map[string]interface{}{"auth": model.AzureAuthManagedIdentity, "client_id": "cid", "identity_endpoint": identity.URL},
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	llm.Generate(context.Background(), "a")
+	llm.Generate(context.Background(), "b")
+	if gotHeader.Get("Authorization") != "Bearer mi-token" || identityCalls != 1 || identityQuery.Get("client_id") != "cid" {
+		t.Errorf("托管标识认证错误: %s, 获取%d次, %v", gotHeader.Get("Authorization"), identityCalls, identityQuery)
+	}
+
+	//配置令牌命令时使用命令输出的令牌
+	llm, err = model.CreateModel(model.ModelConfig{
+		Name: "test-azure-cmd", Provider: model.ProviderAzureOpenAI, ModelID: "gpt-4o", APIEndpoint: server.URL, Timeout: 5,
+		Options: map[string]interface{}{"auth": model.AzureAuthCommand, "token_command": "echo cmd-token"},
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	if _, err := llm.Generate(context.Background(), "a"); err != nil || gotHeader.Get("Authorization") != "Bearer cmd-token" {
+		t.Errorf("令牌命令认证错误: %s, %v", gotHeader.Get("Authorization"), err)
+	}
+	if _, err := model.CreateModel(model.ModelConfig{
+		Name: "test-azure-cmd-missing", Provider: model.ProviderAzureOpenAI, ModelID: "gpt-4o", APIEndpoint: server.URL,
+		Options: map[string]interface{}{"auth": model.AzureAuthCommand},
+	}); err == nil {
+		t.Error("缺少token_command时应创建失败")
+	}
+}
+
+func TestFallbackModel(t *testing.T) {
+	//测试回退链在可回退错误时尝试下一个模型，并记录响应的模型
+	status := http.StatusTooManyRequests
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error": {"code": "context_length_exceeded"}}`))
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "备用模型"}}]}`))
+	}))
+	defer secondary.Close()
+
+	for name, endpoint := range map[string]string{"test-fb-primary": primary.URL, "test-fb-secondary": secondary.URL} {
+		if _, err := model.CreateModel(model.ModelConfig{Name: name, Provider: model.ProviderOpenAICompatible, ModelID: "m", APIEndpoint: endpoint, Timeout: 5}); err != nil {
+			t.Fatalf("创建模型失败: %v", err)
+		}
+	}
+	if _, err := model.CreateModel(model.ModelConfig{Name: "test-fb-chain", Provider: model.ProviderFallback, Fallback: []string{"test-fb-primary", "test-fb-missing"}}); err == nil {
+		t.Error("引用不存在的模型时应当报错")
+	}
+	if _, err := model.CreateModel(model.ModelConfig{Name: "test-fb-chain", Provider: model.ProviderFallback, Fallback: []string{"test-fb-primary", "test-fb-secondary"}}); err != nil {
+		t.Fatalf("创建回退链失败: %v", err)
+	}
+
+	//虚拟名称可以像普通模型名一样使用
+	llm, err := model.CreateModel(model.ModelConfig{Name: "test-fb-chain", ModelID: "test-fb-chain"})
+	if err != nil {
+		t.Fatalf("按虚拟名称获取模型失败: %v", err)
+	}
+	chain := llm.(*model.FallbackModel)
+
+	for _, code := range []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusBadRequest} {
+		status = code
+		text, err := chain.Generate(context.Background(), "你好")
+		if err != nil || text != "备用模型" {
+			t.Errorf("状态码%d时应回退: %q, %v", code, text, err)
+		}
+	}
+	if chain.LastAnswered() != "test-fb-secondary" || chain.Answered()["test-fb-secondary"] != 3 {
+		t.Errorf("响应模型记录错误: %s %v", chain.LastAnswered(), chain.Answered())
+	}
+
+	//不可回退的错误直接返回
+	status = http.StatusUnauthorized
+	_, err = chain.Generate(context.Background(), "你好")
+	var apiErr *model.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("401不应回退，实际错误: %v", err)
+	}
+
+	if class := model.ClassifyError(context.DeadlineExceeded); class != model.ErrorClassTimeout {
+		t.Errorf("超时分类错误: %s", class)
+	}
+}
+
+func TestModelPool(t *testing.T) {
+	//测试多密钥池的轮询、加权分配、被动健康检查和按密钥统计
+	var mu sync.Mutex
+	hits := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		hits[key]++
+		mu.Unlock()
+		if key == "sk-limited-key" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "` + key + `"}}]}`))
+	}))
+	defer server.Close()
+
+	llm, err := model.CreateModel(model.ModelConfig{
+		Name:        "test-pool-rr",
+		ModelID:     "gpt-4",
+		APIEndpoint: server.URL,
+		Timeout:     5,
+		Pool: &model.PoolConfig{Members: []model.PoolMember{
+			{Name: "a", APIKey: "sk-key-a"},
+			{Name: "limited", APIKey: "sk-limited-key"},
+			{Name: "b", APIKey: "sk-key-b"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("创建模型池失败: %v", err)
+	}
+	pool := llm.(*model.PoolModel)
+
+	for i := 0; i < 6; i++ {
+		if _, err := pool.Generate(context.Background(), "你好"); err != nil {
+			t.Fatalf("第%d次请求失败: %v", i+1, err)
+		}
+	}
+	if hits["sk-limited-key"] != 1 {
+		t.Errorf("限流的密钥应在首次429后移出轮换，实际请求%d次", hits["sk-limited-key"])
+	}
+	if hits["sk-key-a"]+hits["sk-key-b"] != 6 || hits["sk-key-a"] < 2 || hits["sk-key-b"] < 2 {
+		t.Errorf("请求未在健康密钥间轮询: %v", hits)
+	}
+
+	stats := pool.Stats()
+	if stats[1].Healthy || stats[1].Failures != 1 || stats[1].CooldownUntil == nil {
+		t.Errorf("限流密钥的统计错误: %+v", stats[1])
+	}
+	if stats[0].Successes+stats[2].Successes != 6 || stats[0].InFlight != 0 {
+		t.Errorf("健康密钥的统计错误: %+v", stats)
+	}
+
+	//加权策略按权重分配
+	hits = map[string]int{}
+	llm, err = model.CreateModel(model.ModelConfig{
+		Name:        "test-pool-weighted",
+		ModelID:     "gpt-4",
+		APIEndpoint: server.URL,
+		Timeout:     5,
+		Pool: &model.PoolConfig{Strategy: model.PoolWeighted, Members: []model.PoolMember{
+			{APIKey: "sk-key-a", Weight: 3},
+			{APIKey: "sk-key-b", Weight: 1},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("创建模型池失败: %v", err)
+	}
+	for i := 0; i < 8; i++ {
+		llm.Generate(context.Background(), "你好")
+	}
+	if hits["sk-key-a"] != 6 || hits["sk-key-b"] != 2 {
+		t.Errorf("加权分配错误: %v", hits)
+	}
+
+	if _, err := model.CreateModel(model.ModelConfig{Name: "test-pool-bad", ModelID: "gpt-4", APIKey: "k", Pool: &model.PoolConfig{Strategy: "random", Members: []model.PoolMember{{}}}}); err == nil {
+		t.Error("未知的池化策略应当报错")
+	}
+}
+
+func TestRateLimitedModel(t *testing.T) {
+	//测试令牌桶限流：配额充足时直接放行，不足时排队，超过最长等待时拒绝
+	llm := model.NewRateLimitedModel(&TestModel{config: model.ModelConfig{Name: "test-limited", MaxTokens: 300}},
+		model.RateLimitConfig{TPM: 600, MaxWait: 1})
+
+	//每次请求约占用301个token，第一次直接放行
+	if _, err := llm.Generate(context.Background(), "hi"); err != nil {
+		t.Fatalf("首次请求不应被限流: %v", err)
+	}
+
+	//第二次需要等待约0.2秒补充token
+	start := time.Now()
+	if _, err := llm.Generate(context.Background(), "hi"); err != nil {
+		t.Fatalf("排队的请求应在配额补充后放行: %v", err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("配额不足时请求应当排队等待")
+	}
+
+	//第三次需要等待约30秒，超过最长等待
+	_, err := llm.Generate(context.Background(), "hi")
+	if !errors.Is(err, model.ErrRateLimitWait) {
+		t.Fatalf("超过最长等待应返回ErrRateLimitWait，实际: %v", err)
+	}
+	if model.ClassifyError(err) != model.ErrorClassRateLimit {
+		t.Errorf("限流等待超时应归类为rate_limit，实际: %s", model.ClassifyError(err))
+	}
+
+	stats := llm.Stats()
+	if stats.Admitted != 2 || stats.Queued != 2 || stats.Rejected != 1 || stats.QueueDepth != 0 || stats.MaxQueueDepth != 1 {
+		t.Errorf("限流统计错误: %+v", stats)
+	}
+
+	info := model.DescribeModel(llm)
+	if info.RateLimit == nil || info.RateLimit.TPM != 600 {
+		t.Errorf("模型描述应包含限流统计: %+v", info)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	//测试熔断器：连续失败后打开并快速失败，半开试探成功后关闭
+	var mu sync.Mutex
+	down := true
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "恢复"}}]}`))
+	}))
+	defer server.Close()
+
+	var events []model.BreakerEvent
+	model.OnBreakerStateChange(func(event model.BreakerEvent) {
+		if event.Model == "test-breaker" {
+			mu.Lock()
+			events = append(events, event)
+			mu.Unlock()
+		}
+	})
+
+	llm, err := model.CreateModel(model.ModelConfig{
+		Name:        "test-breaker",
+		ModelID:     "gpt-4",
+		APIKey:      "k",
+		APIEndpoint: server.URL,
+		Timeout:     5,
+		Breaker:     &model.BreakerConfig{FailureThreshold: 2, OpenTimeout: 1},
+		Retry:       &model.RetryConfig{MaxRetries: -1}, //每次调用只请求一次，便于计数
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := llm.Generate(context.Background(), "你好"); err == nil {
+			t.Fatal("服务不可用时应返回错误")
+		}
+	}
+
+	//熔断打开后不再请求服务
+	_, err = llm.Generate(context.Background(), "你好")
+	if !errors.Is(err, model.ErrBreakerOpen) {
+		t.Fatalf("熔断打开后应快速失败，实际: %v", err)
+	}
+	if model.ClassifyError(err) != model.ErrorClassServer {
+		t.Errorf("熔断错误应归类为server，实际: %s", model.ClassifyError(err))
+	}
+	mu.Lock()
+	if calls != 2 {
+		t.Errorf("熔断打开后不应请求服务，实际请求%d次", calls)
+	}
+	mu.Unlock()
+	if info := model.DescribeModel(llm); info.Breaker == nil || info.Breaker.State != model.BreakerOpen {
+		t.Errorf("模型描述应展示熔断状态: %+v", info.Breaker)
+	}
+
+	//打开超时后半开试探，成功则关闭
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	time.Sleep(1100 * time.Millisecond)
+	if result, err := llm.Generate(context.Background(), "你好"); err != nil || result != "恢复" {
+		t.Fatalf("半开试探应放行请求: %q, %v", result, err)
+	}
+	if info := model.DescribeModel(llm); info.Breaker.State != model.BreakerClosed || info.Breaker.Trips != 1 || info.Breaker.Rejected != 1 {
+		t.Errorf("试探成功后应关闭: %+v", info.Breaker)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var transitions []string
+	for _, event := range events {
+		transitions = append(transitions, event.From+"->"+event.To)
+	}
+	if strings.Join(transitions, ",") != "closed->open,open->half_open,half_open->closed" {
+		t.Errorf("状态变化事件错误: %v", transitions)
+	}
+}
+
+func TestCachedModel(t *testing.T) {
+	//测试响应缓存：规范化后的相同提示词命中缓存，temperature大于0时默认绕过
+	llm := &ScriptedModel{responses: []string{"第一次", "第二次", "第三次"}}
+	cached := model.NewCachedModel(llm, model.NewMemoryCache(10), model.CacheConfig{})
+
+	first, _ := cached.Generate(context.Background(), "制定计划")
+	second, _ := cached.Generate(context.Background(), "  制定计划\n")
+	if first != "第一次" || second != "第一次" || len(llm.prompts) != 1 {
+		t.Errorf("相同提示词应命中缓存: %q, %q, 调用%d次", first, second, len(llm.prompts))
+	}
+
+	//Chat的参数不同则缓存键不同
+	temperature := 0.0
+	messages := []model.Message{{Role: model.RoleUser, Content: "制定计划"}}
+	if text, _ := cached.Chat(context.Background(), messages, model.ChatOptions{Temperature: &temperature, MaxTokens: 10}); text != "第二次" {
+		t.Errorf("不同参数不应命中缓存: %q", text)
+	}
+
+	//temperature大于0时绕过缓存
+	temperature = 0.7
+	cached.Chat(context.Background(), messages, model.ChatOptions{Temperature: &temperature, MaxTokens: 10})
+	if len(llm.prompts) != 3 {
+		t.Errorf("temperature大于0时应绕过缓存，调用%d次", len(llm.prompts))
+	}
+
+	stats := cached.Stats()
+	if stats.Backend != model.CacheMemory || stats.Hits != 1 || stats.Misses != 2 || stats.Bypassed != 1 {
+		t.Errorf("缓存统计错误: %+v", stats)
+	}
+
+	//强制缓存时temperature大于0也命中
+	forced := model.NewCachedModel(&ScriptedModel{responses: []string{"随机"}}, model.NewMemoryCache(10), model.CacheConfig{Force: true})
+	forced.Chat(context.Background(), messages, model.ChatOptions{Temperature: &temperature})
+	if text, err := forced.Chat(context.Background(), messages, model.ChatOptions{Temperature: &temperature}); err != nil || text != "随机" {
+		t.Errorf("强制缓存时应命中: %q, %v", text, err)
+	}
+
+	//磁盘缓存在新实例中仍然有效
+	dir := t.TempDir()
+	store, err := model.NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("创建磁盘缓存失败: %v", err)
+	}
+	model.NewCachedModel(&ScriptedModel{responses: []string{"磁盘"}}, store, model.CacheConfig{Backend: model.CacheDisk}).Generate(context.Background(), "你好")
+	store, _ = model.NewDiskCache(dir)
+	if text, err := model.NewCachedModel(&ScriptedModel{}, store, model.CacheConfig{Backend: model.CacheDisk}).Generate(context.Background(), "你好"); err != nil || text != "磁盘" {
+		t.Errorf("磁盘缓存应跨实例命中: %q, %v", text, err)
+	}
+
+	//内存缓存按最近使用淘汰
+	lru := model.NewMemoryCache(2)
+	lru.Set(context.Background(), "a", "1", 0)
+	lru.Set(context.Background(), "b", "2", 0)
+	lru.Get(context.Background(), "a")
+	lru.Set(context.Background(), "c", "3", 0)
+	if _, ok, _ := lru.Get(context.Background(), "b"); ok || lru.Len() != 2 {
+		t.Error("应淘汰最久未使用的条目")
+	}
+}
+
+// CharEmbeddingModel按字符计数生成向量的测试嵌入模型，相近的文本相似度高
+type CharEmbeddingModel struct{}
+
+func (m *CharEmbeddingModel) Embed(ctx context.Context, text string) ([]float32, error) {
+	vector := make([]float32, 64)
+	for _, r := range text {
+		vector[int(r)%64]++
+	}
+	return vector, nil
+}
+
+func (m *CharEmbeddingModel) Name() string {
+	return "char-embedding"
+}
+
+func TestAnswerCache(t *testing.T) {
+	//测试语义答案缓存：同一配置和租户内相近的查询复用答案，按租户隔离，可失效和按配置关闭
+	cache := core.NewAnswerCache(&CharEmbeddingModel{}, core.AnswerCacheConfig{
+		Enabled:          true,
+		Threshold:        0.9,
+		DisabledProfiles: []string{"no-cache"},
+	})
+	newAgent := func(profile, tenant string, llm model.Model) *core.Agent {
+		manager := tool.NewManager()
+		manager.Register(&TestTool{})
+		return core.NewAgent(core.AgentConfig{MaxIterations: 2, Timeout: 5 * time.Second, Profile: profile}).
+			WithModel(llm).
+			WithToolManager(manager).
+			WithAnswerCache(cache).
+			WithTenant(tenant)
+	}
+
+	plan := `{"thought": "调用工具 回答", "steps": [
+		{"action": "search_tool", "parameters": {"tool_name": "test_tool", "input": "x"}, "should_continue": false}
+	]}`
+	synthesis := `{"answer": "缓存的答案", "citations": []}`
+
+	if _, err := newAgent("support", "acme", &ScriptedModel{responses: []string{plan, synthesis}}).Run(context.Background(), "调用工具 回答"); err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+
+	//相近的查询直接命中，不调用模型
+	idle := &ScriptedModel{}
+	result, err := newAgent("support", "acme", idle).WithRunID("run_cached").Run(context.Background(), "调用工具 回答？")
+	if err != nil || result.Answer != "缓存的答案" || result.RunID != "run_cached" || len(idle.prompts) != 0 {
+		t.Fatalf("相近的查询应命中缓存: %+v, %v, 调用%d次", result, err, len(idle.prompts))
+	}
+
+	//其他租户和关闭缓存的配置不会命中
+	if _, err := newAgent("support", "other", &ScriptedModel{}).Run(context.Background(), "调用工具 回答"); err == nil {
+		t.Error("其他租户不应命中缓存")
+	}
+	if _, err := newAgent("no-cache", "acme", &ScriptedModel{}).Run(context.Background(), "调用工具 回答"); err == nil {
+		t.Error("关闭缓存的配置不应命中缓存")
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("缓存统计错误: %+v", stats)
+	}
+
+	if removed := cache.Invalidate(core.AnswerCacheFilter{Tenant: "acme"}); removed != 1 {
+		t.Errorf("应失效1条缓存，实际%d条", removed)
+	}
+	if _, err := newAgent("support", "acme", &ScriptedModel{}).Run(context.Background(), "调用工具 回答"); err == nil {
+		t.Error("失效后不应命中缓存")
+	}
+}
+
+func TestAnswerCacheEmbedding(t *testing.T) {
+	//测试语义答案缓存使用配置的嵌入模型，未配置时拒绝启用
+	cfg := config.GetDefaultConfig()
+	cfg.Agent.AnswerCache = core.AnswerCacheConfig{Enabled: true, Threshold: 0.9}
+	if err := cfg.Validate(); err == nil {
+		t.Error("未配置嵌入模型时启用答案缓存应验证失败")
+	}
+	if _, err := newAnswerCache(cfg); err == nil {
+		t.Error("未配置嵌入模型时不应创建答案缓存")
+	}
+
+	//按主题返回正交的向量，模拟真实嵌入模型
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Model string `json:"model"`
+			Input string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		embedding := []float32{0, 0, 1}
+		switch {
+		case strings.Contains(request.Input, "密码"):
+			embedding = []float32{1, 0.1, 0}
+		case strings.Contains(request.Input, "天气"):
+			embedding = []float32{0, 1, 0.1}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{{"embedding": embedding}},
+		})
+	}))
+	defer server.Close()
+
+	cfg.Embedding = rag.EmbeddingConfig{Model: "text-embedding-3-small", APIEndpoint: server.URL}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("配置嵌入模型后应验证通过: %v", err)
+	}
+	cache, err := newAnswerCache(cfg)
+	if err != nil {
+		t.Fatalf("创建答案缓存失败: %v", err)
+	}
+
+	ctx := context.Background()
+	scope := core.AnswerScope{Profile: "default"}
+	embedding, err := cache.Embed(ctx, "如何重置密码")
+	if err != nil {
+		t.Fatalf("生成嵌入向量失败: %v", err)
+	}
+	cache.Store(scope, "如何重置密码", embedding, &core.RunResult{Answer: "在设置页重置"})
+
+	for _, query := range []string{"明天北京天气怎么样", "推荐一本小说"} {
+		embedding, err := cache.Embed(ctx, query)
+		if err != nil {
+			t.Fatalf("生成嵌入向量失败: %v", err)
+		}
+		if hit := cache.Lookup(scope, embedding); hit != nil {
+			t.Errorf("不相关的查询%q不应命中缓存: %+v", query, hit)
+		}
+	}
+
+	embedding, _ = cache.Embed(ctx, "密码忘了怎么重置")
+	if hit := cache.Lookup(scope, embedding); hit == nil || hit.Result.Answer != "在设置页重置" {
+		t.Errorf("相近的查询应命中缓存: %+v", hit)
+	}
+}
+
+func TestProviderRetries(t *testing.T) {
+	//测试429/5xx自动重试、Retry-After处理以及服务商错误体解析
+	var mu sync.Mutex
+	var responses []func(w http.ResponseWriter)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if len(responses) == 0 {
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "成功"}}]}`))
+			return
+		}
+		respond := responses[0]
+		responses = responses[1:]
+		respond(w)
+	}))
+	defer server.Close()
+
+	script := func(fns ...func(w http.ResponseWriter)) {
+		mu.Lock()
+		defer mu.Unlock()
+		responses = fns
+		calls = 0
+	}
+	status := func(code int, retryAfter, body string) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(code)
+			w.Write([]byte(body))
+		}
+	}
+
+	llm, err := model.CreateModel(model.ModelConfig{
+		Name:        "test-retry",
+		Provider:    model.ProviderOpenAICompatible,
+		ModelID:     "m",
+		APIEndpoint: server.URL,
+		Timeout:     5,
+		Retry:       &model.RetryConfig{MaxRetries: 2, BaseDelay: 1, MaxDelay: 2},
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+
+	//429和5xx重试后成功
+	script(status(http.StatusTooManyRequests, "0", ""), status(http.StatusServiceUnavailable, "", ""))
+	if text, err := llm.Generate(context.Background(), "你好"); err != nil || text != "成功" || calls != 3 {
+		t.Errorf("应重试后成功: %q, %v, 请求%d次", text, err, calls)
+	}
+
+	//超过重试次数后返回解析后的类型化错误
+	body := `{"error": {"message": "Rate limit reached", "type": "requests", "code": "rate_limit_exceeded"}}`
+	script(status(429, "0", body), status(429, "0", body), status(429, "0", body))
+	_, err = llm.Generate(context.Background(), "你好")
+	var apiErr *model.APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, model.ErrRateLimited) || apiErr.Code != "rate_limit_exceeded" || apiErr.Message != "Rate limit reached" || calls != 3 {
+		t.Errorf("应在重试用尽后返回限流错误: %v, 请求%d次", err, calls)
+	}
+
+	//Retry-After超过等待上限时不再重试
+	script(status(http.StatusTooManyRequests, "60", ""))
+	if _, err := llm.Generate(context.Background(), "你好"); err == nil || calls != 1 {
+		t.Errorf("Retry-After超过上限时不应重试，请求%d次", calls)
+	}
+
+	//ctx剩余时间不足以等待时不再重试
+	script(status(http.StatusServiceUnavailable, "1", ""))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := llm.Generate(ctx, "你好"); !errors.Is(err, model.ErrServer) || calls != 1 {
+		t.Errorf("ctx时限不足时应直接返回: %v, 请求%d次", err, calls)
+	}
+
+	//4xx不重试，各服务商的错误体解析为类型和信息
+	for _, tc := range []struct{ body, kind, message string }{
+		{`{"type": "error", "error": {"type": "invalid_request_error", "message": "max_tokens too large"}}`, "invalid_request_error", "max_tokens too large"},
+		{`{"error": {"code": 400, "message": "API key not valid", "status": "INVALID_ARGUMENT"}}`, "INVALID_ARGUMENT", "API key not valid"},
+		{`{"code": "InvalidParameter", "message": "Input too long", "request_id": "req-1"}`, "InvalidParameter", "Input too long"},
+		{`{"error": "model not found"}`, "", "model not found"},
+	} {
+		script(status(http.StatusBadRequest, "", tc.body))
+		_, err := llm.Generate(context.Background(), "你好")
+		if !errors.As(err, &apiErr) || !errors.Is(err, model.ErrInvalidRequest) || calls != 1 {
+			t.Errorf("400应直接返回请求无效错误: %v, 请求%d次", err, calls)
+			continue
+		}
+		if (apiErr.Type != tc.kind && apiErr.Code != tc.kind) || apiErr.Message != tc.message {
+			t.Errorf("错误体解析错误: %+v", apiErr)
+		}
+	}
+}
+
+func TestTokenizer(t *testing.T) {
+	//测试BPE编码与tiktoken结果一致，以及按模型选择计数器
+	cases := []struct {
+		encoding string
+		text     string
+		want     []int
+	}{
+		{tokenizer.Cl100kBase, "hello world", []int{15339, 1917}},
+		{tokenizer.Cl100kBase, "I'm here  \n\n", []int{40, 2846, 1618, 19124}},
+		{tokenizer.Cl100kBase, "你好，世界", []int{57668, 53901, 3922, 3574, 244, 98220}},
+		{tokenizer.Cl100kBase, "HTTPServer 12345", []int{9412, 5592, 220, 4513, 1774}},
+		{tokenizer.O200kBase, "hello world", []int{24912, 2375}},
+		{tokenizer.O200kBase, "I'm here  \n\n", []int{15390, 2105, 11691}},
+		{tokenizer.O200kBase, "你好，世界", []int{177519, 979, 28428}},
+		{tokenizer.O200kBase, "HTTPServer 12345", []int{17893, 6444, 220, 7633, 2548}},
+	}
+	for _, tc := range cases {
+		encoding, err := tokenizer.GetEncoding(tc.encoding)
+		if err != nil {
+			t.Fatalf("获取编码失败: %v", err)
+		}
+		got, err := encoding.Encode(tc.text)
+		if err != nil {
+			t.Fatalf("编码失败: %v", err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s编码%q错误: %v, 期望%v", tc.encoding, tc.text, got, tc.want)
+		}
+		if count := encoding.Count(tc.text); count != len(tc.want) {
+			t.Errorf("%s计数%q错误: %d, 期望%d", tc.encoding, tc.text, count, len(tc.want))
+		}
+	}
+
+	for modelID, want := range map[string]string{
+		"gpt-4o-mini":    tokenizer.O200kBase,
+		"openai/o3-mini": tokenizer.O200kBase,
+		"gpt-4-turbo":    tokenizer.Cl100kBase,
+		"gpt-35-turbo":   tokenizer.Cl100kBase,
+		"claude-3-opus":  "",
+		"qwen-max":       "",
+	} {
+		if got := tokenizer.EncodingForModel(modelID); got != want {
+			t.Errorf("%s的编码错误: %q, 期望%q", modelID, got, want)
+		}
+	}
+
+	//未知模型使用启发式计数：中文每字1个，字母数字约4字符1个
+	if count := model.CountTokens("qwen-max", "你好，世界"); count != 5 {
+		t.Errorf("启发式计数错误: %d", count)
+	}
+	if count := model.CountTokens("claude-3-opus", "hello world 12345678"); count != 2+2+2 {
+		t.Errorf("启发式计数错误: %d", count)
+	}
+	if count := model.CountTokens("gpt-4o", "hello world"); count != 2 {
+		t.Errorf("BPE计数错误: %d", count)
+	}
+}
+
+func TestVisionInput(t *testing.T) {
+	//测试图片映射为OpenAI和通义千问VL的多模态格式，以及不支持视觉的模型拒绝图片
+	var body map[string]interface{}
+	reply := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(reply))
+	}))
+	defer server.Close()
+
+	images := []model.ImagePart{
+		{URL: "https://example.com/chart.png", Detail: "high"},
+		{Data: "iVBORw0KGgo=", MediaType: "image/png"},
+	}
+	messages := []model.Message{
+		{Role: model.RoleSystem, Content: "你是图表分析助手"},
+		{Role: model.RoleUser, Content: "图中哪个季度增长最快？", Images: images},
+	}
+
+	openai, err := model.CreateModel(model.ModelConfig{
+		Name:        "vision-openai",
+		Provider:    model.ProviderOpenAICompatible,
+		ModelID:     "gpt-4o",
+		APIEndpoint: server.URL,
+		Retry:       &model.RetryConfig{MaxRetries: -1},
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	reply = `{"choices": [{"message": {"role": "assistant", "content": "第三季度"}}]}`
+	text, err := model.Chat(context.Background(), openai, messages, model.ChatOptions{})
+	if err != nil || text != "第三季度" {
+		t.Fatalf("OpenAI图片调用失败: %q, %v", text, err)
+	}
+	sent := body["messages"].([]interface{})
+	if sent[0].(map[string]interface{})["content"] != "你是图表分析助手" {
+		t.Errorf("不带图片的消息应保持字符串内容: %v", sent[0])
+	}
+	parts := sent[1].(map[string]interface{})["content"].([]interface{})
+	if len(parts) != 3 || parts[0].(map[string]interface{})["text"] != "图中哪个季度增长最快？" {
+		t.Fatalf("OpenAI内容块错误: %v", parts)
+	}
+	imageURL := parts[1].(map[string]interface{})["image_url"].(map[string]interface{})
+	if imageURL["url"] != "https://example.com/chart.png" || imageURL["detail"] != "high" {
+		t.Errorf("图片地址映射错误: %v", imageURL)
+	}
+	if url := parts[2].(map[string]interface{})["image_url"].(map[string]interface{})["url"]; url != "data:image/png;base64,iVBORw0KGgo=" {
+		t.Errorf("base64图片应转换为data URL: %v", url)
+	}
+
+	qwen, err := model.CreateModel(model.ModelConfig{
+		Name:        "vision-qwen",
+		Provider:    "qwen",
+		ModelID:     "qwen-vl-max",
+		APIKey:      "sk-test",
+		APIEndpoint: server.URL,
+		Retry:       &model.RetryConfig{MaxRetries: -1},
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	reply = `{"output": {"choices": [{"message": {"role": "assistant", "content": [{"text": "第三"}, {"text": "季度"}]}}]}}`
+	text, err = model.Chat(context.Background(), qwen, messages, model.ChatOptions{})
+	if err != nil || text != "第三季度" {
+		t.Fatalf("通义千问VL调用失败: %q, %v", text, err)
+	}
+	sent = body["input"].(map[string]interface{})["messages"].([]interface{})
+	parts = sent[1].(map[string]interface{})["content"].([]interface{})
+	if len(parts) != 3 || parts[0].(map[string]interface{})["image"] != "https://example.com/chart.png" ||
+		parts[1].(map[string]interface{})["image"] != "data:image/png;base64,iVBORw0KGgo=" ||
+		parts[2].(map[string]interface{})["text"] != "图中哪个季度增长最快？" {
+		t.Errorf("通义千问内容块错误: %v", parts)
+	}
+
+	//未声明视觉能力的模型在注册表和调用时都拒绝图片
+	textOnly, err := model.CreateModel(model.ModelConfig{
+		Name:        "vision-text-only",
+		Provider:    model.ProviderOpenAICompatible,
+		ModelID:     "gpt-3.5-turbo",
+		APIEndpoint: server.URL,
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+	if err := model.ValidateImages("vision-text-only", images); !errors.Is(err, model.ErrVisionUnsupported) {
+		t.Errorf("注册表应拒绝图片: %v", err)
+	}
+	if _, err := model.Chat(context.Background(), textOnly, messages, model.ChatOptions{}); !errors.Is(err, model.ErrVisionUnsupported) {
+		t.Errorf("调用应拒绝图片: %v", err)
+	}
+	if err := model.ValidateImages("vision-openai", images); err != nil {
+		t.Errorf("视觉模型应接受图片: %v", err)
+	}
+	if err := model.ValidateImages("vision-openai", []model.ImagePart{{URL: "ftp://example.com/a.png"}}); err == nil {
+		t.Error("无效的图片地址应被拒绝")
+	}
+}
+
+func TestModelCapabilities(t *testing.T) {
+	//测试能力描述的查找与覆盖，以及规划时按能力启用JSON模式和裁剪对话历史
+	for _, tc := range []struct {
+		modelID, provider string
+		window            int
+		vision, jsonMode  bool
+	}{
+		{"gpt-4o-2024-08-06", "", 128000, true, true},
+		{"o3-mini", "", 200000, false, true},
+		{"claude-3-5-sonnet-latest", "", 200000, false, false},
+		{"qwen-vl-max", "", 131072, true, false},
+		{"custom-claude", "anthropic", 200000, false, false},
+		{"my-finetune", "", 0, false, false},
+	} {
+		caps := model.GlobalRegistry.TypeCapabilities(tc.modelID, tc.provider)
+		if caps.ContextWindow != tc.window || caps.HasModality(model.ModalityImage) != tc.vision || caps.JSONMode != tc.jsonMode {
+			t.Errorf("%s的能力描述错误: %+v", tc.modelID, caps)
+		}
+	}
+
+	var mu sync.Mutex
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body = nil
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"thought\": \"直接回答\", \"steps\": [{\"action\": \"reason\", \"parameters\": {\"prompt\": \"回答\"}}]}"}}]}`))
+	}))
+	defer server.Close()
+
+	enabled := true
+	llm, err := model.CreateModel(model.ModelConfig{
+		Name:        "capabilities-test",
+		Provider:    model.ProviderOpenAICompatible,
+		ModelID:     "my-finetune",
+		APIEndpoint: server.URL,
+		MaxTokens:   100,
+		Capabilities: &model.CapabilityOverrides{
+			ContextWindow: 1000,
+			JSONMode:      &enabled,
+			Pricing:       &model.Pricing{Input: 2, Output: 8, Currency: "USD"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建模型失败: %v", err)
+	}
+
+	caps := model.ModelCapabilities(llm)
+	if caps.ContextWindow != 1000 || !caps.JSONMode || !caps.Streaming || caps.HasModality(model.ModalityImage) {
+		t.Errorf("实例能力描述错误: %+v", caps)
+	}
+	if cost := caps.Cost(model.Usage{InputTokens: 500000, OutputTokens: 100000}); cost != 1.8 {
+		t.Errorf("费用计算错误: %v", cost)
+	}
+	if info := model.DescribeModel(llm); info.Capabilities.ContextWindow != 1000 {
+		t.Errorf("实例描述缺少能力信息: %+v", info)
+	}
+
+	//历史超出窗口时从最早的轮次开始丢弃
+	history := []model.Message{}
+	for i := 0; i < 10; i++ {
+		history = append(history,
+			model.Message{Role: model.RoleUser, Content: fmt.Sprintf("第%d个问题 %s", i, strings.Repeat("很长的上下文", 10))},
+			model.Message{Role: model.RoleAssistant, Content: fmt.Sprintf("第%d个回答", i)})
+	}
+	agent := core.NewAgent(core.AgentConfig{MaxIterations: 2, Timeout: 5 * time.Second}).
+		WithModel(llm).
+		WithHistory(history)
+	if _, err := agent.DryRun(context.Background(), "总结一下", false); err != nil {
+		t.Fatalf("试运行失败: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if format, _ := body["response_format"].(map[string]interface{}); format["type"] != "json_object" {
+		t.Errorf("支持JSON模式的模型规划时应启用JSON模式: %v", body["response_format"])
+	}
+	sent := body["messages"].([]interface{})
+	if len(sent) <= 1 || len(sent) >= len(history)+1 {
+		t.Fatalf("历史应被部分裁剪，实际发送%d条消息", len(sent))
+	}
+	first := sent[0].(map[string]interface{})
+	if first["role"] != model.RoleUser || !strings.HasPrefix(first["content"].(string), "第") {
+		t.Errorf("裁剪后应以user消息开头: %v", first)
+	}
+	if last := sent[len(sent)-2].(map[string]interface{}); last["content"] != "第9个回答" {
+		t.Errorf("应保留最近的轮次: %v", last)
+	}
+}